@@ -1,8 +1,10 @@
 package main
 
 import (
+	"os"
 	"token-balance/config"
 	_ "token-balance/docs" // 导入生成的docs包，用于Swagger文档
+	"token-balance/internal/cli"
 	"token-balance/internal/controllers"
 	"token-balance/internal/middleware"
 	"token-balance/internal/router"
@@ -48,6 +50,15 @@ func main() {
 	db := database.InitDB()
 	database.AutoMigrate(db)
 
+	// 命令行子命令 (例如 backfill)，执行完成后退出
+	if len(os.Args) > 1 {
+		if err := cli.Run(cfg, db, os.Args[1:]); err != nil {
+			middleware.Error("❌ %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 初始化服务
 	userService := services.NewUserService(db)
 	eventService, err := services.NewEventService(db, cfg)
@@ -60,19 +71,33 @@ func main() {
 	
 	// 初始化多链服务 (任务7: 完善多链支持)
 	multiChainService := services.NewMultiChainService(db, cfg)
+	backfillService := services.NewBackfillService(db, cfg)
+	tokenService := services.NewTokenService(db, cfg)
+	reconciliationService := services.NewReconciliationService(db, cfg)
+	deadLetterService := services.NewDeadLetterService(db)
+	replayService := services.NewReplayService(db)
+	snapshotService := services.NewSnapshotService(db)
+	distributionService := services.NewDistributionService(db)
 
 	// 初始化控制器
 	userController := controllers.NewUserController(userService)
-	eventController := controllers.NewEventController(eventService)
+	eventController := controllers.NewEventController(eventService, backfillService)
 	pointsController := controllers.NewPointsController(pointsService)
 	statsController := controllers.NewStatsController(statsService)
 	multiChainController := controllers.NewMultiChainController(multiChainService)
+	tokenController := controllers.NewTokenController(tokenService)
+	reconciliationController := controllers.NewReconciliationController(reconciliationService)
+	deadLetterController := controllers.NewDeadLetterController(deadLetterService)
+	replayController := controllers.NewReplayController(replayService)
+	snapshotController := controllers.NewSnapshotController(snapshotService)
+	distributionController := controllers.NewDistributionController(distributionService)
 
 	// 启动后台服务
 	if eventService != nil {
 		go eventService.StartEventListener()
 	}
 	go pointsService.StartPointsCalculation()
+	go reconciliationService.StartReconciliation()
 	
 	// 启动多链监听服务
 	go func() {
@@ -82,7 +107,7 @@ func main() {
 	}()
 
 	// 设置路由
-	router := router.SetupRouter(userController, eventController, pointsController, statsController, multiChainController)
+	router := router.SetupRouter(userController, eventController, pointsController, statsController, multiChainController, tokenController, reconciliationController, deadLetterController, replayController, snapshotController, distributionController)
 
 	// 启动服务器
 	middleware.Info("服务器启动在端口: %s", cfg.Server.Port)
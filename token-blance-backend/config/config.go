@@ -9,11 +9,14 @@ import (
 
 // Config 应用程序配置结构
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Ethereum EthereumConfig
-	JWT      JWTConfig
-	LogLevel string
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Ethereum  EthereumConfig
+	JWT       JWTConfig
+	Health    HealthConfig
+	Reconcile ReconcileConfig
+	Alert     AlertConfig
+	LogLevel  string
 }
 
 // ServerConfig 服务器配置
@@ -29,6 +32,8 @@ type DatabaseConfig struct {
 	User     string
 	DBName   string
 	Password string
+
+	SimulationDBName string // simulate 命令专用的数据库，未设置时拒绝运行
 }
 
 // EthereumConfig 以太坊配置
@@ -40,6 +45,20 @@ type EthereumConfig struct {
 	SepoliaRPCURL   string
 	// 🔗 多链支持配置
 	BaseSepoliaRPCURL string
+	// 📡 WebSocket 端点 (配置后使用订阅模式，断开时回退为轮询)
+	SepoliaWSURL     string
+	BaseSepoliaWSURL string
+	// 📦 合约部署区块，历史回填从这里开始
+	DeploymentBlock            uint64
+	BaseSepoliaDeploymentBlock uint64
+	// 🛡️ 确认策略: depth (固定确认深度)、safe 或 finalized (节点的区块标签)
+	// ETHEREUM_* 为默认值，未单独配置的链使用它
+	Finality                      string
+	ConfirmationBlocks            uint64
+	SepoliaFinality               string
+	SepoliaConfirmationBlocks     uint64
+	BaseSepoliaFinality           string
+	BaseSepoliaConfirmationBlocks uint64
 }
 
 // ChainConfig 链配置
@@ -63,41 +82,86 @@ type EthereumConfig struct {
 // 3. 为每个链创建独立的事件监听器
 type ChainConfig struct {
 	Name         string `json:"name"`         // 链名称 ("Sepolia", "Base Sepolia")
-	RPCURL       string `json:"rpc_url"`      // RPC端点地址
+	RPCURL       string `json:"rpc_url"`      // RPC端点地址 (第一个端点)
+	RPCURLs      []string `json:"rpc_urls"`   // 所有RPC端点，按健康度自动切换
+	WSURL        string `json:"ws_url"`       // WebSocket端点地址 (可选，用于订阅新区块)
 	ChainID      int64  `json:"chain_id"`     // 链ID (用于网络识别)
 	ContractAddr  string `json:"contract_address"` // 代币合约地址 (每链可以不同)
 	Enabled      bool   `json:"enabled"`      // 是否启用该链
+	StartBlock   uint64 `json:"start_block"`  // 合约部署区块 (历史回填起点)
+	Finality           string `json:"finality"`            // 确认策略: depth、safe 或 finalized
+	ConfirmationBlocks uint64 `json:"confirmation_blocks"` // depth 策略的确认区块数
 }
 
 // GetSupportedChains 获取支持的链配置
 func (c *Config) GetSupportedChains() map[string]ChainConfig {
 	chains := make(map[string]ChainConfig)
 	
-	// Sepolia 测试网
-	if c.Ethereum.SepoliaRPCURL != "" {
+	// Sepolia 测试网 (RPC地址可以用逗号分隔配置多个端点)
+	if urls := SplitList(c.Ethereum.SepoliaRPCURL); len(urls) > 0 {
 		chains["sepolia"] = ChainConfig{
 			Name:         "Sepolia",
-			RPCURL:       c.Ethereum.SepoliaRPCURL,
+			RPCURL:       urls[0],
+			RPCURLs:      urls,
+			WSURL:        c.Ethereum.SepoliaWSURL,
 			ChainID:      11155111,
 			ContractAddr:  c.Ethereum.ContractAddress,
 			Enabled:      true,
+			StartBlock:   c.Ethereum.DeploymentBlock,
+			Finality:           c.Ethereum.SepoliaFinality,
+			ConfirmationBlocks: c.Ethereum.SepoliaConfirmationBlocks,
 		}
 	}
 	
 	// Base Sepolia 测试网
-	if c.Ethereum.BaseSepoliaRPCURL != "" {
+	if urls := SplitList(c.Ethereum.BaseSepoliaRPCURL); len(urls) > 0 {
 		chains["base-sepolia"] = ChainConfig{
 			Name:         "Base Sepolia",
-			RPCURL:       c.Ethereum.BaseSepoliaRPCURL,
+			RPCURL:       urls[0],
+			RPCURLs:      urls,
+			WSURL:        c.Ethereum.BaseSepoliaWSURL,
 			ChainID:      84532,
 			ContractAddr:  c.Ethereum.ContractAddress,
 			Enabled:      true,
+			StartBlock:   c.Ethereum.BaseSepoliaDeploymentBlock,
+			Finality:           c.Ethereum.BaseSepoliaFinality,
+			ConfirmationBlocks: c.Ethereum.BaseSepoliaConfirmationBlocks,
 		}
 	}
 	
 	return chains
 }
 
+// HealthConfig 健康检查阈值
+//
+// 每项指标超过 Degraded 阈值时链状态为 degraded，超过 Down 阈值时为 down。
+type HealthConfig struct {
+	RPCLatencyDegradedMs int64  // RPC 往返延迟 (毫秒)
+	RPCLatencyDownMs     int64
+	BlockLagDegraded     uint64 // 已确认高度与已处理区块的差距 (区块数)
+	BlockLagDown         uint64
+	SyncAgeDegradedSec   int64  // 距离上次同步成功的时间 (秒)
+	SyncAgeDownSec       int64
+	ErrorsDegraded       int    // 连续同步失败次数
+	ErrorsDown           int
+}
+
+// ReconcileConfig 链上余额核对配置
+//
+// 定时在同步游标所在区块调用 balanceOf，与索引得到的持仓对比。
+type ReconcileConfig struct {
+	Enabled        bool   // 是否启动定时核对
+	Schedule       string // cron 表达式
+	SampleSize     int    // 每个代币每轮核对的持仓数，轮流覆盖所有持有人；0 表示全部核对
+	AutoFix        bool   // 发现不一致时是否自动按链上余额修正
+	SupplySchedule string // totalSupply 与持有人余额之和核对的 cron 表达式
+}
+
+// AlertConfig 告警配置
+type AlertConfig struct {
+	WebhookURL string // 告警以 JSON POST 到该地址，为空时只记录日志
+}
+
 // JWTConfig JWT配置
 type JWTConfig struct {
 	Secret string
@@ -109,6 +173,9 @@ func LoadConfig() *Config {
 	// 尝试加载.env文件
 	loadEnvFile(".env")
 
+	finality := getEnv("ETHEREUM_FINALITY", "depth")
+	confirmations := getEnvInt64("ETHEREUM_CONFIRMATIONS", 6)
+
 	return &Config{
 		Server: ServerConfig{
 			Port: getEnv("SERVER_PORT", "8080"),
@@ -120,6 +187,7 @@ func LoadConfig() *Config {
 			User:     getEnv("DB_USER", "root"),
 			Password: getEnv("DB_PASSWORD", ""),
 			DBName:   getEnv("DB_NAME", "token_balance"),
+			SimulationDBName: getEnv("SIMULATION_DB_NAME", ""),
 		},
 		Ethereum: EthereumConfig{
 			RPCEndpoint:      getEnv("ETHEREUM_RPC", "http://localhost:8545"),
@@ -128,11 +196,41 @@ func LoadConfig() *Config {
 			PrivateKey:       getEnv("PRIVATE_KEY", ""),
 			SepoliaRPCURL:    getEnv("SEPOLIA_RPC_URL", "https://sepolia.infura.io/v3/"),
 			BaseSepoliaRPCURL: getEnv("BASE_SEPOLIA_RPC_URL", ""),
+			SepoliaWSURL:      getEnv("SEPOLIA_WS_URL", ""),
+			BaseSepoliaWSURL:  getEnv("BASE_SEPOLIA_WS_URL", ""),
+			DeploymentBlock:   uint64(getEnvInt64("TOKEN_DEPLOYMENT_BLOCK", 0)),
+			BaseSepoliaDeploymentBlock: uint64(getEnvInt64("BASE_SEPOLIA_DEPLOYMENT_BLOCK", 0)),
+			Finality:                      finality,
+			ConfirmationBlocks:            uint64(confirmations),
+			SepoliaFinality:               getEnv("SEPOLIA_FINALITY", finality),
+			SepoliaConfirmationBlocks:     uint64(getEnvInt64("SEPOLIA_CONFIRMATIONS", confirmations)),
+			BaseSepoliaFinality:           getEnv("BASE_SEPOLIA_FINALITY", finality),
+			BaseSepoliaConfirmationBlocks: uint64(getEnvInt64("BASE_SEPOLIA_CONFIRMATIONS", confirmations)),
 		},
 		JWT: JWTConfig{
 			Secret: getEnv("JWT_SECRET", "token-balance-secret-key"),
 			Expire: getEnvInt("JWT_EXPIRE", 24),
 		},
+		Health: HealthConfig{
+			RPCLatencyDegradedMs: getEnvInt64("HEALTH_RPC_LATENCY_DEGRADED_MS", 2000),
+			RPCLatencyDownMs:     getEnvInt64("HEALTH_RPC_LATENCY_DOWN_MS", 10000),
+			BlockLagDegraded:     uint64(getEnvInt64("HEALTH_BLOCK_LAG_DEGRADED", 100)),
+			BlockLagDown:         uint64(getEnvInt64("HEALTH_BLOCK_LAG_DOWN", 2000)),
+			SyncAgeDegradedSec:   getEnvInt64("HEALTH_SYNC_AGE_DEGRADED_SECONDS", 120),
+			SyncAgeDownSec:       getEnvInt64("HEALTH_SYNC_AGE_DOWN_SECONDS", 900),
+			ErrorsDegraded:       getEnvInt("HEALTH_ERRORS_DEGRADED", 3),
+			ErrorsDown:           getEnvInt("HEALTH_ERRORS_DOWN", 10),
+		},
+		Reconcile: ReconcileConfig{
+			Enabled:        getEnvBool("RECONCILE_ENABLED", true),
+			Schedule:       getEnv("RECONCILE_SCHEDULE", "30 */6 * * *"),
+			SampleSize:     getEnvInt("RECONCILE_SAMPLE_SIZE", 500),
+			AutoFix:        getEnvBool("RECONCILE_AUTO_FIX", false),
+			SupplySchedule: getEnv("RECONCILE_SUPPLY_SCHEDULE", "*/15 * * * *"),
+		},
+		Alert: AlertConfig{
+			WebhookURL: getEnv("ALERT_WEBHOOK_URL", ""),
+		},
 		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}
 }
@@ -147,6 +245,17 @@ func (c *Config) GetDBDSN() string {
 	return c.Database.User + ":" + c.Database.Password + "@tcp(" + c.Database.Host + ":" + c.Database.Port + ")/" + c.Database.DBName + "?charset=utf8mb4&parseTime=True&loc=Local"
 }
 
+// SplitList 拆分逗号分隔的配置值 (例如多个RPC端点)，忽略空项
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getEnv 获取环境变量，如果不存在则返回默认值
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -175,6 +284,16 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+// getEnvBool 获取布尔环境变量 (true/false/1/0)
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
 // loadEnvFile 从.env文件加载环境变量
 func loadEnvFile(filename string) {
 	file, err := os.Open(filename)
@@ -0,0 +1,219 @@
+// Package cli 命令行子命令 (历史回填等运维操作)
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+	"token-balance/internal/services"
+	"token-balance/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+// Run 执行命令行子命令
+//
+// 用法:
+//
+//	api backfill -chain sepolia [-from 9724337] [-reset]
+//	api simulate
+//	api replay [-swap]
+//	api snapshot [-chain sepolia] [-token 0x...] (-block 9800000 | -time 2024-01-01T00:00:00Z) [-min 100] [-format csv] [-out snapshot.csv]
+func Run(cfg *config.Config, db *gorm.DB, args []string) error {
+	switch args[0] {
+	case "backfill":
+		return runBackfill(cfg, db, args[1:])
+	case "simulate":
+		return runSimulate(cfg)
+	case "replay":
+		return runReplay(db, args[1:])
+	case "snapshot":
+		return runSnapshot(db, args[1:])
+	default:
+		return fmt.Errorf("未知命令: %s", args[0])
+	}
+}
+
+// runBackfill 从合约部署区块开始回填历史事件，Ctrl+C 中断后再次执行会从游标继续
+func runBackfill(cfg *config.Config, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	chain := fs.String("chain", "sepolia", "链名称")
+	from := fs.Uint64("from", 0, "起始区块，默认使用配置的部署区块")
+	reset := fs.Bool("reset", false, "清除该链已同步的数据后重新回填")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	backfillService := services.NewBackfillService(db, cfg)
+	opts := services.BackfillOptions{
+		ChainName: *chain,
+		FromBlock: *from,
+		Reset:     *reset,
+	}
+
+	return backfillService.RunBackfill(ctx, opts, func(progress services.BackfillProgress) {
+		middleware.Info("📦 %s 回填进度: 区块 %d/%d (%.2f%%), 事件 %d, 预计剩余 %s",
+			progress.ChainName, progress.CurrentBlock, progress.TargetBlock, progress.Percent,
+			progress.EventsProcessed, time.Duration(progress.ETASeconds)*time.Second)
+	})
+}
+
+// runReplay 从原始日志把派生数据重建到影子表并输出差异，-swap 时随后替换线上数据
+func runReplay(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	swap := fs.Bool("swap", false, "回放完成后替换线上数据")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := services.NewReplayService(db).Replay(ctx, services.ReplayOptions{Swap: *swap})
+	if report != nil {
+		for _, chain := range report.Chains {
+			middleware.Info("⏪ %s: 游标 %d, 日志 %d, 余额修正 %d, 跳过 %d, 缺少原始日志 %d",
+				chain.ChainName, chain.LastBlock, chain.Logs, chain.Reconciliations, chain.Skipped, chain.MissingRawLogs)
+		}
+		if diff := report.Diff; diff != nil {
+			for _, sample := range diff.Samples {
+				middleware.Info("≠ 链 %d 代币 %s 地址 %s: 线上=%q, 回放=%q",
+					sample.ChainID, sample.TokenAddress, sample.UserAddress, sample.LiveBalance, sample.ReplayBalance)
+			}
+		}
+	}
+	return err
+}
+
+// runSnapshot 输出某个区块或时间点所有持有人的余额，默认写到标准输出
+func runSnapshot(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	chain := fs.String("chain", "", "链名称，按区块号快照时必填")
+	token := fs.String("token", "", "代币合约地址，默认所有代币")
+	block := fs.Uint64("block", 0, "快照区块号")
+	at := fs.String("time", "", "快照时间点，RFC3339 或 Unix 秒")
+	minBalance := fs.String("min", "", "最低余额，按代币精度换算后的数量")
+	format := fs.String("format", "json", "输出格式: json、csv")
+	out := fs.String("out", "", "输出文件，默认标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("format 只支持 json 和 csv: %s", *format)
+	}
+
+	opts := services.SnapshotOptions{
+		Chain:       *chain,
+		Token:       *token,
+		BlockNumber: *block,
+		MinBalance:  *minBalance,
+	}
+	if *at != "" {
+		timestamp, err := services.ParseSnapshotTime(*at)
+		if err != nil {
+			return err
+		}
+		opts.Timestamp = timestamp
+	}
+	snapshot, err := services.NewSnapshotService(db).PrepareSnapshot(opts)
+	if err != nil {
+		return err
+	}
+
+	writer := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	buffered := bufio.NewWriter(writer)
+
+	holders := 0
+	if *format == "csv" {
+		csvWriter := csv.NewWriter(buffered)
+		if err := csvWriter.Write(services.SnapshotCSVHeader); err != nil {
+			return err
+		}
+		err = snapshot.Each(func(entry services.SnapshotEntry) error {
+			holders++
+			return csvWriter.Write(entry.CSVRecord())
+		})
+		csvWriter.Flush()
+		if err == nil {
+			err = csvWriter.Error()
+		}
+	} else {
+		// 每行一个 JSON 对象，便于大快照逐行处理
+		encoder := json.NewEncoder(buffered)
+		err = snapshot.Each(func(entry services.SnapshotEntry) error {
+			holders++
+			return encoder.Encode(entry)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	middleware.Info("📸 余额快照完成: %d 个持有人", holders)
+	return nil
+}
+
+// runSimulate 在内存模拟链上跑通部署、铸造/转账/销毁、同步入账和积分计算，不需要 RPC
+//
+// 模拟会清除上一次模拟写入的数据，只在 SIMULATION_DB_NAME 指定的单独数据库中运行。
+func runSimulate(cfg *config.Config) error {
+	if cfg.Database.SimulationDBName == "" {
+		return fmt.Errorf("simulate 会清除模拟链的数据，请通过 SIMULATION_DB_NAME 指定单独的数据库")
+	}
+	if cfg.Database.SimulationDBName == cfg.Database.DBName {
+		return fmt.Errorf("SIMULATION_DB_NAME 不能与 DB_NAME 相同: %s", cfg.Database.DBName)
+	}
+	dbConfig := cfg.Database
+	dbConfig.DBName = cfg.Database.SimulationDBName
+	db, err := database.OpenDatabase(dbConfig)
+	if err != nil {
+		return fmt.Errorf("连接模拟数据库 %s 失败: %v", dbConfig.DBName, err)
+	}
+	database.AutoMigrate(db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := services.RunSimulation(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	middleware.Info("🧪 模拟完成: 链ID=%d, 合约=%s, 最新区块=%d, 入账事件=%d",
+		report.ChainID, report.Contract, report.LatestBlock, report.Events)
+	mismatches := 0
+	for _, account := range report.Accounts {
+		status := "✅"
+		if !account.Match {
+			status = "❌"
+			mismatches++
+		}
+		middleware.Info("%s %s 链上余额=%s, 入账余额=%s, 积分=%.6f",
+			status, account.Address, account.ChainBalance, account.IndexedBalance, account.Points)
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d 个账户的入账余额与链上余额不一致", mismatches)
+	}
+	return nil
+}
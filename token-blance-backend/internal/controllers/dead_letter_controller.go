@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"token-balance/internal/models"
+	"token-balance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeadLetterController 死信管理控制器
+type DeadLetterController struct {
+	deadLetterService *services.DeadLetterService
+}
+
+// NewDeadLetterController 创建死信管理控制器
+func NewDeadLetterController(deadLetterService *services.DeadLetterService) *DeadLetterController {
+	return &DeadLetterController{
+		deadLetterService: deadLetterService,
+	}
+}
+
+// GetDeadLetters 获取入账失败的日志
+// @Summary 死信列表
+// @Description 入账失败的日志，包含原始日志、最后一次错误、重试次数以及首次和最后一次失败时间。存在 pending 死信时该链的同步游标停在它的前一个区块
+// @Tags DeadLetters
+// @Security ApiKeyAuth
+// @Param chain query string false "链名称，为空时返回所有链"
+// @Param status query string false "状态: pending、resolved、discarded，为空时返回所有状态" default(pending)
+// @Param limit query int false "返回数量" default(100)
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/dead-letters [get]
+func (dc *DeadLetterController) GetDeadLetters(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	letters, err := dc.deadLetterService.ListDeadLetters(c.Query("chain"), c.DefaultQuery("status", "pending"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    letters,
+	})
+}
+
+// RetryDeadLetter 立即重试一条死信
+// @Summary 重试死信
+// @Description 不再等待退避间隔，同步器在下一次轮询时从死信所在区块重新处理
+// @Tags DeadLetters
+// @Security ApiKeyAuth
+// @Param id path int true "死信ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Failure 409 {object} models.SwaggerResponse
+// @Router /api/v1/dead-letters/{id}/retry [post]
+func (dc *DeadLetterController) RetryDeadLetter(c *gin.Context) {
+	dc.updateDeadLetter(c, dc.deadLetterService.RetryDeadLetter, "已安排在下一次轮询时重试")
+}
+
+// DiscardDeadLetter 丢弃一条死信
+// @Summary 丢弃死信
+// @Description 跳过这条日志，同步游标可以越过它继续推进。被丢弃的日志不会入账，相关余额需要通过链上余额核对修正
+// @Tags DeadLetters
+// @Security ApiKeyAuth
+// @Param id path int true "死信ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Failure 409 {object} models.SwaggerResponse
+// @Router /api/v1/dead-letters/{id}/discard [post]
+func (dc *DeadLetterController) DiscardDeadLetter(c *gin.Context) {
+	dc.updateDeadLetter(c, dc.deadLetterService.DiscardDeadLetter, "死信已丢弃")
+}
+
+// updateDeadLetter 解析死信ID并执行操作，死信不存在返回404，已处理返回409
+func (dc *DeadLetterController) updateDeadLetter(c *gin.Context, update func(id uint) (*models.DeadLetter, error), message string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的死信ID",
+		})
+		return
+	}
+
+	letter, err := update(uint(id))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrDeadLetterNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrDeadLetterClosed):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    letter,
+	})
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"token-balance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DistributionController 奖励分发控制器
+type DistributionController struct {
+	distributionService *services.DistributionService
+}
+
+// NewDistributionController 创建奖励分发控制器
+func NewDistributionController(distributionService *services.DistributionService) *DistributionController {
+	return &DistributionController{
+		distributionService: distributionService,
+	}
+}
+
+// CreateDistribution 生成奖励分发的 Merkle 树
+// @Summary 生成分发
+// @Description 从余额快照 (source=balance，金额为余额) 或积分 (source=points，按积分占比分配 total_amount) 生成与 OpenZeppelin StandardMerkleTree 兼容的 Merkle 树，保存根和所有叶子
+// @Tags Distributions
+// @Security ApiKeyAuth
+// @Accept json
+// @Param distribution body services.DistributionRequest true "分发参数"
+// @Produce json
+// @Success 201 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/distributions [post]
+func (dc *DistributionController) CreateDistribution(c *gin.Context) {
+	var req services.DistributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	distribution, err := dc.distributionService.CreateDistribution(req)
+	if err != nil {
+		respondDistributionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "分发已生成",
+		"data":    distribution,
+	})
+}
+
+// GetDistributions 获取最近生成的分发
+// @Summary 分发列表
+// @Tags Distributions
+// @Param limit query int false "返回数量" default(20)
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/distributions [get]
+func (dc *DistributionController) GetDistributions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	distributions, err := dc.distributionService.ListDistributions(limit)
+	if err != nil {
+		respondDistributionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    distributions,
+	})
+}
+
+// GetDistribution 获取分发的根和生成参数
+// @Summary 分发详情
+// @Tags Distributions
+// @Param id path int true "分发ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/distributions/{id} [get]
+func (dc *DistributionController) GetDistribution(c *gin.Context) {
+	id, ok := parseDistributionID(c)
+	if !ok {
+		return
+	}
+
+	distribution, err := dc.distributionService.GetDistribution(id)
+	if err != nil {
+		respondDistributionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    distribution,
+	})
+}
+
+// GetDistributionProof 获取地址的领取证明
+// @Summary 领取证明
+// @Description 返回地址的分配金额、叶子哈希和证明，可直接传给合约的 MerkleProof.verify(proof, root, leaf)
+// @Tags Distributions
+// @Param id path int true "分发ID"
+// @Param address path string true "钱包地址"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/distributions/{id}/proof/{address} [get]
+func (dc *DistributionController) GetDistributionProof(c *gin.Context) {
+	id, ok := parseDistributionID(c)
+	if !ok {
+		return
+	}
+
+	proof, err := dc.distributionService.GetProof(id, c.Param("address"))
+	if err != nil {
+		respondDistributionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    proof,
+	})
+}
+
+// parseDistributionID 解析分发ID，无效时返回400
+func parseDistributionID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的分发ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondDistributionError 参数无效返回400，分发、地址或链不存在返回404，其他错误返回500
+func respondDistributionError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidDistribution), errors.Is(err, services.ErrInvalidSnapshot):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrDistributionNotFound), errors.Is(err, services.ErrDistributionLeafNotFound),
+		errors.Is(err, services.ErrChainNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 	"token-balance/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -9,13 +10,15 @@ import (
 
 // EventController 事件控制器
 type EventController struct {
-	eventService *services.EventService
+	eventService    *services.EventService
+	backfillService *services.BackfillService
 }
 
 // NewEventController 创建事件控制器
-func NewEventController(eventService *services.EventService) *EventController {
+func NewEventController(eventService *services.EventService, backfillService *services.BackfillService) *EventController {
 	return &EventController{
-		eventService: eventService,
+		eventService:    eventService,
+		backfillService: backfillService,
 	}
 }
 
@@ -48,25 +51,63 @@ func (ec *EventController) GetRecentEvents(c *gin.Context) {
 }
 
 // SyncEvents 同步事件
-// @Summary 同步区块链事件
-// @Description 手动触发区块链事件同步
+// @Summary 历史事件回填
+// @Description 从合约部署区块开始回填历史事件并重建余额，后台执行，可通过 /events/sync/status 查询进度。中断后再次触发会从同步游标继续
 // @Tags Events
+// @Security ApiKeyAuth
+// @Param chain query string false "链名称" default(sepolia)
+// @Param from_block query int false "起始区块，默认使用配置的部署区块"
+// @Param reset query bool false "清除该链已同步的数据后重新回填" default(false)
 // @Produce json
-// @Success 200 {object} models.SwaggerResponse
+// @Success 202 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
 // @Router /api/v1/events/sync [post]
 func (ec *EventController) SyncEvents(c *gin.Context) {
-	err := ec.eventService.SyncEvents()
+	opts := services.BackfillOptions{
+		ChainName: c.DefaultQuery("chain", "sepolia"),
+		Reset:     c.Query("reset") == "true",
+	}
+	if fromBlock := c.Query("from_block"); fromBlock != "" {
+		value, err := strconv.ParseUint(fromBlock, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的起始区块",
+			})
+			return
+		}
+		opts.FromBlock = value
+	}
+
+	progress, err := ec.backfillService.StartBackfill(opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusAccepted, gin.H{
 		"success": true,
 		"message": "事件同步已启动",
+		"data":    progress,
+	})
+}
+
+// GetSyncStatus 获取历史回填进度
+// @Summary 历史回填进度
+// @Description 获取历史回填的当前区块、完成百分比和预计剩余时间
+// @Tags Events
+// @Security ApiKeyAuth
+// @Param chain query string false "链名称，为空时返回所有链"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/events/sync/status [get]
+func (ec *EventController) GetSyncStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ec.backfillService.GetProgress(c.Query("chain")),
 	})
 }
 
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"token-balance/internal/services"
 	"token-balance/internal/middleware"
@@ -31,12 +32,12 @@ func NewMultiChainController(multiChainService *services.MultiChainService) *Mul
 
 // GetChainStatus 获取所有链的状态
 // @Summary 获取多链状态
-// @Description 获取所有配置链的当前状态和统计信息
+// @Description 获取所有配置链的当前状态和统计信息，包括确认策略和当前的 safe/finalized 高度
 // @Tags multi-chain
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{}
-// @Router /api/v1/chains/status [get]
+// @Router /api/v1/multichain/status [get]
 func (mcc *MultiChainController) GetChainStatus(c *gin.Context) {
 	middleware.Info("📊 获取多链状态请求")
 	
@@ -49,153 +50,401 @@ func (mcc *MultiChainController) GetChainStatus(c *gin.Context) {
 	})
 }
 
-// EnableChain 启用特定链
-// @Summary 启用链
-// @Description 动态启用指定的区块链监听
+// ListChains 获取所有链定义
+// @Summary 链定义列表
+// @Description 获取 chain_definitions 表中的所有链定义 (首次运行时由 .env 中的链配置初始化)
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/multichain/chains [get]
+func (mcc *MultiChainController) ListChains(c *gin.Context) {
+	definitions, err := mcc.multiChainService.ListChainDefinitions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    definitions,
+	})
+}
+
+// GetChain 获取单个链定义
+// @Summary 链定义详情
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/multichain/chains/{chain} [get]
+func (mcc *MultiChainController) GetChain(c *gin.Context) {
+	definition, err := mcc.multiChainService.GetChainDefinition(c.Param("chain"))
+	if err != nil {
+		respondChainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    definition,
+	})
+}
+
+// CreateChain 新增链定义
+// @Summary 新增链
+// @Description 保存链定义 (名称、链ID、RPC端点、合约、确认策略)，启用时立即启动监听
 // @Tags multi-chain
-// @Param chainName path string true "链名称"
+// @Security ApiKeyAuth
 // @Accept json
+// @Param chain body services.ChainDefinitionInput true "链定义"
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Router /api/v1/chains/{chainName}/enable [post]
-func (mcc *MultiChainController) EnableChain(c *gin.Context) {
-	chainName := c.Param("chainName")
-	
-	if chainName == "" {
+// @Success 201 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Router /api/v1/multichain/chains [post]
+func (mcc *MultiChainController) CreateChain(c *gin.Context) {
+	var input services.ChainDefinitionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "链名称不能为空",
+			"message": "无效的请求参数: " + err.Error(),
 		})
 		return
 	}
-	
+
+	definition, err := mcc.multiChainService.CreateChainDefinition(input)
+	if err != nil && definition == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	message := "链定义已保存"
+	if err != nil {
+		message = err.Error()
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": message,
+		"data":    definition,
+	})
+}
+
+// UpdateChain 修改链定义
+// @Summary 修改链
+// @Description 修改链定义，正在运行的链按新定义重启，链名称和链ID不能修改
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Accept json
+// @Param chain path string true "链名称"
+// @Param definition body services.ChainDefinitionInput true "需要修改的字段"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/multichain/chains/{chain} [put]
+func (mcc *MultiChainController) UpdateChain(c *gin.Context) {
+	var input services.ChainDefinitionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	definition, err := mcc.multiChainService.UpdateChainDefinition(c.Param("chain"), input)
+	if err != nil && definition == nil {
+		respondChainError(c, err)
+		return
+	}
+
+	message := "链定义已修改"
+	if err != nil {
+		message = err.Error()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    definition,
+	})
+}
+
+// DeleteChain 删除链定义
+// @Summary 删除链
+// @Description 停止监听并删除链定义，已同步的数据和同步游标保留
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/multichain/chains/{chain} [delete]
+func (mcc *MultiChainController) DeleteChain(c *gin.Context) {
+	chainName := c.Param("chain")
+	if err := mcc.multiChainService.DeleteChainDefinition(chainName); err != nil {
+		respondChainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "链定义已删除",
+		"chain":   chainName,
+	})
+}
+
+// EnableChain 启用特定链
+// @Summary 启用链
+// @Description 启用链定义并立即启动监听，服务重启后也会自动监听
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/multichain/chains/{chain}/enable [post]
+func (mcc *MultiChainController) EnableChain(c *gin.Context) {
+	chainName := c.Param("chain")
 	middleware.Info("🔄 启用链请求: %s", chainName)
-	
-	// TODO: 实现动态启用链的逻辑
-	// 这需要在多链服务中添加相应的管理方法
-	
+
+	if err := mcc.multiChainService.EnableChain(chainName); err != nil {
+		respondChainError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "链启用功能开发中",
+		"message": "链已启用",
 		"chain":   chainName,
 	})
 }
 
 // DisableChain 禁用特定链
 // @Summary 禁用链
-// @Description 动态禁用指定的区块链监听
+// @Description 停止链的监听并禁用链定义，服务重启后不再自动监听
 // @Tags multi-chain
-// @Param chainName path string true "链名称"
-// @Accept json
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
 // @Produce json
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Router /api/v1/chains/{chainName}/disable [post]
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/multichain/chains/{chain}/disable [post]
 func (mcc *MultiChainController) DisableChain(c *gin.Context) {
-	chainName := c.Param("chainName")
-	
-	if chainName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "链名称不能为空",
-		})
+	chainName := c.Param("chain")
+	middleware.Info("⏸️ 禁用链请求: %s", chainName)
+
+	if err := mcc.multiChainService.DisableChain(chainName); err != nil {
+		respondChainError(c, err)
 		return
 	}
-	
-	middleware.Info("⏸️ 禁用链请求: %s", chainName)
-	
-	// TODO: 实现动态禁用链的逻辑
-	
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "链已禁用",
+		"chain":   chainName,
+	})
+}
+
+// StartChain 启动特定链的监听
+// @Summary 启动链监听
+// @Description 启动指定区块链的事件监听，不影响其他链
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/multichain/start/{chain} [post]
+func (mcc *MultiChainController) StartChain(c *gin.Context) {
+	chainName := c.Param("chain")
+	middleware.Info("▶️ 启动链请求: %s", chainName)
+
+	if err := mcc.multiChainService.StartChain(chainName); err != nil {
+		respondChainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "链监听已启动",
+		"chain":   chainName,
+	})
+}
+
+// StopChain 停止特定链的监听
+// @Summary 停止链监听
+// @Description 停止指定区块链的事件监听并等待其退出，不影响其他链
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/multichain/stop/{chain} [post]
+func (mcc *MultiChainController) StopChain(c *gin.Context) {
+	chainName := c.Param("chain")
+	middleware.Info("⏹️ 停止链请求: %s", chainName)
+
+	if err := mcc.multiChainService.StopChain(chainName); err != nil {
+		respondChainError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "链禁用功能开发中",
+		"message": "链监听已停止",
 		"chain":   chainName,
 	})
 }
 
+// RestartChain 重启特定链的监听
+// @Summary 重启链监听
+// @Description 重新读取链定义并重启指定区块链的事件监听，不影响其他链
+// @Tags multi-chain
+// @Security ApiKeyAuth
+// @Param chain path string true "链名称"
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/multichain/restart/{chain} [post]
+func (mcc *MultiChainController) RestartChain(c *gin.Context) {
+	chainName := c.Param("chain")
+	middleware.Info("🔁 重启链请求: %s", chainName)
+
+	if err := mcc.multiChainService.RestartChain(chainName); err != nil {
+		respondChainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "链监听已重启",
+		"chain":   chainName,
+	})
+}
+
+// respondChainError 链不存在返回404，其他错误返回400
+func respondChainError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, services.ErrChainNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
 // GetChainEvents 获取特定链的事件
 // @Summary 获取链事件
-// @Description 获取指定区块链的Transfer事件列表
+// @Description 按 chain_id 过滤事件日志，按区块和日志索引倒序分页返回指定区块链的事件
 // @Tags multi-chain
-// @Param chainName path string true "链名称"
+// @Param chain path string true "链名称"
 // @Param page query string false "页码" default("1")
 // @Param pageSize query string false "每页数量" default("20")
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Router /api/v1/chains/{chainName}/events [get]
+// @Success 200 {object} models.PaginatedData
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/multichain/events/{chain} [get]
 func (mcc *MultiChainController) GetChainEvents(c *gin.Context) {
-	chainName := c.Param("chainName")
+	chainName := c.Param("chain")
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("pageSize", "20")
-	
-	if chainName == "" {
+	if services.StringToInt(page) <= 0 || services.StringToInt(pageSize) <= 0 || services.StringToInt(pageSize) > 100 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "链名称不能为空",
+			"message": "无效的分页参数",
 		})
 		return
 	}
-	
-	middleware.Info("📋 获取链事件: %s (page=%s, size=%s)", chainName, page, pageSize)
-	
-	// TODO: 实现获取特定链事件的逻辑
-	// 这需要查询事件表并过滤特定链
-	
+
+	events, err := mcc.multiChainService.GetChainEvents(chainName, page, pageSize)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrChainNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "链事件查询功能开发中",
-		"chain":   chainName,
-		"page":    page,
-		"pageSize": pageSize,
+		"data":    events,
+	})
+}
+
+// GetReorgReports 获取链重组报告
+// @Summary 获取链重组报告
+// @Description 获取检测到的链重组及回滚情况（深度、被替换区块、受影响用户）
+// @Tags multi-chain
+// @Param chain query string false "链名称"
+// @Param page query string false "页码" default("1")
+// @Param pageSize query string false "每页数量" default("20")
+// @Produce json
+// @Success 200 {object} models.PaginatedData
+// @Router /api/v1/multichain/reorgs [get]
+func (mcc *MultiChainController) GetReorgReports(c *gin.Context) {
+	chainName := c.Query("chain")
+	page := c.DefaultQuery("page", "1")
+	pageSize := c.DefaultQuery("pageSize", "20")
+
+	reports, err := mcc.multiChainService.GetReorgReports(chainName, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reports,
 	})
 }
 
 // HealthCheck 多链健康检查
 // @Summary 多链健康检查
-// @Description 检查所有配置链的连接状态和同步情况
+// @Description 实际测量每条已启用链的 RPC 延迟、已确认高度与已处理区块的差距、距离上次同步成功的时间、连续失败次数以及数据库连接，按 HEALTH_* 阈值给出 healthy/degraded/down
 // @Tags multi-chain
-// @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Router /api/v1/chains/health [get]
+// @Success 200 {object} services.HealthReport
+// @Router /api/v1/multichain/health [get]
 func (mcc *MultiChainController) HealthCheck(c *gin.Context) {
-	middleware.Info("🏥 多链健康检查")
-	
-	// TODO: 实现详细的多链健康检查
-	// - 检查RPC连接状态
-	// - 检查区块同步延迟
-	// - 检查事件处理队列
-	// - 检查数据库连接状态
-	
-	health := gin.H{
-		"overall_status": "healthy",
-		"chains": []gin.H{
-			{
-				"name":    "sepolia",
-				"status":  "healthy",
-				"latency": "150ms",
-				"block_delay": 2,
-			},
-			{
-				"name":    "base-sepolia",
-				"status":  "disabled",
-				"latency": "N/A",
-				"block_delay": "N/A",
-			},
-		},
-		"checks": gin.H{
-			"database": "healthy",
-			"rpc_connections": "healthy",
-			"event_processing": "healthy",
-		},
-	}
-	
+	report := mcc.multiChainService.HealthCheck(c.Request.Context())
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    health,
-		"timestamp": "2025-11-28T21:00:00Z",
+		"data":    report,
 	})
-}
\ No newline at end of file
+}
+
+// Readiness 就绪探针
+// @Summary 就绪探针
+// @Description 与多链健康检查相同的检查，状态为 healthy 或 degraded 时返回200，down 时返回503
+// @Tags multi-chain
+// @Produce json
+// @Success 200 {object} services.HealthReport
+// @Failure 503 {object} services.HealthReport
+// @Router /ready [get]
+func (mcc *MultiChainController) Readiness(c *gin.Context) {
+	report := mcc.multiChainService.HealthCheck(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.IsReady() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"token-balance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReconciliationController 链上余额核对控制器
+type ReconciliationController struct {
+	reconciliationService *services.ReconciliationService
+}
+
+// NewReconciliationController 创建链上余额核对控制器
+func NewReconciliationController(reconciliationService *services.ReconciliationService) *ReconciliationController {
+	return &ReconciliationController{
+		reconciliationService: reconciliationService,
+	}
+}
+
+// RunReconciliation 立即执行一轮链上余额核对
+// @Summary 执行链上余额核对
+// @Description 在每条链的同步游标所在区块调用 balanceOf，与索引余额对比，不一致时记录 onchain_balance_mismatch 一致性问题。fix 为 true 时按链上余额修正并写入 reconciliation 余额历史。请求体为空时使用 RECONCILE_* 配置
+// @Tags Reconciliation
+// @Security ApiKeyAuth
+// @Accept json
+// @Param options body services.ReconcileOptions false "核对参数"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Failure 409 {object} models.SwaggerResponse
+// @Router /api/v1/reconciliation/run [post]
+func (rc *ReconciliationController) RunReconciliation(c *gin.Context) {
+	var opts services.ReconcileOptions
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求参数: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	reports, err := rc.reconciliationService.Reconcile(c.Request.Context(), opts)
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "链上余额核对完成",
+		"data":    reports,
+	})
+}
+
+// GetReconciliationReports 获取每条链最近一轮的核对结果
+// @Summary 最近的核对结果
+// @Tags Reconciliation
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/reconciliation/reports [get]
+func (rc *ReconciliationController) GetReconciliationReports(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rc.reconciliationService.LastReports(),
+	})
+}
+
+// RunSupplyCheck 立即核对代币供应量
+// @Summary 执行供应量核对
+// @Description 在每条链的同步游标所在区块读取 totalSupply() 和 MAX_SUPPLY()，与持有人余额之和精确比较。不变量被破坏时记录 critical 一致性问题并发送告警
+// @Tags Reconciliation
+// @Security ApiKeyAuth
+// @Param chain query string false "链名称，为空时核对所有已启用的链"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Failure 409 {object} models.SwaggerResponse
+// @Router /api/v1/reconciliation/supply [post]
+func (rc *ReconciliationController) RunSupplyCheck(c *gin.Context) {
+	checks, err := rc.reconciliationService.CheckSupply(c.Request.Context(), c.Query("chain"))
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "供应量核对完成",
+		"data":    checks,
+	})
+}
+
+// GetSupplyChecks 获取每个代币最近一次的供应量核对结果
+// @Summary 最近的供应量核对结果
+// @Tags Reconciliation
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/reconciliation/supply [get]
+func (rc *ReconciliationController) GetSupplyChecks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rc.reconciliationService.LastSupplyChecks(),
+	})
+}
+
+// GetReconciliationIssues 获取链上核对发现的问题
+// @Summary 链上核对问题列表
+// @Description 持有人余额与链上 balanceOf 不符 (onchain_balance_mismatch) 以及供应量不变量被破坏 (supply_mismatch、supply_exceeds_max) 的一致性问题
+// @Tags Reconciliation
+// @Security ApiKeyAuth
+// @Param type query string false "问题类型，为空时返回所有核对问题"
+// @Param status query string false "状态: open、fixed，为空时返回所有状态" default(open)
+// @Param limit query int false "返回数量" default(100)
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/reconciliation/issues [get]
+func (rc *ReconciliationController) GetReconciliationIssues(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	issues, err := rc.reconciliationService.ListIssues(c.Query("type"), c.DefaultQuery("status", "open"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    issues,
+	})
+}
+
+// FixReconciliationIssue 按链上余额修正一个不一致
+// @Summary 修正链上余额不一致
+// @Description 按问题中记录的链上余额修正持仓，写入 TxHash 为 reconciliation-{id} 的余额历史。持仓在核对之后有变动时拒绝修正，需要重新核对
+// @Tags Reconciliation
+// @Security ApiKeyAuth
+// @Param id path int true "问题ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Router /api/v1/reconciliation/issues/{id}/fix [post]
+func (rc *ReconciliationController) FixReconciliationIssue(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的问题ID",
+		})
+		return
+	}
+
+	issue, err := rc.reconciliationService.FixIssue(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已按链上余额修正",
+		"data":    issue,
+	})
+}
+
+// respondReconciliationError 核对正在进行返回409，链不存在返回404，其他错误返回500
+func respondReconciliationError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrReconciliationRunning):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrChainNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"token-balance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReplayController 派生数据回放控制器
+type ReplayController struct {
+	replayService *services.ReplayService
+}
+
+// NewReplayController 创建派生数据回放控制器
+func NewReplayController(replayService *services.ReplayService) *ReplayController {
+	return &ReplayController{
+		replayService: replayService,
+	}
+}
+
+// RunReplay 在后台从原始日志重建派生数据
+// @Summary 回放原始日志
+// @Description 在后台启动回放：不访问 RPC，按 (区块, 日志索引) 顺序回放 raw_logs，把用户余额、余额历史、持仓和每日汇总重建到 *_replay 影子表并与线上表对比。swap 为 true 时随后替换线上数据。立即返回202，进度、差异和错误通过 /api/v1/replay/report 查询
+// @Tags Replay
+// @Security ApiKeyAuth
+// @Accept json
+// @Param options body services.ReplayOptions false "回放参数"
+// @Produce json
+// @Success 202 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Failure 409 {object} models.SwaggerResponse
+// @Router /api/v1/replay/run [post]
+func (rc *ReplayController) RunReplay(c *gin.Context) {
+	var opts services.ReplayOptions
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求参数: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	report, err := rc.replayService.StartReplay(opts)
+	if err != nil {
+		respondReplayError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "回放已启动",
+		"data":    report,
+	})
+}
+
+// GetReplayReport 获取最近一次回放的进度、结果和差异
+// @Summary 最近的回放结果
+// @Description status 为 running 时回放仍在进行，completed 时可以交换，failed 时 error 为失败原因
+// @Tags Replay
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/replay/report [get]
+func (rc *ReplayController) GetReplayReport(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rc.replayService.LastReport(),
+	})
+}
+
+// SwapReplay 用最近一次回放的结果替换线上数据
+// @Summary 替换线上数据
+// @Description 先追赶回放之后新同步的日志，再在一个事务中锁定同步游标，追赶剩余的日志并用影子表替换线上的用户余额、余额历史、持仓和每日汇总。回放之后发生过链重组、余额修正或死信丢弃时返回409，需要重新回放
+// @Tags Replay
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Failure 409 {object} models.SwaggerResponse
+// @Router /api/v1/replay/swap [post]
+func (rc *ReplayController) SwapReplay(c *gin.Context) {
+	report, err := rc.replayService.Swap(c.Request.Context())
+	if err != nil {
+		respondReplayError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已用回放结果替换线上数据",
+		"data":    report,
+	})
+}
+
+// respondReplayError 正在回放或结果过期返回409，没有回放结果返回404，其他错误返回500
+func respondReplayError(c *gin.Context, err error, report *services.ReplayReport) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrReplayRunning), errors.Is(err, services.ErrReplayStale):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrReplayNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+		"data":    report,
+	})
+}
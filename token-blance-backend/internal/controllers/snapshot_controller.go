@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"token-balance/internal/middleware"
+	"token-balance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotFlushRows 流式输出快照时每写多少行刷新一次
+const snapshotFlushRows = 500
+
+// SnapshotController 历史余额快照控制器
+type SnapshotController struct {
+	snapshotService *services.SnapshotService
+}
+
+// NewSnapshotController 创建历史余额快照控制器
+func NewSnapshotController(snapshotService *services.SnapshotService) *SnapshotController {
+	return &SnapshotController{
+		snapshotService: snapshotService,
+	}
+}
+
+// GetBalanceSnapshot 获取某个区块或时间点所有持有人的余额
+// @Summary 历史余额快照
+// @Description 根据余额历史计算每个持有人在区块 block 结束时或 timestamp 时的余额 (block 和 timestamp 二选一，按区块号快照时必须指定 chain)。结果按 (链, 代币, 地址) 排序流式返回，format=csv 时返回 CSV
+// @Tags Snapshots
+// @Param chain query string false "链名称"
+// @Param token query string false "代币合约地址"
+// @Param block query int false "区块号"
+// @Param timestamp query string false "时间点，RFC3339 或 Unix 秒"
+// @Param min_balance query string false "最低余额，按代币精度换算后的数量"
+// @Param format query string false "输出格式: json、csv" default(json)
+// @Produce json
+// @Produce text/csv
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/snapshots/balances [get]
+func (sc *SnapshotController) GetBalanceSnapshot(c *gin.Context) {
+	opts := services.SnapshotOptions{
+		Chain:      c.Query("chain"),
+		Token:      c.Query("token"),
+		MinBalance: c.Query("min_balance"),
+	}
+	if block := c.Query("block"); block != "" {
+		blockNumber, err := strconv.ParseUint(block, 10, 64)
+		if err != nil {
+			respondSnapshotError(c, fmt.Errorf("%w: 无效的区块号 %s", services.ErrInvalidSnapshot, block))
+			return
+		}
+		opts.BlockNumber = blockNumber
+	}
+	if timestamp := c.Query("timestamp"); timestamp != "" {
+		at, err := services.ParseSnapshotTime(timestamp)
+		if err != nil {
+			respondSnapshotError(c, err)
+			return
+		}
+		opts.Timestamp = at
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		respondSnapshotError(c, fmt.Errorf("%w: format 只支持 json 和 csv", services.ErrInvalidSnapshot))
+		return
+	}
+
+	snapshot, err := sc.snapshotService.PrepareSnapshot(opts)
+	if err != nil {
+		respondSnapshotError(c, err)
+		return
+	}
+
+	// 开始输出后无法再修改状态码，中途失败时只记录日志并截断响应
+	if format == "csv" {
+		err = streamSnapshotCSV(c, snapshot)
+	} else {
+		err = streamSnapshotJSON(c, snapshot)
+	}
+	if err != nil {
+		middleware.Error("输出余额快照失败: %v", err)
+	}
+}
+
+// streamSnapshotCSV 以 CSV 流式输出快照
+func streamSnapshotCSV(c *gin.Context, snapshot *services.Snapshot) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="balance_snapshot.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(services.SnapshotCSVHeader); err != nil {
+		return err
+	}
+	rows := 0
+	err := snapshot.Each(func(entry services.SnapshotEntry) error {
+		if err := writer.Write(entry.CSVRecord()); err != nil {
+			return err
+		}
+		if rows++; rows%snapshotFlushRows == 0 {
+			writer.Flush()
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// streamSnapshotJSON 以 {"success":true,"data":[...]} 流式输出快照
+func streamSnapshotJSON(c *gin.Context, snapshot *services.Snapshot) error {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if _, err := c.Writer.WriteString(`{"success":true,"data":[`); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(c.Writer)
+	rows := 0
+	err := snapshot.Each(func(entry services.SnapshotEntry) error {
+		if rows > 0 {
+			if _, err := c.Writer.WriteString(","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+		if rows++; rows%snapshotFlushRows == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.WriteString("]}\n")
+	return err
+}
+
+// respondSnapshotError 参数无效返回400，链不存在返回404，其他错误返回500
+func respondSnapshotError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidSnapshot):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrChainNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"token-balance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenController 代币登记控制器
+type TokenController struct {
+	tokenService *services.TokenService
+}
+
+// NewTokenController 创建代币登记控制器
+func NewTokenController(tokenService *services.TokenService) *TokenController {
+	return &TokenController{
+		tokenService: tokenService,
+	}
+}
+
+// ListTokens 获取已登记的代币
+// @Summary 代币列表
+// @Description 获取已登记的代币合约，索引器只处理已启用的代币
+// @Tags Tokens
+// @Param chain query string false "链名称，为空时返回所有链"
+// @Param enabled query bool false "只返回已启用的代币" default(false)
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Router /api/v1/tokens [get]
+func (tc *TokenController) ListTokens(c *gin.Context) {
+	tokens, err := tc.tokenService.ListTokens(c.Query("chain"), c.Query("enabled") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tokens,
+	})
+}
+
+// GetToken 获取单个代币
+// @Summary 代币详情
+// @Tags Tokens
+// @Param id path int true "代币ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/tokens/{id} [get]
+func (tc *TokenController) GetToken(c *gin.Context) {
+	id, ok := tokenID(c)
+	if !ok {
+		return
+	}
+
+	token, err := tc.tokenService.GetToken(id)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    token,
+	})
+}
+
+// CreateToken 登记代币
+// @Summary 登记代币
+// @Description 登记一个代币合约，索引器从链的同步游标之后开始处理它的 Transfer 事件。起始区块早于游标时需要重新回填 (reset) 才能补齐历史
+// @Tags Tokens
+// @Security ApiKeyAuth
+// @Accept json
+// @Param token body services.TokenInput true "代币信息"
+// @Produce json
+// @Success 201 {object} models.SwaggerResponse
+// @Failure 400 {object} models.SwaggerResponse
+// @Router /api/v1/tokens [post]
+func (tc *TokenController) CreateToken(c *gin.Context) {
+	var input services.TokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	token, err := tc.tokenService.CreateToken(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	message := "代币登记成功"
+	if pending, lastBlock, err := tc.tokenService.PendingHistory(token); err == nil && pending {
+		message = fmt.Sprintf("代币登记成功，链 %s 已同步到区块 %d，区块 %d - %d 的历史事件需要重新回填 (POST /api/v1/events/sync?chain=%s&reset=true)",
+			token.ChainName, lastBlock, token.StartBlock, lastBlock, token.ChainName)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": message,
+		"data":    token,
+	})
+}
+
+// UpdateToken 修改代币
+// @Summary 修改代币
+// @Description 修改代币的符号、精度、起始区块或启用状态，链和地址不能修改
+// @Tags Tokens
+// @Security ApiKeyAuth
+// @Accept json
+// @Param id path int true "代币ID"
+// @Param token body services.TokenInput true "需要修改的字段"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/tokens/{id} [put]
+func (tc *TokenController) UpdateToken(c *gin.Context) {
+	id, ok := tokenID(c)
+	if !ok {
+		return
+	}
+
+	var input services.TokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	token, err := tc.tokenService.UpdateToken(id, input)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "代币修改成功",
+		"data":    token,
+	})
+}
+
+// DeleteToken 删除代币登记
+// @Summary 删除代币登记
+// @Description 删除后索引器不再处理该代币，已入账的事件和余额历史保留
+// @Tags Tokens
+// @Security ApiKeyAuth
+// @Param id path int true "代币ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/tokens/{id} [delete]
+func (tc *TokenController) DeleteToken(c *gin.Context) {
+	id, ok := tokenID(c)
+	if !ok {
+		return
+	}
+
+	if err := tc.tokenService.DeleteToken(id); err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "代币登记已删除",
+	})
+}
+
+// RefreshTokenMetadata 重新读取代币元数据
+// @Summary 刷新代币元数据
+// @Description 调用合约的 decimals()、symbol()、name() 和 getContractInfo()，更新代币的精度、名称、最大供应量和所有者。登记时填写的符号保留
+// @Tags Tokens
+// @Security ApiKeyAuth
+// @Param id path int true "代币ID"
+// @Produce json
+// @Success 200 {object} models.SwaggerResponse
+// @Failure 404 {object} models.SwaggerResponse
+// @Router /api/v1/tokens/{id}/metadata [post]
+func (tc *TokenController) RefreshTokenMetadata(c *gin.Context) {
+	id, ok := tokenID(c)
+	if !ok {
+		return
+	}
+
+	token, err := tc.tokenService.RefreshMetadata(c.Request.Context(), id)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "代币元数据已更新",
+		"data":    token,
+	})
+}
+
+// tokenID 解析路径中的代币ID，无效时直接返回400
+func tokenID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的代币ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondTokenError 代币不存在返回404，其他错误返回500
+func respondTokenError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrTokenNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
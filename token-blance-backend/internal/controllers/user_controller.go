@@ -21,11 +21,13 @@ func NewUserController(userService *services.UserService) *UserController {
 
 // GetUserBalance 获取用户余额
 // @Summary 获取用户余额
-// @Description 根据用户地址获取当前余额和总积分
+// @Description 根据用户地址获取各链各代币的持仓和总积分，可按链和代币过滤
 // @Tags User
 // @Param address path string true "用户地址"
+// @Param chain query string false "链名称或链ID"
+// @Param token query string false "代币合约地址或代币符号"
 // @Produce json
-// @Success 200 {object} models.User
+// @Success 200 {object} services.UserBalance
 // @Router /api/v1/users/{address} [get]
 func (uc *UserController) GetUserBalance(c *gin.Context) {
 	address := c.Param("address")
@@ -37,7 +39,7 @@ func (uc *UserController) GetUserBalance(c *gin.Context) {
 		return
 	}
 
-	user, err := uc.userService.GetUserByAddress(address)
+	balance, err := uc.userService.GetUserBalance(address, balanceFilter(c))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -48,7 +50,41 @@ func (uc *UserController) GetUserBalance(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    user,
+		"data":    balance,
+	})
+}
+
+// GetUserAssets 获取用户跨链资产汇总
+// @Summary 获取用户跨链资产汇总
+// @Description 按代币符号把同一资产在各链上的持仓相加，各链精度不同时换算到最大精度
+// @Tags User
+// @Param address path string true "用户地址"
+// @Param token query string false "代币合约地址或代币符号"
+// @Produce json
+// @Success 200 {object} []services.AssetBalance
+// @Router /api/v1/users/{address}/assets [get]
+func (uc *UserController) GetUserAssets(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "用户地址不能为空",
+		})
+		return
+	}
+
+	assets, err := uc.userService.GetUserAssets(address, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    assets,
 	})
 }
 
@@ -57,6 +93,8 @@ func (uc *UserController) GetUserBalance(c *gin.Context) {
 // @Description 获取指定用户的余额变动记录
 // @Tags User
 // @Param address path string true "用户地址"
+// @Param chain query string false "链名称或链ID"
+// @Param token query string false "代币合约地址或代币符号"
 // @Param page query int false "页码" default(1)
 // @Param pageSize query int false "每页数量" default(20)
 // @Produce json
@@ -67,7 +105,7 @@ func (uc *UserController) GetUserBalanceHistory(c *gin.Context) {
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("pageSize", "20")
 
-	history, err := uc.userService.GetUserBalanceHistory(address, page, pageSize)
+	history, err := uc.userService.GetUserBalanceHistory(address, page, pageSize, balanceFilter(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -114,3 +152,11 @@ func (uc *UserController) GetUserPoints(c *gin.Context) {
 		"data":    points,
 	})
 }
+
+// balanceFilter 读取查询参数中的链和代币过滤条件
+func balanceFilter(c *gin.Context) services.BalanceFilter {
+	return services.BalanceFilter{
+		Chain: c.Query("chain"),
+		Token: c.Query("token"),
+	}
+}
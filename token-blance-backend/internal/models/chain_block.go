@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// ChainBlock 已处理区块表
+//
+// 记录已处理区块的哈希，用于在每次轮询时比对父哈希、检测链重组。
+// 游标所在区块会同时记录父哈希；包含事件的区块只记录区块哈希。
+// BlockTime 缓存区块的链上时间戳，事件和余额历史使用它而不是处理时的本地时间。
+type ChainBlock struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChainID     int64      `gorm:"not null;uniqueIndex:idx_chain_block" json:"chain_id"`
+	BlockNumber uint64     `gorm:"not null;uniqueIndex:idx_chain_block" json:"block_number"`
+	BlockHash   string     `gorm:"type:varchar(66);not null" json:"block_hash"`
+	ParentHash  string     `gorm:"type:varchar(66)" json:"parent_hash"`
+	BlockTime   *time.Time `json:"block_time"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ChainBlock) TableName() string {
+	return "chain_blocks"
+}
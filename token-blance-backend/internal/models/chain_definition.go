@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// ChainDefinition 链定义表
+//
+// 多链服务从这张表读取要监听的链，可以通过管理接口在运行时增删改并单独启停。
+// 首次启动时用 .env 中的链配置 (SEPOLIA_*, BASE_SEPOLIA_*) 初始化，之后以表中的定义为准。
+// Contracts 中的合约在链启动时自动登记到代币表。
+type ChainDefinition struct {
+	ID                 uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name               string    `gorm:"type:varchar(50);not null;uniqueIndex" json:"name"` // 链名称，同步游标使用它 (sepolia)
+	DisplayName        string    `gorm:"type:varchar(100)" json:"display_name"`             // 显示名称 (Sepolia)
+	ChainID            int64     `gorm:"not null;uniqueIndex" json:"chain_id"`
+	RPCURLs            []string  `gorm:"type:text;serializer:json" json:"rpc_urls"`  // 所有RPC端点，按健康度自动切换
+	WSURL              string    `gorm:"type:varchar(255)" json:"ws_url"`            // WebSocket端点 (可选)
+	Contracts          []string  `gorm:"type:text;serializer:json" json:"contracts"` // 代币合约地址
+	StartBlock         uint64    `gorm:"not null;default:0" json:"start_block"`      // 合约部署区块
+	Finality           string    `gorm:"type:varchar(20);not null" json:"finality"`  // 确认策略: depth、safe 或 finalized
+	ConfirmationBlocks uint64    `gorm:"not null" json:"confirmation_blocks"`        // depth 策略的确认区块数
+	Enabled            bool      `gorm:"not null" json:"enabled"`                    // 服务启动时是否自动监听
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ChainDefinition) TableName() string {
+	return "chain_definitions"
+}
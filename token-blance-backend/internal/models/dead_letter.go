@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// DeadLetter 死信日志表
+//
+// 记录入账失败的日志 (例如会导致负余额的转账)，保存原始日志、最后一次错误、重试次数和首次/最后一次失败时间。
+// 存在未处理 (pending) 的死信时同步游标停在它的前一个区块，按 NextRetryAt 自动重试；
+// 重试成功后标记为 resolved，管理员丢弃 (discarded) 后游标才会越过它。
+type DeadLetter struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChainID       int64      `gorm:"not null;uniqueIndex:idx_dead_letter_log;index:idx_dead_letter_status" json:"chain_id"`
+	ChainName     string     `gorm:"type:varchar(50);not null" json:"chain_name"`
+	TxHash        string     `gorm:"type:varchar(66);not null;uniqueIndex:idx_dead_letter_log" json:"tx_hash"`
+	LogIndex      uint       `gorm:"not null;uniqueIndex:idx_dead_letter_log" json:"log_index"`
+	BlockNumber   uint64     `gorm:"not null;index:idx_dead_letter_status" json:"block_number"`
+	TokenAddress  string     `gorm:"type:varchar(42)" json:"token_address"`
+	RawLog        string     `gorm:"type:text;not null" json:"raw_log"` // types.Log 的 JSON
+	Error         string     `gorm:"type:text" json:"error"`            // 最后一次失败的错误
+	Attempts      int        `gorm:"not null;default:1" json:"attempts"`
+	Status        string     `gorm:"type:enum('pending','resolved','discarded');default:'pending';index:idx_dead_letter_status" json:"status"`
+	FirstFailedAt time.Time  `json:"first_failed_at"`
+	LastFailedAt  time.Time  `json:"last_failed_at"`
+	NextRetryAt   time.Time  `json:"next_retry_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DeadLetter) TableName() string {
+	return "dead_letter_logs"
+}
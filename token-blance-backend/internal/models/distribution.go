@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// Distribution 奖励分发的 Merkle 树
+//
+// 叶子与 OpenZeppelin StandardMerkleTree 的 ["address", "uint256"] 一致：
+// keccak256(bytes.concat(keccak256(abi.encode(address, amount))))，父节点对两个子节点排序后拼接哈希，
+// 合约可以直接用 MerkleProof.verify 校验。树生成后不再修改。
+type Distribution struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string    `gorm:"type:varchar(100);not null" json:"name"`
+	Source      string    `gorm:"type:enum('balance','points');not null" json:"source"` // balance: 余额快照, points: 按积分分配
+	Params      string    `gorm:"type:text" json:"params"`                              // 生成参数 (JSON)
+	Root        string    `gorm:"type:varchar(66);not null" json:"root"`
+	LeafCount   int       `gorm:"not null" json:"leaf_count"`
+	TotalAmount string    `gorm:"type:varchar(78);not null" json:"total_amount"` // 所有叶子金额之和 (最小单位)
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (Distribution) TableName() string {
+	return "distributions"
+}
+
+// DistributionLeaf Merkle 树的叶子，保存该地址的证明
+type DistributionLeaf struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	DistributionID uint   `gorm:"not null;uniqueIndex:idx_distribution_leaf,priority:1" json:"distribution_id"`
+	Address        string `gorm:"type:varchar(42);not null;uniqueIndex:idx_distribution_leaf,priority:2" json:"address"`
+	Amount         string `gorm:"type:varchar(78);not null" json:"amount"` // 最小单位
+	TreeIndex      int    `gorm:"not null" json:"tree_index"`              // 在树数组中的位置，与 StandardMerkleTree.dump() 一致
+	Hash           string `gorm:"type:varchar(66);not null" json:"hash"`
+	Proof          string `gorm:"type:text;not null" json:"-"` // 证明 (JSON 数组)
+}
+
+// TableName 指定表名
+func (DistributionLeaf) TableName() string {
+	return "distribution_leaves"
+}
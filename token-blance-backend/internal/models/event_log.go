@@ -5,14 +5,21 @@ import (
 )
 
 // EventLog 事件日志表
+//
+// 每条日志由 (chain_id, tx_hash, log_index) 唯一标识，同一笔交易中的多条
+// Transfer 日志（例如 batchMint）各自独立存储，重复处理同一日志不会重复入库。
 type EventLog struct {
 	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	EventName       string    `gorm:"type:varchar(50);not null;index" json:"event_name"`
 	UserAddress     string    `gorm:"type:varchar(42);not null;index" json:"user_address"`
 	ContractAddress string    `gorm:"type:varchar(42);not null;index" json:"contract_address"`
 	Amount          string    `gorm:"type:varchar(78);not null" json:"amount"`
-	TxHash          string    `gorm:"type:varchar(66);not null;uniqueIndex" json:"tx_hash"`
+	AmountFormatted string    `gorm:"-" json:"amount_formatted"` // 按代币精度换算后的金额，只在接口返回时填写
+	TxHash          string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_event_identity,priority:2;index:idx_event_logs_tx" json:"tx_hash"`
+	LogIndex        uint      `gorm:"not null;default:0;uniqueIndex:idx_event_identity,priority:3" json:"log_index"`
 	BlockNumber     uint64    `gorm:"not null;index" json:"block_number"`
+	BlockHash       string    `gorm:"type:varchar(66);index" json:"block_hash"`
+	ChainID         int64     `gorm:"not null;default:0;index;uniqueIndex:idx_event_identity,priority:1" json:"chain_id"`
 	Timestamp       time.Time `gorm:"not null;index" json:"timestamp"`
 	Data            string    `gorm:"type:text" json:"data"`
 	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
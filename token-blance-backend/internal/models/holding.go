@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Holding 用户持仓表
+//
+// 每个 (chain_id, token_address, user_address) 一行，保存该地址在这条链上这个代币的
+// 当前余额，与余额历史在同一事务中更新。同一地址在不同链、不同代币上的余额互不影响；
+// 跨链汇总按代币符号把同一资产在各链上的持仓相加。
+type Holding struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	ChainID          int64     `gorm:"not null;uniqueIndex:idx_holding_scope,priority:1" json:"chain_id"`
+	TokenAddress     string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_holding_scope,priority:2" json:"token_address"`
+	UserAddress      string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_holding_scope,priority:3;index" json:"user_address"`
+	Balance          string    `gorm:"type:varchar(78);not null;default:'0'" json:"balance"` // 当前余额 (最小单位，字符串形式)
+	BlockNumber      uint64    `gorm:"not null;default:0" json:"block_number"`               // 最后一次变动所在区块
+	BalanceFormatted string    `gorm:"-" json:"balance_formatted"`                           // 按代币精度换算后的余额，只在接口返回时填写
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Holding) TableName() string {
+	return "holdings"
+}
@@ -1,11 +1,13 @@
 package models
 
 // LeaderboardEntry 积分排行榜条目
+//
+// 不同代币的余额不能相加，余额按 (链, 代币) 列在 Holdings 中。
 type LeaderboardEntry struct {
-	Rank        int     `json:"rank"`
-	Address     string  `json:"address"`
-	Balance     string  `json:"balance"`
-	TotalPoints float64 `json:"total_points"`
+	Rank        int       `json:"rank"`
+	Address     string    `json:"address"`
+	TotalPoints float64   `json:"total_points"`
+	Holdings    []Holding `json:"holdings"` // 各链各代币的持仓
 }
 
 // DailyStats 每日统计数据
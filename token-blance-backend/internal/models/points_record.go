@@ -5,11 +5,16 @@ import (
 )
 
 // PointsRecord 积分记录表
+//
+// 积分按 (chain_id, token_address, user_address) 分别计算，Balance 为该代币的余额。
 type PointsRecord struct {
 	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserAddress    string    `gorm:"type:varchar(42);not null;index" json:"user_address"`
+	UserAddress    string    `gorm:"type:varchar(42);not null;index;index:idx_points_scope,priority:3" json:"user_address"`
+	ChainID        int64     `gorm:"not null;default:0;index:idx_points_scope,priority:1" json:"chain_id"`
+	TokenAddress   string    `gorm:"type:varchar(42);not null;default:'';index:idx_points_scope,priority:2" json:"token_address"`
 	Points         float64   `gorm:"type:decimal(20,8);not null" json:"points"`
 	Balance        string    `gorm:"type:varchar(78);not null" json:"balance"`
+	BalanceFormatted string  `gorm:"-" json:"balance_formatted"` // 按代币精度换算后的余额，只在接口返回时填写
 	Hours          float64   `gorm:"type:decimal(10,4);not null" json:"hours"`
 	Rate           float64   `gorm:"type:decimal(10,8);not null;default:0.05000000" json:"rate"`
 	CalculateDate  time.Time `gorm:"not null;index" json:"calculate_date"`
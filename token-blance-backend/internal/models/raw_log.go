@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// RawLog 原始日志归档表
+//
+// 原样保存 FilterLogs 返回的 types.Log 的每个字段以及链ID，之后可以不再查询 RPC 就重新推导任何数据。
+// Topic0~Topic3 按顺序保存日志的 topics (EVM 日志最多 4 个)，不存在的为空；Data 为 0x 开头的十六进制。
+// Transfer 日志解码后的发送方、接收方和金额保存在单独的列中，其他日志为空。
+// 日志按 (链ID, 区块哈希, 日志索引) 识别；链重组回滚的日志不删除，Removed 标记为 true，
+// 同一笔交易被重新打包后以新的区块哈希另存一行。
+type RawLog struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChainID     int64  `gorm:"not null;uniqueIndex:idx_raw_log_block_identity,priority:1;index:idx_raw_log_tx,priority:1;index:idx_raw_log_position,priority:1" json:"chain_id"`
+	Address     string `gorm:"type:varchar(42);not null;index" json:"address"` // 发出日志的合约
+	Topic0      string `gorm:"type:varchar(66);index" json:"topic0"`           // 事件签名
+	Topic1      string `gorm:"type:varchar(66)" json:"topic1"`
+	Topic2      string `gorm:"type:varchar(66)" json:"topic2"`
+	Topic3      string `gorm:"type:varchar(66)" json:"topic3"`
+	Data        string `gorm:"type:mediumtext" json:"data"`
+	BlockNumber uint64 `gorm:"not null;index:idx_raw_log_position,priority:2" json:"block_number"`
+	TxHash      string `gorm:"type:varchar(66);not null;index:idx_raw_log_tx,priority:2" json:"tx_hash"`
+	TxIndex     uint   `gorm:"not null" json:"tx_index"`
+	BlockHash   string `gorm:"type:varchar(66);not null;uniqueIndex:idx_raw_log_block_identity,priority:2" json:"block_hash"`
+	LogIndex    uint   `gorm:"not null;uniqueIndex:idx_raw_log_block_identity,priority:3;index:idx_raw_log_tx,priority:3;index:idx_raw_log_position,priority:3" json:"log_index"`
+	Removed     bool   `gorm:"not null;default:false" json:"removed"` // 链重组后已不在规范链上
+
+	// 解码后的字段
+	EventName   string     `gorm:"type:varchar(50);index" json:"event_name"`
+	FromAddress string     `gorm:"type:varchar(42);index" json:"from_address"`
+	ToAddress   string     `gorm:"type:varchar(42);index" json:"to_address"`
+	Amount      string     `gorm:"type:varchar(78)" json:"amount"`
+	BlockTime   *time.Time `json:"block_time"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (RawLog) TableName() string {
+	return "raw_logs"
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// ReorgReport 链重组报告
+//
+// 每次检测到超过确认窗口的链重组并完成回滚后记录一条报告。
+type ReorgReport struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChainName        string    `gorm:"type:varchar(50);not null;index" json:"chain_name"`
+	ChainID          int64     `gorm:"not null" json:"chain_id"`
+	CommonAncestor   uint64    `gorm:"not null" json:"common_ancestor"`                  // 新旧链的共同祖先区块
+	Depth            uint64    `gorm:"not null" json:"depth"`                            // 回滚深度 (区块数)
+	OldHeadHash      string    `gorm:"type:varchar(66)" json:"old_head_hash"`            // 回滚前游标区块哈希
+	NewHeadHash      string    `gorm:"type:varchar(66)" json:"new_head_hash"`            // 新链上同高度区块哈希
+	BlocksReplaced   []uint64  `gorm:"type:text;serializer:json" json:"blocks_replaced"` // 被替换的已记录区块
+	EventsRemoved    int64     `gorm:"default:0" json:"events_removed"`                  // 删除的事件数
+	UsersAffected    []string  `gorm:"type:text;serializer:json" json:"users_affected"`  // 余额被回滚的用户
+	PointsRemoved    int64     `gorm:"default:0" json:"points_removed"`                  // 按被回滚余额计算、已失效删除的积分记录数
+	SummariesRemoved int64     `gorm:"default:0" json:"summaries_removed"`               // 已失效删除的每日汇总数
+	DetectedAt       time.Time `gorm:"not null;index" json:"detected_at"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ReorgReport) TableName() string {
+	return "reorg_reports"
+}
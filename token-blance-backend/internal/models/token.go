@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Token 代币登记表
+//
+// 索引器只处理已登记且启用的代币合约的 Transfer 日志，余额历史、事件日志和积分
+// 记录都带有代币地址，不同代币的余额不会混在一起。同一地址在不同链上是不同的代币，
+// 由 (chain_id, address) 唯一标识；地址统一使用 EIP-55 校验和格式存储。
+// 精度、名称和最大供应量从合约的 decimals()、name()、getContractInfo() 读取，
+// 接口返回的可读金额和积分计算都使用这里的精度。
+type Token struct {
+	ID                 uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChainID            int64      `gorm:"not null;uniqueIndex:idx_token_identity,priority:1" json:"chain_id"`
+	ChainName          string     `gorm:"type:varchar(50);not null;index" json:"chain_name"`
+	Address            string     `gorm:"type:varchar(42);not null;uniqueIndex:idx_token_identity,priority:2" json:"address"`
+	Symbol             string     `gorm:"type:varchar(32);not null" json:"symbol"`
+	Name               string     `gorm:"type:varchar(100)" json:"name"`
+	Decimals           uint8      `gorm:"not null" json:"decimals"`
+	MaxSupply          string     `gorm:"type:varchar(78)" json:"max_supply"`    // getContractInfo 返回的最大供应量，合约没有该方法时为空
+	MaxSupplyFormatted string     `gorm:"-" json:"max_supply_formatted"`         // 按精度换算后的最大供应量，只在接口返回时填写
+	Owner              string     `gorm:"type:varchar(42)" json:"owner"`         // getContractInfo 返回的合约所有者
+	MetadataUpdatedAt  *time.Time `json:"metadata_updated_at"`                   // 最后一次从合约读取元数据的时间，为空表示尚未读取
+	StartBlock         uint64     `gorm:"not null;default:0" json:"start_block"` // 合约部署区块
+	Enabled            bool       `gorm:"not null" json:"enabled"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Token) TableName() string {
+	return "tokens"
+}
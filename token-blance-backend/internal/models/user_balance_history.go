@@ -5,18 +5,34 @@ import (
 )
 
 // UserBalanceHistory 用户余额变动记录表
+//
+// 通过 (chain_id, tx_hash, log_index) 关联产生该变动的事件日志；一条 Transfer
+// 日志会为发送方和接收方各写一条记录，因此唯一键还包含用户地址和变动类型。
+// Timestamp 为区块的链上时间戳；同一用户的记录按 (block_number, log_index) 排序。
+// 余额按 (chain_id, token_address, user_address) 分别累计，OldBalance/NewBalance
+// 是该用户在这条链上这个代币的余额。
+// change_type 为 reconciliation 的记录是按链上 balanceOf 修正余额时写入的，
+// TxHash 为 "reconciliation-<一致性问题ID>"，没有对应的事件日志。
 type UserBalanceHistory struct {
 	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserAddress    string    `gorm:"type:varchar(42);not null;index" json:"user_address"`
+	UserAddress    string    `gorm:"type:varchar(42);not null;index;index:idx_history_order,priority:1;uniqueIndex:idx_history_identity,priority:4;index:idx_history_scope,priority:3" json:"user_address"`
+	TokenAddress   string    `gorm:"type:varchar(42);not null;default:'';index:idx_history_scope,priority:2" json:"token_address"`
 	OldBalance     string    `gorm:"type:varchar(78);not null" json:"old_balance"`
 	NewBalance     string    `gorm:"type:varchar(78);not null" json:"new_balance"`
 	ChangeAmount   string    `gorm:"type:varchar(78);not null" json:"change_amount"`
-	ChangeType     string    `gorm:"type:enum('mint','burn','transfer_in','transfer_out');not null" json:"change_type"`
-	TxHash         string    `gorm:"type:varchar(66);not null;uniqueIndex" json:"tx_hash"`
-	BlockNumber    uint64    `gorm:"not null;index" json:"block_number"`
+	ChangeType     string    `gorm:"type:enum('mint','burn','transfer_in','transfer_out','reconciliation');not null;uniqueIndex:idx_history_identity,priority:5" json:"change_type"`
+	TxHash         string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_history_identity,priority:2;index:idx_user_balance_history_tx" json:"tx_hash"`
+	LogIndex       uint      `gorm:"not null;default:0;index:idx_history_order,priority:3;uniqueIndex:idx_history_identity,priority:3;index:idx_history_scope,priority:5" json:"log_index"`
+	BlockNumber    uint64    `gorm:"not null;index;index:idx_history_order,priority:2;index:idx_history_scope,priority:4" json:"block_number"`
+	ChainID        int64     `gorm:"not null;default:0;index;uniqueIndex:idx_history_identity,priority:1;index:idx_history_scope,priority:1" json:"chain_id"`
 	Timestamp      time.Time `gorm:"not null;index" json:"timestamp"`
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
 
+	// 按代币精度换算后的金额，只在接口返回时填写
+	OldBalanceFormatted   string `gorm:"-" json:"old_balance_formatted"`
+	NewBalanceFormatted   string `gorm:"-" json:"new_balance_formatted"`
+	ChangeAmountFormatted string `gorm:"-" json:"change_amount_formatted"`
+
 	// 关联
 	User User `gorm:"foreignKey:UserAddress" json:"user,omitempty"`
 }
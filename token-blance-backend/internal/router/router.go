@@ -3,6 +3,7 @@ package router
 import (
 	"token-balance/docs"
 	"token-balance/internal/controllers"
+	"token-balance/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -16,6 +17,12 @@ func SetupRouter(
 	pointsController *controllers.PointsController,
 	statsController *controllers.StatsController,
 	multiChainController *controllers.MultiChainController,
+	tokenController *controllers.TokenController,
+	reconciliationController *controllers.ReconciliationController,
+	deadLetterController *controllers.DeadLetterController,
+	replayController *controllers.ReplayController,
+	snapshotController *controllers.SnapshotController,
+	distributionController *controllers.DistributionController,
 ) *gin.Engine {
 	r := gin.New()
 
@@ -49,6 +56,9 @@ func SetupRouter(
 		})
 	})
 
+	// 就绪探针：数据库或所有链不可用时返回503
+	r.GET("/ready", multiChainController.Readiness)
+
 	// API v1路由组
 	v1 := r.Group("/api/v1")
 	{
@@ -58,6 +68,7 @@ func SetupRouter(
 			user.GET("/:address", userController.GetUserBalance)
 			user.GET("/:address/history", userController.GetUserBalanceHistory)
 			user.GET("/:address/points", userController.GetUserPoints)
+			user.GET("/:address/assets", userController.GetUserAssets)
 		}
 
 		// 事件相关路由
@@ -65,6 +76,19 @@ func SetupRouter(
 		{
 			events.GET("/", eventController.GetEvents)
 			events.GET("/:id", eventController.GetEventByID)
+			events.POST("/sync", middleware.JWTAuth(), eventController.SyncEvents)
+			events.GET("/sync/status", middleware.JWTAuth(), eventController.GetSyncStatus)
+		}
+
+		// 代币登记路由 (修改需要登录)
+		tokens := v1.Group("/tokens")
+		{
+			tokens.GET("", tokenController.ListTokens)
+			tokens.GET("/:id", tokenController.GetToken)
+			tokens.POST("", middleware.JWTAuth(), tokenController.CreateToken)
+			tokens.PUT("/:id", middleware.JWTAuth(), tokenController.UpdateToken)
+			tokens.DELETE("/:id", middleware.JWTAuth(), tokenController.DeleteToken)
+			tokens.POST("/:id/metadata", middleware.JWTAuth(), tokenController.RefreshTokenMetadata)
 		}
 
 		// 积分相关路由
@@ -81,13 +105,67 @@ func SetupRouter(
 			stats.GET("/daily", statsController.GetDailyStats)
 		}
 
+		// 链上余额核对 (需要登录)
+		reconciliation := v1.Group("/reconciliation", middleware.JWTAuth())
+		{
+			reconciliation.POST("/run", reconciliationController.RunReconciliation)
+			reconciliation.GET("/reports", reconciliationController.GetReconciliationReports)
+			reconciliation.POST("/supply", reconciliationController.RunSupplyCheck)
+			reconciliation.GET("/supply", reconciliationController.GetSupplyChecks)
+			reconciliation.GET("/issues", reconciliationController.GetReconciliationIssues)
+			reconciliation.POST("/issues/:id/fix", reconciliationController.FixReconciliationIssue)
+		}
+
+		// 入账失败的死信日志 (需要登录)
+		deadLetters := v1.Group("/dead-letters", middleware.JWTAuth())
+		{
+			deadLetters.GET("", deadLetterController.GetDeadLetters)
+			deadLetters.POST("/:id/retry", deadLetterController.RetryDeadLetter)
+			deadLetters.POST("/:id/discard", deadLetterController.DiscardDeadLetter)
+		}
+
+		// 从原始日志回放派生数据 (需要登录)
+		replay := v1.Group("/replay", middleware.JWTAuth())
+		{
+			replay.POST("/run", replayController.RunReplay)
+			replay.GET("/report", replayController.GetReplayReport)
+			replay.POST("/swap", replayController.SwapReplay)
+		}
+
+		// 历史余额快照
+		snapshots := v1.Group("/snapshots")
+		{
+			snapshots.GET("/balances", snapshotController.GetBalanceSnapshot)
+		}
+
+		// 奖励分发 Merkle 树
+		distributions := v1.Group("/distributions")
+		{
+			distributions.POST("", middleware.JWTAuth(), distributionController.CreateDistribution)
+			distributions.GET("", distributionController.GetDistributions)
+			distributions.GET("/:id", distributionController.GetDistribution)
+			distributions.GET("/:id/proof/:address", distributionController.GetDistributionProof)
+		}
+
 		// 多链相关路由 (任务7: 完善多链支持)
 		multiChain := v1.Group("/multichain")
 		{
 			multiChain.GET("/status", multiChainController.GetChainStatus)
-			multiChain.POST("/start/:chain", multiChainController.StartChain)
-			multiChain.POST("/stop/:chain", multiChainController.StopChain)
+			multiChain.GET("/health", multiChainController.HealthCheck)
+			multiChain.POST("/start/:chain", middleware.JWTAuth(), multiChainController.StartChain)
+			multiChain.POST("/stop/:chain", middleware.JWTAuth(), multiChainController.StopChain)
+			multiChain.POST("/restart/:chain", middleware.JWTAuth(), multiChainController.RestartChain)
 			multiChain.GET("/events/:chain", multiChainController.GetChainEvents)
+			multiChain.GET("/reorgs", multiChainController.GetReorgReports)
+
+			// 链定义管理 (需要登录：链定义中的 RPC 地址通常带有服务商的 API key)
+			multiChain.GET("/chains", middleware.JWTAuth(), multiChainController.ListChains)
+			multiChain.GET("/chains/:chain", middleware.JWTAuth(), multiChainController.GetChain)
+			multiChain.POST("/chains", middleware.JWTAuth(), multiChainController.CreateChain)
+			multiChain.PUT("/chains/:chain", middleware.JWTAuth(), multiChainController.UpdateChain)
+			multiChain.DELETE("/chains/:chain", middleware.JWTAuth(), multiChainController.DeleteChain)
+			multiChain.POST("/chains/:chain/enable", middleware.JWTAuth(), multiChainController.EnableChain)
+			multiChain.POST("/chains/:chain/disable", middleware.JWTAuth(), multiChainController.DisableChain)
 		}
 	}
 
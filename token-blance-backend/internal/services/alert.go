@@ -0,0 +1,58 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+	"token-balance/internal/middleware"
+)
+
+// alertTimeout 发送告警 webhook 的超时时间
+const alertTimeout = 5 * time.Second
+
+// Alert 发送到 ALERT_WEBHOOK_URL 的告警内容
+type Alert struct {
+	Severity string                 `json:"severity"` // 严重程度，与一致性问题一致
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Time     time.Time              `json:"time"`
+}
+
+// sendAlert 记录告警日志，配置了 webhook 时同时以 JSON POST 到该地址
+//
+// 发送失败只记录日志，不影响调用方。
+func sendAlert(ctx context.Context, webhookURL string, alert Alert) {
+	alert.Time = time.Now()
+	middleware.Error("🚨 [%s] %s: %s", alert.Severity, alert.Title, alert.Message)
+	if webhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		middleware.Error("序列化告警失败: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, alertTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		middleware.Error("创建告警请求失败: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		middleware.Error("发送告警失败: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		middleware.Error("发送告警失败: webhook 返回 %d", resp.StatusCode)
+	}
+}
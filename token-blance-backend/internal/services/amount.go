@@ -0,0 +1,94 @@
+package services
+
+import (
+	"math/big"
+	"strconv"
+	"token-balance/internal/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// tokenDecimals 已登记代币的精度，按 "链ID:合约地址" 索引
+//
+// 数据库中的余额和金额都是最小单位的整数，接口返回时按代币精度换算出可读的金额，
+// 积分也按换算后的代币数量计算。未登记的代币按默认精度 18 换算。
+type tokenDecimals map[string]uint8
+
+// loadTokenDecimals 读取所有已登记代币的精度
+func loadTokenDecimals(db *gorm.DB) (tokenDecimals, error) {
+	var tokens []models.Token
+	if err := db.Select("chain_id, address, decimals").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	decimals := make(tokenDecimals, len(tokens))
+	for _, token := range tokens {
+		decimals[tokenKey(token.ChainID, token.Address)] = token.Decimals
+	}
+	return decimals, nil
+}
+
+// of 代币的精度，未登记时为默认精度
+func (d tokenDecimals) of(chainID int64, address string) uint8 {
+	if decimals, ok := d[tokenKey(chainID, address)]; ok {
+		return decimals
+	}
+	return defaultTokenDecimals
+}
+
+// tokenKey 代币在登记表中的唯一标识
+func tokenKey(chainID int64, address string) string {
+	return strconv.FormatInt(chainID, 10) + ":" + address
+}
+
+// tokenAmount 把最小单位的整数金额按精度换算为代币数量，无法解析时为0
+func tokenAmount(raw string, decimals uint8) decimal.Decimal {
+	value, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		return decimal.Zero
+	}
+	return decimal.NewFromBigInt(value, -int32(decimals))
+}
+
+// formatTokenAmount 按精度格式化金额，例如精度 18 时 "1500000000000000000" 为 "1.5"
+func formatTokenAmount(raw string, decimals uint8) string {
+	return tokenAmount(raw, decimals).String()
+}
+
+// formatHoldings 填写持仓的可读余额
+func formatHoldings(holdings []models.Holding, decimals tokenDecimals) {
+	for i := range holdings {
+		holding := &holdings[i]
+		holding.BalanceFormatted = formatTokenAmount(holding.Balance, decimals.of(holding.ChainID, holding.TokenAddress))
+	}
+}
+
+// formatBalanceHistory 填写余额历史的可读金额
+func formatBalanceHistory(histories []models.UserBalanceHistory, decimals tokenDecimals) {
+	for i := range histories {
+		history := &histories[i]
+		precision := decimals.of(history.ChainID, history.TokenAddress)
+		history.OldBalanceFormatted = formatTokenAmount(history.OldBalance, precision)
+		history.NewBalanceFormatted = formatTokenAmount(history.NewBalance, precision)
+		history.ChangeAmountFormatted = formatTokenAmount(history.ChangeAmount, precision)
+	}
+}
+
+// formatEventLogs 填写事件日志的可读金额
+func formatEventLogs(events []models.EventLog, decimals tokenDecimals) {
+	for i := range events {
+		event := &events[i]
+		if event.Amount != "" {
+			event.AmountFormatted = formatTokenAmount(event.Amount, decimals.of(event.ChainID, event.ContractAddress))
+		}
+	}
+}
+
+// formatPointsRecords 填写积分记录中余额的可读金额
+func formatPointsRecords(records []models.PointsRecord, decimals tokenDecimals) {
+	for i := range records {
+		record := &records[i]
+		record.BalanceFormatted = formatTokenAmount(record.Balance, decimals.of(record.ChainID, record.TokenAddress))
+	}
+}
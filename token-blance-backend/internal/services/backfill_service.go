@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// backfillMaxRetries 单段区块同步连续失败的最大重试次数
+const backfillMaxRetries = 5
+
+// BackfillService 历史回填服务
+//
+// 从合约部署区块开始按区块段向前同步到安全高度，余额按 (区块号, 日志索引) 顺序入账。
+// 每段区块与同步游标在同一事务中提交，中断后再次执行会从游标继续，不会重复入账。
+type BackfillService struct {
+	db   *gorm.DB
+	cfg  *config.Config
+	mu   sync.Mutex
+	jobs map[string]*BackfillProgress
+}
+
+// BackfillOptions 回填参数
+type BackfillOptions struct {
+	ChainName string // 链名称 (sepolia, base-sepolia)
+	FromBlock uint64 // 起始区块，为0时使用配置的部署区块
+	Reset     bool   // 删除该链已同步的数据，从起始区块重新同步
+}
+
+// BackfillProgress 回填进度
+type BackfillProgress struct {
+	ChainName       string     `json:"chain_name"`
+	ChainID         int64      `json:"chain_id"`
+	Status          string     `json:"status"` // running, completed, failed
+	StartBlock      uint64     `json:"start_block"`
+	CurrentBlock    uint64     `json:"current_block"`
+	TargetBlock     uint64     `json:"target_block"`
+	Percent         float64    `json:"percent"`
+	EventsProcessed int        `json:"events_processed"`
+	ETASeconds      int64      `json:"eta_seconds"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+
+	resumeBlock uint64 // 本次运行开始时的游标，用于估算剩余时间
+}
+
+// NewBackfillService 创建历史回填服务
+func NewBackfillService(db *gorm.DB, cfg *config.Config) *BackfillService {
+	return &BackfillService{
+		db:   db,
+		cfg:  cfg,
+		jobs: make(map[string]*BackfillProgress),
+	}
+}
+
+// StartBackfill 在后台启动回填，返回初始进度
+func (bs *BackfillService) StartBackfill(opts BackfillOptions) (*BackfillProgress, error) {
+	if err := bs.claim(opts.ChainName); err != nil {
+		return nil, err
+	}
+
+	syncer, client, progress, err := bs.prepare(opts)
+	if err != nil {
+		bs.release(opts.ChainName)
+		return nil, err
+	}
+	bs.track(progress)
+
+	go func() {
+		defer client.Close()
+		if err := bs.run(context.Background(), syncer, progress, nil); err != nil {
+			middleware.Error("❌ %s 历史回填失败: %v", opts.ChainName, err)
+		}
+	}()
+
+	snapshot := bs.snapshot(progress)
+	return &snapshot, nil
+}
+
+// RunBackfill 同步执行回填直到追上安全高度 (命令行使用)
+func (bs *BackfillService) RunBackfill(ctx context.Context, opts BackfillOptions, onProgress func(BackfillProgress)) error {
+	if err := bs.claim(opts.ChainName); err != nil {
+		return err
+	}
+
+	syncer, client, progress, err := bs.prepare(opts)
+	if err != nil {
+		bs.release(opts.ChainName)
+		return err
+	}
+	defer client.Close()
+	bs.track(progress)
+
+	return bs.run(ctx, syncer, progress, onProgress)
+}
+
+// GetProgress 获取回填进度，chainName 为空时返回所有链
+func (bs *BackfillService) GetProgress(chainName string) []BackfillProgress {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	result := make([]BackfillProgress, 0, len(bs.jobs))
+	for name, progress := range bs.jobs {
+		if progress == nil || (chainName != "" && name != chainName) {
+			continue
+		}
+		result = append(result, *progress)
+	}
+	return result
+}
+
+// claim 标记链正在回填，同一条链同时只允许一个回填任务
+func (bs *BackfillService) claim(chainName string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if progress, exists := bs.jobs[chainName]; exists && (progress == nil || progress.Status == "running") {
+		return fmt.Errorf("链 %s 的历史回填正在进行中", chainName)
+	}
+	bs.jobs[chainName] = nil
+	return nil
+}
+
+// release 准备失败时释放链的回填标记
+func (bs *BackfillService) release(chainName string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	delete(bs.jobs, chainName)
+}
+
+// track 记录回填进度
+func (bs *BackfillService) track(progress *BackfillProgress) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.jobs[progress.ChainName] = progress
+}
+
+// snapshot 在锁内复制一份进度
+func (bs *BackfillService) snapshot(progress *BackfillProgress) BackfillProgress {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return *progress
+}
+
+// prepare 连接链RPC、校验起始区块并创建同步器
+//
+// 如果该链已有的同步数据不是从起始区块开始（例如上线时从最新区块开始监听），
+// 只向前同步会漏掉中间的事件，此时必须指定 Reset 重建该链的数据。
+func (bs *BackfillService) prepare(opts BackfillOptions) (*chainSyncer, *RPCPool, *BackfillProgress, error) {
+	chains, err := loadChainConfigs(bs.db, bs.cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("读取链定义失败: %v", err)
+	}
+	chainConfig, ok := chains[opts.ChainName]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("未配置的链: %s", opts.ChainName)
+	}
+
+	fromBlock := opts.FromBlock
+	if fromBlock == 0 {
+		fromBlock = chainConfig.StartBlock
+	}
+	if fromBlock == 0 {
+		return nil, nil, nil, fmt.Errorf("链 %s 未配置合约部署区块，请指定起始区块", opts.ChainName)
+	}
+
+	cursor, err := loadSyncCursor(bs.db, opts.ChainName, chainConfig.ChainID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("读取 %s 同步游标失败: %v", opts.ChainName, err)
+	}
+	if !opts.Reset && cursor.StartBlock > fromBlock {
+		return nil, nil, nil, fmt.Errorf("链 %s 已从区块 %d 开始同步，区块 %d - %d 的事件缺失，请使用 reset 重新回填",
+			opts.ChainName, cursor.StartBlock, fromBlock, cursor.StartBlock-1)
+	}
+
+	client, err := DialRPCPool(opts.ChainName, chainConfig.RPCURLs, chainConfig.ChainID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if opts.Reset {
+		err := bs.db.Transaction(func(tx *gorm.DB) error {
+			if err := lockSyncCursor(tx, opts.ChainName); err != nil {
+				return err
+			}
+			if _, err := revertChainData(tx, chainConfig.ChainID, fromBlock-1); err != nil {
+				return err
+			}
+			return resetSyncCursor(tx, opts.ChainName, fromBlock)
+		})
+		if err != nil {
+			client.Close()
+			return nil, nil, nil, fmt.Errorf("重置 %s 同步数据失败: %v", opts.ChainName, err)
+		}
+		cursor.LastBlock = fromBlock - 1
+		middleware.Warn("♻️ %s 已清除区块 %d 之后的同步数据，重新回填", opts.ChainName, fromBlock-1)
+	}
+
+	if err := registerConfiguredToken(bs.db, opts.ChainName, chainConfig.ChainID, common.HexToAddress(chainConfig.ContractAddr), chainConfig.StartBlock); err != nil {
+		middleware.Warn("⚠️ %v", err)
+	}
+
+	eventService := &EventService{
+		db:         bs.db,
+		client:     client,
+		chainName:  opts.ChainName,
+		chainID:    chainConfig.ChainID,
+		startBlock: fromBlock,
+		finality:   newFinalityPolicy(opts.ChainName, chainConfig.Finality, chainConfig.ConfirmationBlocks),
+	}
+
+	resumeBlock := cursor.LastBlock
+	if resumeBlock < fromBlock-1 {
+		resumeBlock = fromBlock - 1
+	}
+
+	now := time.Now()
+	progress := &BackfillProgress{
+		ChainName:    opts.ChainName,
+		ChainID:      chainConfig.ChainID,
+		Status:       "running",
+		StartBlock:   fromBlock,
+		CurrentBlock: resumeBlock,
+		StartedAt:    now,
+		UpdatedAt:    now,
+		resumeBlock:  resumeBlock,
+	}
+
+	return eventService.syncer(), client, progress, nil
+}
+
+// run 循环同步区块段直到追上安全高度
+func (bs *BackfillService) run(ctx context.Context, syncer *chainSyncer, progress *BackfillProgress, onProgress func(BackfillProgress)) error {
+	middleware.Info("📦 %s 开始历史回填: 起始区块=%d, 当前游标=%d",
+		progress.ChainName, progress.StartBlock, progress.CurrentBlock)
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return bs.finish(progress, ctx.Err())
+		default:
+		}
+
+		iterCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		result, err := syncer.syncNext(iterCtx)
+		cancel()
+		if err != nil {
+			failures++
+			if failures > backfillMaxRetries {
+				return bs.finish(progress, err)
+			}
+			middleware.Warn("⚠️ %s 回填区块段失败 (第 %d 次重试): %v", progress.ChainName, failures, err)
+			time.Sleep(time.Duration(failures) * 2 * time.Second)
+			continue
+		}
+		failures = 0
+
+		bs.update(progress, result)
+		if onProgress != nil {
+			onProgress(bs.snapshot(progress))
+		}
+
+		if result.BlockedBy != nil {
+			return bs.finish(progress, fmt.Errorf("区块 %d 的日志入账失败 (死信 %d): %s，重试成功或被丢弃后重新回填",
+				result.BlockedBy.BlockNumber, result.BlockedBy.ID, result.BlockedBy.Error))
+		}
+		if result.RetryAfter > 0 {
+			select {
+			case <-ctx.Done():
+				return bs.finish(progress, ctx.Err())
+			case <-time.After(result.RetryAfter):
+			}
+			continue
+		}
+		if result.CaughtUp {
+			return bs.finish(progress, nil)
+		}
+	}
+}
+
+// update 根据本次同步结果更新进度和预计剩余时间
+func (bs *BackfillService) update(progress *BackfillProgress, result *syncResult) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	now := time.Now()
+	progress.CurrentBlock = result.LastBlock
+	progress.TargetBlock = result.SafeBlock
+	progress.EventsProcessed += result.Saved
+	progress.UpdatedAt = now
+
+	if progress.TargetBlock >= progress.StartBlock && progress.CurrentBlock >= progress.StartBlock {
+		total := float64(progress.TargetBlock - progress.StartBlock + 1)
+		done := float64(progress.CurrentBlock - progress.StartBlock + 1)
+		progress.Percent = done / total * 100
+		if progress.Percent > 100 {
+			progress.Percent = 100
+		}
+	}
+
+	// 按本次运行的平均速度估算剩余时间
+	if progress.CurrentBlock > progress.resumeBlock && progress.TargetBlock > progress.CurrentBlock {
+		elapsed := now.Sub(progress.StartedAt).Seconds()
+		rate := float64(progress.CurrentBlock-progress.resumeBlock) / elapsed
+		progress.ETASeconds = int64(float64(progress.TargetBlock-progress.CurrentBlock) / rate)
+	} else {
+		progress.ETASeconds = 0
+	}
+}
+
+// finish 记录回填结束状态
+func (bs *BackfillService) finish(progress *BackfillProgress, err error) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	now := time.Now()
+	progress.FinishedAt = &now
+	progress.UpdatedAt = now
+	progress.ETASeconds = 0
+	if err != nil {
+		progress.Status = "failed"
+		progress.Error = err.Error()
+		return err
+	}
+
+	progress.Status = "completed"
+	progress.Percent = 100
+	middleware.Info("✅ %s 历史回填完成: 区块 %d - %d, 处理事件 %d 个",
+		progress.ChainName, progress.StartBlock, progress.CurrentBlock, progress.EventsProcessed)
+	return nil
+}
@@ -0,0 +1,549 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// transferEventSig Transfer 事件签名: keccak256("Transfer(address,address,uint256)")
+var transferEventSig = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+// errNegativeBalance 余额变动会导致负余额
+var errNegativeBalance = errors.New("余额不足，拒绝入账")
+
+// storeBatchSize 批量写入时每条 INSERT 语句的行数
+const storeBatchSize = 200
+
+// transferEvent 解析后的 Transfer 事件
+type transferEvent struct {
+	ChainID     int64
+	Token       common.Address // 代币合约地址 (发出日志的合约)
+	TxHash      string
+	LogIndex    uint
+	BlockNumber uint64
+	From        common.Address
+	To          common.Address
+	Amount      *big.Int
+	Timestamp   time.Time
+}
+
+// decodeTransferLog 解析 Transfer 日志，非 Transfer 日志返回 nil
+//
+// blockTime 为日志所在区块的链上时间戳。
+func decodeTransferLog(chainID int64, log *types.Log, blockTime time.Time) *transferEvent {
+	if len(log.Topics) < 3 || log.Topics[0] != transferEventSig {
+		return nil
+	}
+
+	amount := new(big.Int)
+	if len(log.Data) >= 32 {
+		amount.SetBytes(log.Data[:32])
+	}
+
+	return &transferEvent{
+		ChainID:     chainID,
+		Token:       log.Address,
+		TxHash:      log.TxHash.Hex(),
+		LogIndex:    log.Index,
+		BlockNumber: log.BlockNumber,
+		From:        common.BytesToAddress(log.Topics[1].Bytes()),
+		To:          common.BytesToAddress(log.Topics[2].Bytes()),
+		Amount:      amount,
+		Timestamp:   blockTime,
+	}
+}
+
+// decodeLog 把日志解码为待写入的事件日志和 Transfer 事件
+//
+// EventLog.Data 保存原始日志数据的十六进制，完整的日志字段归档在 raw_logs 中。
+func decodeLog(chainID int64, log *types.Log, blockTime time.Time) decodedLog {
+	eventLog := models.EventLog{
+		TxHash:          log.TxHash.Hex(),
+		LogIndex:        log.Index,
+		BlockNumber:     log.BlockNumber,
+		BlockHash:       log.BlockHash.Hex(),
+		ChainID:         chainID,
+		ContractAddress: log.Address.Hex(),
+		Data:            hexutil.Encode(log.Data),
+		Timestamp:       blockTime,
+	}
+
+	transfer := decodeTransferLog(chainID, log, blockTime)
+	if transfer != nil {
+		eventLog.EventName = "Transfer"
+		eventLog.UserAddress = transfer.To.Hex() // 主要关注接收方
+		eventLog.Amount = transfer.Amount.String()
+	}
+
+	return decodedLog{EventLog: eventLog, Transfer: transfer}
+}
+
+// newRawLogs 把一批原始日志转换为归档行，decoded 与 logs 一一对应
+func newRawLogs(chainID int64, logs []types.Log, decoded []decodedLog) []models.RawLog {
+	rows := make([]models.RawLog, 0, len(logs))
+	for i := range logs {
+		log := &logs[i]
+		row := models.RawLog{
+			ChainID:     chainID,
+			Address:     log.Address.Hex(),
+			Data:        hexutil.Encode(log.Data),
+			BlockNumber: log.BlockNumber,
+			TxHash:      log.TxHash.Hex(),
+			TxIndex:     log.TxIndex,
+			BlockHash:   log.BlockHash.Hex(),
+			LogIndex:    log.Index,
+			Removed:     log.Removed,
+		}
+		topics := []*string{&row.Topic0, &row.Topic1, &row.Topic2, &row.Topic3}
+		for j, topic := range log.Topics {
+			if j < len(topics) {
+				*topics[j] = topic.Hex()
+			}
+		}
+
+		if i < len(decoded) {
+			row.EventName = decoded[i].EventLog.EventName
+			if !decoded[i].EventLog.Timestamp.IsZero() {
+				blockTime := decoded[i].EventLog.Timestamp
+				row.BlockTime = &blockTime
+			}
+			if transfer := decoded[i].Transfer; transfer != nil {
+				row.FromAddress = transfer.From.Hex()
+				row.ToAddress = transfer.To.Hex()
+				row.Amount = transfer.Amount.String()
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// archiveRawLogs 在调用方的事务中归档原始日志
+//
+// 日志按 (链ID, 区块哈希, 日志索引) 识别，已归档的日志跳过；重组后又回到规范链上的区块，
+// 其日志之前被标记为 removed，这里恢复为 removed = false。
+func archiveRawLogs(tx *gorm.DB, chainID int64, logs []types.Log, decoded []decodedLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	rows := newRawLogs(chainID, logs, decoded)
+	err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"removed": false}),
+	}).CreateInBatches(rows, storeBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("归档原始日志失败: %v", err)
+	}
+	return nil
+}
+
+// decodedLog 解码后的日志：待写入的事件日志，以及对应的 Transfer 事件 (非 Transfer 日志为 nil)
+type decodedLog struct {
+	EventLog models.EventLog
+	Transfer *transferEvent
+}
+
+// rejectedLog 被拒绝入账的日志及原因
+type rejectedLog struct {
+	Log decodedLog
+	Err error
+}
+
+// eventKey 事件日志的唯一标识
+type eventKey struct {
+	ChainID  int64
+	TxHash   string
+	LogIndex uint
+}
+
+// storeEventBatch 在调用方的事务中批量写入事件日志并应用对应的余额变化
+//
+// events 按 (区块, 日志索引) 排序。已存在的日志直接跳过；这批日志涉及的持仓行
+// 按主键顺序一次性加锁，余额变化在内存中按日志顺序逐条应用，同一地址的变动顺序与链上一致，
+// 最后批量写入事件、余额历史和持仓。会导致负余额的日志拒绝入账，它之后的日志也不再应用，
+// 保证余额按链上顺序变化；调用方把被拒绝的日志记入死信。返回新入账的事件数和被拒绝的日志 (没有时为 nil)。
+func storeEventBatch(tx *gorm.DB, events []decodedLog) (int, *rejectedLog, error) {
+	pending, err := newEventLogs(tx, events)
+	if err != nil {
+		return 0, nil, fmt.Errorf("查询已处理事件失败: %v", err)
+	}
+	if len(pending) == 0 {
+		return 0, nil, nil
+	}
+
+	ledger, err := lockBalanceLedger(tx, pending)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	eventLogs := make([]models.EventLog, 0, len(pending))
+	histories := make([]models.UserBalanceHistory, 0, len(pending)*2)
+	var rejected *rejectedLog
+	for _, event := range pending {
+		if event.Transfer != nil {
+			changes, err := ledger.applyTransfer(event.Transfer)
+			if err != nil {
+				rejected = &rejectedLog{Log: event, Err: err}
+				break
+			}
+			histories = append(histories, changes...)
+		}
+		eventLogs = append(eventLogs, event.EventLog)
+	}
+	if len(eventLogs) == 0 {
+		return 0, rejected, nil
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(eventLogs, storeBatchSize)
+	if result.Error != nil {
+		return 0, nil, fmt.Errorf("写入事件日志失败: %v", result.Error)
+	}
+	if result.RowsAffected != int64(len(eventLogs)) {
+		// 预读之后有其他监听者写入了同一批日志，回滚本批，避免重复入账
+		return 0, nil, fmt.Errorf("%w: 事件日志已被写入", errSyncCursorMoved)
+	}
+	if len(histories) > 0 {
+		if err := tx.CreateInBatches(histories, storeBatchSize).Error; err != nil {
+			return 0, nil, fmt.Errorf("记录余额变动历史失败: %v", err)
+		}
+	}
+	if err := ledger.flush(tx); err != nil {
+		return 0, nil, err
+	}
+
+	return len(eventLogs), rejected, nil
+}
+
+// newEventLogs 过滤掉已入库以及批次内重复的日志，保持原有顺序
+func newEventLogs(tx *gorm.DB, events []decodedLog) ([]decodedLog, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	hashes := make([]string, 0, len(events))
+	seenHashes := make(map[string]bool)
+	for _, event := range events {
+		if !seenHashes[event.EventLog.TxHash] {
+			seenHashes[event.EventLog.TxHash] = true
+			hashes = append(hashes, event.EventLog.TxHash)
+		}
+	}
+
+	var existing []eventKey
+	err := tx.Model(&models.EventLog{}).
+		Select("chain_id, tx_hash, log_index").
+		Where("tx_hash IN ?", hashes).
+		Find(&existing).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[eventKey]bool, len(existing)+len(events))
+	for _, key := range existing {
+		seen[key] = true
+	}
+
+	pending := make([]decodedLog, 0, len(events))
+	for _, event := range events {
+		key := eventKey{ChainID: event.EventLog.ChainID, TxHash: event.EventLog.TxHash, LogIndex: event.EventLog.LogIndex}
+		if seen[key] {
+			middleware.Debug("⏭️ 事件已处理过，跳过: TX=%s, LogIndex=%d", key.TxHash, key.LogIndex)
+			continue
+		}
+		seen[key] = true
+		pending = append(pending, event)
+	}
+	return pending, nil
+}
+
+// balanceLedger 一批日志涉及的持仓，已在事务中加锁
+//
+// 余额变化先在内存中按日志顺序应用，flush 时只写回有变化的行。
+type balanceLedger struct {
+	holdings map[balanceScope]*ledgerEntry // 按 (链ID, 代币, 地址) 的持仓余额
+}
+
+// ledgerEntry 加锁时读取的余额以及之后的变化
+type ledgerEntry struct {
+	Balance     *big.Int
+	BlockNumber uint64
+	Changed     bool
+}
+
+// lockBalanceLedger 锁定一批日志涉及的持仓行，不存在时先创建用户和零余额持仓
+//
+// 持仓行按主键顺序加锁，多条链同时写入同一地址时不会互相死锁。
+func lockBalanceLedger(tx *gorm.DB, events []decodedLog) (*balanceLedger, error) {
+	ledger := &balanceLedger{
+		holdings: make(map[balanceScope]*ledgerEntry),
+	}
+
+	var addresses []string
+	var holdings []models.Holding
+	seenAddresses := make(map[string]bool)
+	seenScopes := make(map[balanceScope]bool)
+	for _, event := range events {
+		transfer := event.Transfer
+		if transfer == nil {
+			continue
+		}
+		for _, address := range []common.Address{transfer.From, transfer.To} {
+			if address == (common.Address{}) {
+				continue
+			}
+			scope := balanceScope{ChainID: transfer.ChainID, TokenAddress: transfer.Token.Hex(), UserAddress: address.Hex()}
+			if !seenAddresses[scope.UserAddress] {
+				seenAddresses[scope.UserAddress] = true
+				addresses = append(addresses, scope.UserAddress)
+			}
+			if !seenScopes[scope] {
+				seenScopes[scope] = true
+				holdings = append(holdings, models.Holding{
+					ChainID:      scope.ChainID,
+					TokenAddress: scope.TokenAddress,
+					UserAddress:  scope.UserAddress,
+					Balance:      "0",
+				})
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return ledger, nil
+	}
+	sort.Strings(addresses)
+
+	// 用户行：余额历史和积分引用用户，不存在时先创建
+	newUsers := make([]models.User, 0, len(addresses))
+	for _, address := range addresses {
+		newUsers = append(newUsers, models.User{ID: address})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(newUsers, storeBatchSize).Error; err != nil {
+		return nil, fmt.Errorf("创建用户失败: %v", err)
+	}
+
+	// 持仓行：先创建零余额持仓，再按链加锁 (锁定范围可能略大于实际涉及的持仓)
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(holdings, storeBatchSize).Error; err != nil {
+		return nil, fmt.Errorf("创建代币持仓失败: %v", err)
+	}
+	scopesByChain := make(map[int64][]balanceScope)
+	for scope := range seenScopes {
+		scopesByChain[scope.ChainID] = append(scopesByChain[scope.ChainID], scope)
+	}
+	for chainID, scopes := range scopesByChain {
+		tokens := make([]string, 0, len(scopes))
+		users := make([]string, 0, len(scopes))
+		for _, scope := range scopes {
+			tokens = append(tokens, scope.TokenAddress)
+			users = append(users, scope.UserAddress)
+		}
+
+		var locked []models.Holding
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chain_id = ? AND token_address IN ? AND user_address IN ?", chainID, tokens, users).
+			Order("id asc").
+			Find(&locked).Error
+		if err != nil {
+			return nil, fmt.Errorf("查询代币持仓失败: %v", err)
+		}
+		for _, holding := range locked {
+			scope := balanceScope{ChainID: holding.ChainID, TokenAddress: holding.TokenAddress, UserAddress: holding.UserAddress}
+			if !seenScopes[scope] {
+				continue
+			}
+			balance, ok := new(big.Int).SetString(holding.Balance, 10)
+			if !ok {
+				return nil, fmt.Errorf("无效的持仓余额: %s", holding.Balance)
+			}
+			ledger.holdings[scope] = &ledgerEntry{Balance: balance, BlockNumber: holding.BlockNumber}
+		}
+	}
+	for scope := range seenScopes {
+		if _, ok := ledger.holdings[scope]; !ok {
+			return nil, fmt.Errorf("锁定代币持仓失败: %s %s", scope.TokenAddress, scope.UserAddress)
+		}
+	}
+
+	return ledger, nil
+}
+
+// applyTransfer 复式记账：对发送方扣款、对接收方入账，返回两条腿的余额历史
+//
+// 零地址发出视为 mint，转入零地址视为 burn。扣款会导致负余额时两条腿都不应用。
+func (l *balanceLedger) applyTransfer(transfer *transferEvent) ([]models.UserBalanceHistory, error) {
+	fromZero := transfer.From == (common.Address{})
+	toZero := transfer.To == (common.Address{})
+
+	if !fromZero {
+		holding := l.holdings[balanceScope{ChainID: transfer.ChainID, TokenAddress: transfer.Token.Hex(), UserAddress: transfer.From.Hex()}]
+		if holding.Balance.Cmp(transfer.Amount) < 0 {
+			return nil, fmt.Errorf("%w: 地址=%s, 代币=%s, 余额=%s, 变动=-%s, TX=%s, LogIndex=%d",
+				errNegativeBalance, transfer.From.Hex(), transfer.Token.Hex(), holding.Balance.String(), transfer.Amount.String(), transfer.TxHash, transfer.LogIndex)
+		}
+	}
+
+	var histories []models.UserBalanceHistory
+	if !fromZero {
+		changeType := "transfer_out"
+		if toZero {
+			changeType = "burn"
+		}
+		histories = append(histories, l.applyBalanceChange(transfer, transfer.From, new(big.Int).Neg(transfer.Amount), changeType))
+	}
+	if !toZero {
+		changeType := "transfer_in"
+		if fromZero {
+			changeType = "mint"
+		}
+		histories = append(histories, l.applyBalanceChange(transfer, transfer.To, transfer.Amount, changeType))
+	}
+	return histories, nil
+}
+
+// applyBalanceChange 在内存中应用一条余额变动，返回对应的余额历史
+//
+// 余额按 (链ID, 代币, 地址) 保存在 holdings 表中，不同代币的余额不会相加。
+func (l *balanceLedger) applyBalanceChange(transfer *transferEvent, address common.Address, delta *big.Int, changeType string) models.UserBalanceHistory {
+	holding := l.holdings[balanceScope{ChainID: transfer.ChainID, TokenAddress: transfer.Token.Hex(), UserAddress: address.Hex()}]
+	oldBalance := new(big.Int).Set(holding.Balance)
+	holding.Balance.Add(holding.Balance, delta)
+	holding.BlockNumber = transfer.BlockNumber
+	holding.Changed = true
+
+	middleware.Debug("💰 余额更新(%s): Address=%s, Token=%s, Old=%s, New=%s",
+		changeType, address.Hex(), transfer.Token.Hex(), oldBalance.String(), holding.Balance.String())
+
+	return models.UserBalanceHistory{
+		UserAddress:  address.Hex(),
+		TokenAddress: transfer.Token.Hex(),
+		OldBalance:   oldBalance.String(),
+		NewBalance:   holding.Balance.String(),
+		ChangeAmount: new(big.Int).Abs(delta).String(),
+		ChangeType:   changeType,
+		TxHash:       transfer.TxHash,
+		LogIndex:     transfer.LogIndex,
+		BlockNumber:  transfer.BlockNumber,
+		ChainID:      transfer.ChainID,
+		Timestamp:    transfer.Timestamp,
+	}
+}
+
+// flush 把有变化的持仓批量写回数据库
+func (l *balanceLedger) flush(tx *gorm.DB) error {
+	var holdings []models.Holding
+	for scope, entry := range l.holdings {
+		if entry.Changed {
+			holdings = append(holdings, models.Holding{
+				ChainID:      scope.ChainID,
+				TokenAddress: scope.TokenAddress,
+				UserAddress:  scope.UserAddress,
+				Balance:      entry.Balance.String(),
+				BlockNumber:  entry.BlockNumber,
+			})
+		}
+	}
+	if len(holdings) > 0 {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain_id"}, {Name: "token_address"}, {Name: "user_address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"balance", "block_number", "updated_at"}),
+		}).CreateInBatches(holdings, storeBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("更新代币持仓失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// tokenBalance 用户在指定链上指定代币的当前余额，没有持仓时为0
+func tokenBalance(tx *gorm.DB, chainID int64, token, address common.Address) (*big.Int, error) {
+	var holding models.Holding
+	err := tx.Where("chain_id = ? AND token_address = ? AND user_address = ?", chainID, token.Hex(), address.Hex()).
+		First(&holding).Error
+	if err == gorm.ErrRecordNotFound {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	balance, ok := new(big.Int).SetString(holding.Balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("无效的持仓余额: %s", holding.Balance)
+	}
+	return balance, nil
+}
+
+// historyBalance 用户在指定链上指定代币最新一条余额历史的余额，没有历史时为0
+func historyBalance(tx *gorm.DB, chainID int64, token, address string) (*big.Int, uint64, error) {
+	var latest models.UserBalanceHistory
+	err := tx.Where("chain_id = ? AND token_address = ? AND user_address = ?", chainID, token, address).
+		Order("block_number desc, log_index desc, id desc").
+		First(&latest).Error
+	if err == gorm.ErrRecordNotFound {
+		return new(big.Int), 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	balance, ok := new(big.Int).SetString(latest.NewBalance, 10)
+	if !ok {
+		return nil, 0, fmt.Errorf("无效的历史余额: %s", latest.NewBalance)
+	}
+	return balance, latest.BlockNumber, nil
+}
+
+// historyBalanceAt 用户在区块 blockNumber 结束时的余额，取该区块及之前最新一条余额历史，没有历史时为0
+func historyBalanceAt(tx *gorm.DB, chainID int64, token, address string, blockNumber uint64) (*big.Int, error) {
+	var latest models.UserBalanceHistory
+	err := tx.Where("chain_id = ? AND token_address = ? AND user_address = ? AND block_number <= ?", chainID, token, address, blockNumber).
+		Order("block_number desc, log_index desc, id desc").
+		First(&latest).Error
+	if err == gorm.ErrRecordNotFound {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	balance, ok := new(big.Int).SetString(latest.NewBalance, 10)
+	if !ok {
+		return nil, fmt.Errorf("无效的历史余额: %s", latest.NewBalance)
+	}
+	return balance, nil
+}
+
+// flagNegativeBalance 记录被拒绝的负余额入账，供一致性检查跟进
+func flagNegativeBalance(tx *gorm.DB, transfer *transferEvent, cause error) {
+	issue := models.ConsistencyIssue{
+		Type:        "negative_balance",
+		Severity:    "high",
+		Description: cause.Error(),
+		UserAddress: transfer.From.Hex(),
+		Data: map[string]interface{}{
+			"chain_id":     transfer.ChainID,
+			"token":        transfer.Token.Hex(),
+			"tx_hash":      transfer.TxHash,
+			"log_index":    transfer.LogIndex,
+			"block_number": transfer.BlockNumber,
+			"from":         transfer.From.Hex(),
+			"to":           transfer.To.Hex(),
+			"amount":       transfer.Amount.String(),
+		},
+		Status: "open",
+	}
+
+	if err := tx.Create(&issue).Error; err != nil {
+		middleware.Error("记录负余额问题失败: %v", err)
+	}
+}
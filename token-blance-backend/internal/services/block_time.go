@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// resolveBlockTimes 获取日志所在区块的链上时间戳
+//
+// 每个区块只查询一次：优先使用 chain_blocks 中已缓存且哈希一致的时间戳，
+// 缺失时按区块哈希请求区块头。返回的时间戳随后由 recordChainBlocks 写回缓存。
+func resolveBlockTimes(ctx context.Context, db *gorm.DB, client ChainBackend, chainID int64, logs []types.Log) (map[uint64]time.Time, error) {
+	blockTimes := make(map[uint64]time.Time)
+	if len(logs) == 0 {
+		return blockTimes, nil
+	}
+
+	hashes := make(map[uint64]string)
+	numbers := make([]uint64, 0)
+	for _, log := range logs {
+		if _, ok := hashes[log.BlockNumber]; ok {
+			continue
+		}
+		hashes[log.BlockNumber] = log.BlockHash.Hex()
+		numbers = append(numbers, log.BlockNumber)
+	}
+
+	var cached []models.ChainBlock
+	err := db.Where("chain_id = ? AND block_number IN ? AND block_time IS NOT NULL", chainID, numbers).
+		Find(&cached).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询区块时间缓存失败: %v", err)
+	}
+	for _, block := range cached {
+		if block.BlockHash == hashes[block.BlockNumber] {
+			blockTimes[block.BlockNumber] = *block.BlockTime
+		}
+	}
+
+	for _, log := range logs {
+		if _, ok := blockTimes[log.BlockNumber]; ok {
+			continue
+		}
+		header, err := client.HeaderByHash(ctx, log.BlockHash)
+		if err != nil {
+			return nil, fmt.Errorf("获取区块 %d 头信息失败: %w", log.BlockNumber, err)
+		}
+		blockTimes[log.BlockNumber] = headerTime(header)
+	}
+
+	return blockTimes, nil
+}
+
+// headerTime 区块头中的链上时间戳
+func headerTime(header *types.Header) time.Time {
+	return time.Unix(int64(header.Time), 0)
+}
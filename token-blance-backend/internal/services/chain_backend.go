@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ChainBackend 索引器访问链的接口
+//
+// 同步、重组检测、区块时间和合约只读调用都只依赖这个接口：
+// 线上由 RPCPool (多个 ethclient 端点) 实现，离线演示和本地验证由
+// SimulatedChain (go-ethereum 内存模拟链) 实现，两者走完全相同的入账流程。
+type ChainBackend interface {
+	// ChainID 获取链ID
+	ChainID(ctx context.Context) (*big.Int, error)
+	// HeaderByNumber 获取区块头，number 为 nil 时获取最新区块
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	// HeaderByHash 按区块哈希获取区块头
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	// FilterLogs 查询日志
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	// CallContract 执行 eth_call，blockNumber 为 nil 时使用最新区块
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	// Close 释放连接
+	Close()
+}
+
+var (
+	_ ChainBackend = (*RPCPool)(nil)
+	_ ChainBackend = (*SimulatedChain)(nil)
+)
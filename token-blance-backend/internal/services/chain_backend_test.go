@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var _ ChainBackend = (*stubChain)(nil)
+
+// stubChain 由测试函数决定结果的 ChainBackend，未设置的方法返回 ethereum.NotFound
+type stubChain struct {
+	headerByNumber func(number *big.Int) (*types.Header, error)
+	filterLogs     func(query ethereum.FilterQuery) ([]types.Log, error)
+}
+
+func (c *stubChain) ChainID(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
+func (c *stubChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if c.headerByNumber == nil {
+		return nil, ethereum.NotFound
+	}
+	return c.headerByNumber(number)
+}
+
+func (c *stubChain) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *stubChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if c.filterLogs == nil {
+		return nil, ethereum.NotFound
+	}
+	return c.filterLogs(query)
+}
+
+func (c *stubChain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *stubChain) Close() {}
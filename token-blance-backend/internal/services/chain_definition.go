@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrChainNotFound 链未定义
+var ErrChainNotFound = errors.New("链不存在")
+
+// ChainDefinitionInput 新增或修改链定义的参数，修改时只更新非空字段
+type ChainDefinitionInput struct {
+	Name               string   `json:"name"`                // 链名称，创建后不能修改
+	DisplayName        string   `json:"display_name"`        // 显示名称
+	ChainID            int64    `json:"chain_id"`            // 链ID，创建后不能修改
+	RPCURLs            []string `json:"rpc_urls"`            // RPC端点
+	WSURL              *string  `json:"ws_url"`              // WebSocket端点，空字符串表示只使用轮询
+	Contracts          []string `json:"contracts"`           // 代币合约地址
+	StartBlock         *uint64  `json:"start_block"`         // 合约部署区块
+	Finality           string   `json:"finality"`            // 确认策略: depth、safe 或 finalized
+	ConfirmationBlocks *uint64  `json:"confirmation_blocks"` // depth 策略的确认区块数，默认6
+	Enabled            *bool    `json:"enabled"`             // 服务启动时是否自动监听，默认启用
+}
+
+// seedChainDefinitions 把 .env 中的链配置写入链定义表，已存在的链不做修改
+func seedChainDefinitions(db *gorm.DB, cfg *config.Config) error {
+	for name, chain := range cfg.GetSupportedChains() {
+		definition := models.ChainDefinition{
+			Name:               name,
+			DisplayName:        chain.Name,
+			ChainID:            chain.ChainID,
+			RPCURLs:            chain.RPCURLs,
+			WSURL:              chain.WSURL,
+			StartBlock:         chain.StartBlock,
+			Finality:           newFinalityPolicy(name, chain.Finality, chain.ConfirmationBlocks).Mode,
+			ConfirmationBlocks: chain.ConfirmationBlocks,
+			Enabled:            chain.Enabled,
+		}
+		if common.IsHexAddress(chain.ContractAddr) {
+			definition.Contracts = []string{common.HexToAddress(chain.ContractAddr).Hex()}
+		}
+
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&definition)
+		if result.Error != nil {
+			return fmt.Errorf("初始化链 %s 的定义失败: %v", name, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			middleware.Info("🌐 已从配置初始化链定义: %s (ChainID: %d)", name, chain.ChainID)
+		}
+	}
+	return nil
+}
+
+// loadChainConfigs 读取所有链定义 (首次读取前用 .env 中的配置初始化)
+//
+// 多链服务、历史回填和代币登记共用这份配置，管理接口的修改对它们同时生效。
+func loadChainConfigs(db *gorm.DB, cfg *config.Config) (map[string]config.ChainConfig, error) {
+	if err := seedChainDefinitions(db, cfg); err != nil {
+		return nil, err
+	}
+
+	var definitions []models.ChainDefinition
+	if err := db.Order("id asc").Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+
+	chains := make(map[string]config.ChainConfig, len(definitions))
+	for _, definition := range definitions {
+		chains[definition.Name] = chainConfigFromDefinition(definition)
+	}
+	return chains, nil
+}
+
+// chainConfigFromDefinition 把链定义转换为链配置，ContractAddr 为第一个合约
+func chainConfigFromDefinition(definition models.ChainDefinition) config.ChainConfig {
+	chain := config.ChainConfig{
+		Name:               definition.DisplayName,
+		RPCURLs:            definition.RPCURLs,
+		WSURL:              definition.WSURL,
+		ChainID:            definition.ChainID,
+		Enabled:            definition.Enabled,
+		StartBlock:         definition.StartBlock,
+		Finality:           definition.Finality,
+		ConfirmationBlocks: definition.ConfirmationBlocks,
+	}
+	if len(definition.RPCURLs) > 0 {
+		chain.RPCURL = definition.RPCURLs[0]
+	}
+	if len(definition.Contracts) > 0 {
+		chain.ContractAddr = definition.Contracts[0]
+	}
+	return chain
+}
+
+// getChainDefinition 按名称读取链定义
+func getChainDefinition(db *gorm.DB, name string) (*models.ChainDefinition, error) {
+	var definition models.ChainDefinition
+	err := db.Where("name = ?", name).First(&definition).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrChainNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// applyChainDefinitionInput 把输入中的非空字段写入链定义并校验结果
+func applyChainDefinitionInput(definition *models.ChainDefinition, input ChainDefinitionInput) error {
+	if displayName := strings.TrimSpace(input.DisplayName); displayName != "" {
+		definition.DisplayName = displayName
+	}
+	if input.RPCURLs != nil {
+		definition.RPCURLs = cleanList(input.RPCURLs)
+	}
+	if input.WSURL != nil {
+		definition.WSURL = strings.TrimSpace(*input.WSURL)
+	}
+	if input.Contracts != nil {
+		contracts := make([]string, 0, len(input.Contracts))
+		for _, contract := range cleanList(input.Contracts) {
+			if !common.IsHexAddress(contract) {
+				return fmt.Errorf("无效的合约地址: %s", contract)
+			}
+			contracts = append(contracts, common.HexToAddress(contract).Hex())
+		}
+		definition.Contracts = contracts
+	}
+	if input.StartBlock != nil {
+		definition.StartBlock = *input.StartBlock
+	}
+	if finality := strings.ToLower(strings.TrimSpace(input.Finality)); finality != "" {
+		if finality != finalityDepth && finality != finalitySafe && finality != finalityFinalized {
+			return fmt.Errorf("无效的确认策略: %s (可选 depth、safe、finalized)", input.Finality)
+		}
+		definition.Finality = finality
+	}
+	if input.ConfirmationBlocks != nil {
+		definition.ConfirmationBlocks = *input.ConfirmationBlocks
+	}
+	if input.Enabled != nil {
+		definition.Enabled = *input.Enabled
+	}
+
+	if len(definition.RPCURLs) == 0 {
+		return fmt.Errorf("链 %s 至少需要一个RPC端点", definition.Name)
+	}
+	return nil
+}
+
+// cleanList 去掉空白项
+func cleanList(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// sortedChainNames 按名称排序的链名称
+func sortedChainNames(chains map[string]config.ChainConfig) []string {
+	names := make([]string, 0, len(chains))
+	for name := range chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
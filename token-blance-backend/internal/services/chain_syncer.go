@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// defaultBlockRange 初始的每次处理区块数，之后根据 RPC 的响应自适应调整
+const defaultBlockRange = uint64(100)
+
+// chainSyncer 单条链的区块同步器
+//
+// 单链事件服务、多链服务和历史回填共用同一套流程：从同步游标读取下一段按确认策略已确认的区块，
+// 比对父哈希检测重组，查询已登记代币的 Transfer 日志，并把事件、区块哈希和游标在同一事务中提交。
+// 获取、解码和写入分为流水线的三个阶段，见 pipeline.go。
+type chainSyncer struct {
+	db         *gorm.DB
+	client     ChainBackend
+	chainName  string // 同步游标使用的链名称 (chain_sync_status.chain_name)
+	chainID    int64
+	startBlock uint64 // 合约部署区块，游标落后于它时从这里开始 (已登记代币的起始区块优先)
+	finality   finalityPolicy
+
+	// decode 把一条日志解码为事件和余额变动，会被多个 goroutine 同时调用
+	decode func(log *types.Log, blockTime time.Time) decodedLog
+
+	prefetched    *prefetchedRange // 后台预取的下一段区块
+	metadataTried map[string]bool  // 本同步器已尝试读取元数据的代币，读取失败时不在每次轮询中重试
+}
+
+// syncResult 一次同步的结果
+type syncResult struct {
+	FromBlock   uint64
+	ToBlock     uint64
+	LastBlock   uint64 // 本次同步后游标所在区块
+	SafeBlock   uint64 // 已确认的安全高度
+	LatestBlock uint64
+	Events      int
+	Saved       int
+	CaughtUp    bool // 已追上安全高度，没有新的区块需要处理，或者被死信阻塞，或者需要等待 RetryAfter 后再同步
+
+	BlockedBy  *models.DeadLetter // 阻塞游标的未处理死信，游标停在它的前一个区块
+	RetryAfter time.Duration      // 链头正在切换或游标被其他监听者推进，游标没有前进，等待这段时间后再同步
+}
+
+// syncRetryDelay 链头正在切换或游标被其他监听者推进时，再次同步前的等待时间
+const syncRetryDelay = 3 * time.Second
+
+// syncNext 从同步游标开始处理下一段已确认的区块
+//
+// 事件写入和游标推进在同一个数据库事务中完成，重启后从 chain_sync_status
+// 中记录的最后处理区块继续，不会跳过停机期间的事件。
+// 失败时把错误写入 chain_sync_status.last_error，成功后清零连续失败次数。
+func (s *chainSyncer) syncNext(ctx context.Context) (*syncResult, error) {
+	result, err := s.syncRange(ctx)
+	if err != nil {
+		if recordErr := recordSyncError(s.db, s.chainName, err); recordErr != nil {
+			middleware.Warn("⚠️ 记录 %s 同步错误失败: %v", s.chainName, recordErr)
+		}
+		return nil, err
+	}
+	if err := clearSyncError(s.db, s.chainName); err != nil {
+		middleware.Warn("⚠️ 清除 %s 同步错误失败: %v", s.chainName, err)
+	}
+	return result, nil
+}
+
+// syncRange 处理下一段已确认的区块
+func (s *chainSyncer) syncRange(ctx context.Context) (*syncResult, error) {
+	// 获取最新区块
+	header, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 最新区块失败: %w", s.chainName, err)
+	}
+
+	currentBlockNumber := header.Number.Uint64()
+
+	// 按链的确认策略计算可以处理到的最高区块，确保区块链不会回滚
+	safeLatestBlock, err := s.finality.safeHead(ctx, s.client, currentBlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 已确认高度失败 (策略 %s): %w", s.chainName, s.finality, err)
+	}
+
+	// 读取持久化的同步游标
+	cursor, err := loadSyncCursor(s.db, s.chainName, s.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 同步游标失败: %v", s.chainName, err)
+	}
+
+	result := &syncResult{
+		LastBlock:   cursor.LastBlock,
+		SafeBlock:   safeLatestBlock,
+		LatestBlock: currentBlockNumber,
+	}
+
+	// 游标之后有未处理的死信时，等到它的重试时间才重新处理，游标不会越过它
+	deadLetter, err := pendingDeadLetter(s.db, s.chainID, cursor.LastBlock)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 死信失败: %v", s.chainName, err)
+	}
+	if deadLetter != nil && time.Now().Before(deadLetter.NextRetryAt) {
+		middleware.Debug("⏸️ %s 被死信 %d 阻塞在区块 %d，%s 后重试",
+			s.chainName, deadLetter.ID, deadLetter.BlockNumber, deadLetter.NextRetryAt.Format(time.RFC3339))
+		result.CaughtUp = true
+		result.BlockedBy = deadLetter
+		return result, updateLatestBlock(s.db, s.chainName, cursor.LastBlock, currentBlockNumber)
+	}
+
+	// 只处理已登记且启用的代币，没有代币时不推进游标，登记后从游标继续
+	tokens, err := enabledTokens(s.db, s.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 已登记代币失败: %v", s.chainName, err)
+	}
+	if len(tokens) == 0 {
+		middleware.Debug("📭 %s 没有已启用的代币，暂停同步", s.chainName)
+		result.CaughtUp = true
+		return result, updateLatestBlock(s.db, s.chainName, cursor.LastBlock, currentBlockNumber)
+	}
+	s.loadTokenMetadata(ctx, tokens)
+	addresses, startBlock := tokenFilter(tokens, s.startBlock)
+
+	// 落后较多时分多次追赶，每次的区块范围按链记录并自适应调整
+	blockRange := cursor.BlockRange
+	if blockRange == 0 {
+		blockRange = defaultBlockRange
+	}
+	fromBlock, toBlock, ok := nextSyncRange(cursor.LastBlock, startBlock, safeLatestBlock, blockRange)
+	if !ok {
+		middleware.Debug("📭 %s 没有新的安全区块需要处理 (已处理到 %d, 安全高度 %d)", s.chainName, cursor.LastBlock, safeLatestBlock)
+		result.CaughtUp = true
+		return result, updateLatestBlock(s.db, s.chainName, cursor.LastBlock, currentBlockNumber)
+	}
+	result.FromBlock = fromBlock
+
+	query := ethereum.FilterQuery{
+		Addresses: addresses,
+		Topics:    [][]common.Hash{{transferEventSig}},
+	}
+
+	if safeLatestBlock < currentBlockNumber {
+		middleware.Debug("🛡️  %s 安全模式：查询到区块 %d (当前最新 %d，确认策略 %s，延迟 %d 个区块)",
+			s.chainName, toBlock, currentBlockNumber, s.finality, currentBlockNumber-safeLatestBlock)
+	}
+
+	// 获取阶段：优先使用上一次在后台预取的结果
+	fetched := s.takePrefetch(ctx, query, fromBlock, safeLatestBlock)
+	if fetched == nil {
+		fetched, err = s.fetchRange(ctx, query, fromBlock, toBlock)
+	}
+
+	// 范围或结果数超限时折半重试，成功后逐步扩大
+	nextRange := blockRange
+	switch {
+	case fetched.UsedRange < fetched.Requested:
+		// 缩小后的范围即使最终查询失败也记录下来，下次不再重复试探
+		nextRange = fetched.UsedRange
+	case err == nil && fetched.Requested == blockRange:
+		nextRange = growBlockRange(blockRange)
+	}
+	if nextRange != blockRange {
+		if saveErr := saveBlockRange(s.db, s.chainName, nextRange); saveErr != nil {
+			middleware.Warn("⚠️ %v", saveErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	toBlock = fetched.ToBlock
+	result.ToBlock = toBlock
+	result.Events = len(fetched.Logs)
+
+	// 比对父哈希，检查已处理的区块是否被重组替换
+	if fromBlock == cursor.LastBlock+1 {
+		reorg, err := checkChainReorg(ctx, s.db, s.client, s.chainName, s.chainID, cursor, fetched.FromHeader)
+		if err != nil {
+			return nil, fmt.Errorf("检测 %s 链重组失败: %w", s.chainName, err)
+		}
+		switch reorg {
+		case reorgPending:
+			// 游标没有前进，立即重试只会重复同样的 RPC 请求
+			s.prefetched = nil
+			result.CaughtUp = true
+			result.RetryAfter = syncRetryDelay
+			return result, nil
+		case reorgRolledBack:
+			s.prefetched = nil
+			return result, nil
+		}
+	}
+
+	// 写入本段的同时在后台获取下一段
+	if toBlock < safeLatestBlock {
+		nextTo := safeLatestBlock
+		if nextTo-toBlock > nextRange {
+			nextTo = toBlock + nextRange
+		}
+		s.startPrefetch(query, toBlock+1, nextTo)
+	}
+
+	// 解码阶段
+	decoded := decodeLogs(fetched.Logs, fetched.BlockTimes, s.decode)
+
+	// 写入阶段：按区块分批提交，每批与区块哈希和游标在同一事务中提交
+	batches := blockBatches(fetched.Logs)
+	for i, batch := range batches {
+		logs := fetched.Logs[batch.Start:batch.End]
+		batchTo := toBlock
+		head := fetched.ToHeader
+		if i < len(batches)-1 {
+			// 中间批次只推进到批次内最后一个区块，它的哈希从日志中取得
+			batchTo = logs[len(logs)-1].BlockNumber
+			head = nil
+		}
+
+		saved, deadLetter, err := s.persistBatch(cursor, fromBlock, batchTo, currentBlockNumber, head, logs, decoded[batch.Start:batch.End], fetched.BlockTimes)
+		if errors.Is(err, errSyncCursorMoved) {
+			s.prefetched = nil
+			middleware.Warn("⚠️ %s 区块 %d - %d 已被其他监听者处理，放弃本次结果", s.chainName, cursor.LastBlock+1, batchTo)
+			result.CaughtUp = true
+			result.RetryAfter = syncRetryDelay
+			return result, nil
+		}
+		if err != nil {
+			s.prefetched = nil
+			return nil, fmt.Errorf("提交 %s 区块 %d - %d 的事件失败: %w", s.chainName, cursor.LastBlock+1, batchTo, err)
+		}
+		result.Saved += saved
+		result.LastBlock = cursor.LastBlock
+		if deadLetter != nil {
+			// 之后的区块等死信重试成功或被丢弃后再处理
+			s.prefetched = nil
+			s.recordCursorBlock(ctx, cursor.LastBlock)
+			middleware.Error("❌ %s 事件入账失败，已记入死信 %d (第 %d 次): TX=%s, LogIndex=%d: %s",
+				s.chainName, deadLetter.ID, deadLetter.Attempts, deadLetter.TxHash, deadLetter.LogIndex, deadLetter.Error)
+			middleware.Warn("⏸️ %s 游标停在区块 %d，%s 后重试", s.chainName, cursor.LastBlock, deadLetter.NextRetryAt.Format(time.RFC3339))
+			result.CaughtUp = true
+			result.BlockedBy = deadLetter
+			return result, nil
+		}
+	}
+
+	if len(fetched.Logs) > 0 {
+		middleware.Info("📊 %s 查询到 %d 个Transfer事件 (区块范围: %d - %d)", s.chainName, len(fetched.Logs), fromBlock, toBlock)
+		middleware.Info("✅ %s 成功处理 %d/%d 个事件", s.chainName, result.Saved, len(fetched.Logs))
+	} else {
+		middleware.Debug("📭 %s 区块 %d - %d 内没有Transfer事件", s.chainName, fromBlock, toBlock)
+	}
+
+	return result, nil
+}
+
+// persistBatch 在一个事务中写入一批日志，记录区块哈希并把游标推进到 batchTo
+//
+// head 为本段最后一个区块头，只在最后一批时传入；提交成功后更新内存中的游标，
+// 下一批以它作为乐观锁。本批原始日志全部归档到 raw_logs，被管理员丢弃的死信日志直接跳过。有日志入账失败时记入死信并返回，
+// 游标只推进到失败日志的前一个区块；全部成功时之前的死信标记为重试成功。
+// 事务先锁定游标再写入，与回放交换的加锁顺序一致 (见 lockSyncCursor)。
+func (s *chainSyncer) persistBatch(cursor *models.ChainSyncStatus, fromBlock, batchTo, latestBlock uint64, head *types.Header, logs []types.Log, events []decodedLog, blockTimes map[uint64]time.Time) (int, *models.DeadLetter, error) {
+	saved := 0
+	lastBlock := batchTo
+	var deadLetter *models.DeadLetter
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSyncCursor(tx, s.chainName); err != nil {
+			return err
+		}
+		// 原始日志与是否入账无关，整批归档
+		if err := archiveRawLogs(tx, s.chainID, logs, events); err != nil {
+			return err
+		}
+		events, err := skipDiscarded(tx, s.chainID, events)
+		if err != nil {
+			return err
+		}
+		stored, rejected, err := storeEventBatch(tx, events)
+		if err != nil {
+			return err
+		}
+		saved = stored
+
+		if rejected != nil {
+			deadLetter, err = recordDeadLetter(tx, s.chainName, logs, rejected)
+			if err != nil {
+				return err
+			}
+			// 失败日志所在区块及之后的区块不记录哈希，下次从该区块重新处理
+			lastBlock = rejected.Log.EventLog.BlockNumber - 1
+			head = nil
+			logs = logsBefore(logs, rejected.Log.EventLog.BlockNumber)
+		} else if err := resolveDeadLetters(tx, s.chainID, batchTo); err != nil {
+			return err
+		}
+
+		if err := recordChainBlocks(tx, s.chainID, head, logs, blockTimes); err != nil {
+			return err
+		}
+		if lastBlock <= cursor.LastBlock {
+			// 失败的日志就在游标的下一个区块，游标不动
+			return nil
+		}
+		return advanceSyncCursor(tx, cursor, fromBlock, lastBlock, latestBlock)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if lastBlock > cursor.LastBlock {
+		if cursor.StartBlock == 0 {
+			cursor.StartBlock = fromBlock
+		}
+		cursor.LastBlock = lastBlock
+	}
+	return saved, deadLetter, nil
+}
+
+// recordCursorBlock 记录游标所在区块的哈希，供下一次同步比对父哈希
+//
+// 被死信阻塞时游标停在批次中间，这个区块可能没有日志，哈希需要单独获取。失败时只记录警告，
+// 缺少哈希的区块不做重组检测。
+func (s *chainSyncer) recordCursorBlock(ctx context.Context, blockNumber uint64) {
+	if blockNumber == 0 {
+		return
+	}
+	header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err == nil {
+		err = recordChainBlocks(s.db, s.chainID, header, nil, nil)
+	}
+	if err != nil {
+		middleware.Warn("⚠️ 记录 %s 区块 %d 的哈希失败: %v", s.chainName, blockNumber, err)
+	}
+}
+
+// logsBefore 区块 blockNumber 之前的日志 (logs 按区块排序)
+func logsBefore(logs []types.Log, blockNumber uint64) []types.Log {
+	for i, log := range logs {
+		if log.BlockNumber >= blockNumber {
+			return logs[:i]
+		}
+	}
+	return logs
+}
+
+// loadTokenMetadata 为尚未读取元数据的代币读取 decimals()、symbol()、name() 和 getContractInfo()
+//
+// 每个代币在同步器的生命周期内只尝试一次，失败时记录警告，可以通过管理接口重新读取。
+func (s *chainSyncer) loadTokenMetadata(ctx context.Context, tokens []models.Token) {
+	for i := range tokens {
+		token := &tokens[i]
+		if token.MetadataUpdatedAt != nil || s.metadataTried[token.Address] {
+			continue
+		}
+		if s.metadataTried == nil {
+			s.metadataTried = make(map[string]bool)
+		}
+		s.metadataTried[token.Address] = true
+
+		if err := refreshTokenMetadata(ctx, s.db, s.client, token); err != nil {
+			middleware.Warn("⚠️ %s %v", s.chainName, err)
+		}
+	}
+}
+
+// tokenFilter 代币地址列表和同步起始区块 (所有代币中最早的起始区块，未设置时使用 fallback)
+func tokenFilter(tokens []models.Token, fallback uint64) ([]common.Address, uint64) {
+	addresses := make([]common.Address, 0, len(tokens))
+	startBlock := uint64(0)
+	for _, token := range tokens {
+		addresses = append(addresses, common.HexToAddress(token.Address))
+		if token.StartBlock > 0 && (startBlock == 0 || token.StartBlock < startBlock) {
+			startBlock = token.StartBlock
+		}
+	}
+	if startBlock == 0 {
+		startBlock = fallback
+	}
+	return addresses, startBlock
+}
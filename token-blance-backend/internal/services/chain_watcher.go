@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+	"token-balance/internal/middleware"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// pollInterval 轮询模式下的检查间隔
+	pollInterval = 15 * time.Second
+	// resubscribeInterval 订阅断开后重新订阅的间隔
+	resubscribeInterval = 30 * time.Second
+	// maxCatchUpRanges 每次触发最多连续同步的区块段数，避免长时间阻塞停止信号
+	maxCatchUpRanges = 20
+)
+
+// 链事件的接入模式
+const (
+	ingestModePolling   = "polling"
+	ingestModeWebSocket = "websocket"
+)
+
+// chainWatcher 驱动单条链的同步
+//
+// 配置了 ws:// 端点时订阅新区块头，每个新区块立即触发一次同步，延迟接近出块时间；
+// 同步仍然通过 chainSyncer 只处理确认深度之前的区块。订阅断开时回退为15秒轮询，
+// 并定期尝试重新订阅，重连后立即从同步游标追赶断开期间的区块。
+type chainWatcher struct {
+	syncer *chainSyncer
+	wsURL  string
+
+	wsClient   *ethclient.Client
+	sub        ethereum.Subscription
+	heads      chan *types.Header
+	subscribed atomic.Bool
+}
+
+// newChainWatcher 创建链同步驱动，wsURL 为空时只使用轮询
+func newChainWatcher(syncer *chainSyncer, wsURL string) *chainWatcher {
+	return &chainWatcher{
+		syncer: syncer,
+		wsURL:  wsURL,
+		heads:  make(chan *types.Header, 16),
+	}
+}
+
+// Mode 当前的接入模式
+func (w *chainWatcher) Mode() string {
+	if w.subscribed.Load() {
+		return ingestModeWebSocket
+	}
+	return ingestModePolling
+}
+
+// run 运行同步循环直到 stop 关闭 (stop 为 nil 时一直运行)
+func (w *chainWatcher) run(stop <-chan struct{}) {
+	pollTicker := time.NewTicker(pollInterval)
+	defer pollTicker.Stop()
+	retryTicker := time.NewTicker(resubscribeInterval)
+	defer retryTicker.Stop()
+	defer w.unsubscribe()
+
+	if w.wsURL != "" {
+		w.subscribe()
+	}
+	w.catchUp()
+
+	for {
+		var subErr <-chan error
+		if w.sub != nil {
+			subErr = w.sub.Err()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-w.heads:
+			w.drainHeads()
+			w.catchUp()
+		case err := <-subErr:
+			middleware.Warn("⚠️ %s 新区块订阅断开，回退为轮询: %v", w.syncer.chainName, err)
+			w.unsubscribe()
+		case <-pollTicker.C:
+			if w.sub == nil {
+				w.catchUp()
+			}
+		case <-retryTicker.C:
+			if w.wsURL != "" && w.sub == nil && w.subscribe() {
+				// 补齐订阅断开期间的区块
+				w.catchUp()
+			}
+		}
+	}
+}
+
+// subscribe 连接 WebSocket 端点并订阅新区块头
+func (w *chainWatcher) subscribe() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := ethclient.DialContext(ctx, w.wsURL)
+	if err != nil {
+		middleware.Warn("⚠️ %s 连接 WebSocket 失败，使用轮询: %v", w.syncer.chainName, err)
+		return false
+	}
+
+	sub, err := client.SubscribeNewHead(context.Background(), w.heads)
+	if err != nil {
+		client.Close()
+		middleware.Warn("⚠️ %s 订阅新区块失败，使用轮询: %v", w.syncer.chainName, err)
+		return false
+	}
+
+	w.wsClient = client
+	w.sub = sub
+	w.subscribed.Store(true)
+	middleware.Info("📡 %s 已订阅新区块 (WebSocket)", w.syncer.chainName)
+	return true
+}
+
+// unsubscribe 取消订阅并关闭 WebSocket 连接
+func (w *chainWatcher) unsubscribe() {
+	if w.sub != nil {
+		w.sub.Unsubscribe()
+		w.sub = nil
+	}
+	if w.wsClient != nil {
+		w.wsClient.Close()
+		w.wsClient = nil
+	}
+	w.subscribed.Store(false)
+}
+
+// drainHeads 丢弃已排队的区块头，一次同步会处理到最新的安全高度
+func (w *chainWatcher) drainHeads() {
+	for {
+		select {
+		case <-w.heads:
+		default:
+			return
+		}
+	}
+}
+
+// catchUp 连续同步区块段直到追上安全高度
+func (w *chainWatcher) catchUp() {
+	for i := 0; i < maxCatchUpRanges; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, err := w.syncer.syncNext(ctx)
+		cancel()
+		if err != nil {
+			middleware.Error("❌ %v", err)
+			return
+		}
+		if result.CaughtUp {
+			return
+		}
+	}
+}
@@ -71,49 +71,54 @@ func (cs *ConsistencyService) checkBalanceConsistency() []models.ConsistencyIssu
 
 	middleware.Debug("🔍 检查用户余额一致性...")
 
-	// 查找余额为负数的用户
-	var negativeBalanceUsers []models.User
-	err := cs.db.Where("balance < ?", "0").Find(&negativeBalanceUsers).Error
+	// 查找余额为负数的持仓
+	var negativeHoldings []models.Holding
+	err := cs.db.Where("balance LIKE ?", "-%").Find(&negativeHoldings).Error
 	if err != nil {
-		middleware.Error("查询负余额用户失败: %v", err)
+		middleware.Error("查询负余额持仓失败: %v", err)
 		return issues
 	}
 
-	for _, user := range negativeBalanceUsers {
+	for _, holding := range negativeHoldings {
 		issue := models.ConsistencyIssue{
 			Type:        "negative_balance",
 			Severity:    "high",
-			Description: fmt.Sprintf("用户 %s 余额为负数: %s", user.ID, user.Balance),
-			UserAddress: user.ID,
+			Description: fmt.Sprintf("用户 %s 在链 %d 代币 %s 的余额为负数: %s",
+				holding.UserAddress, holding.ChainID, holding.TokenAddress, holding.Balance),
+			UserAddress: holding.UserAddress,
 			Data: map[string]interface{}{
-				"balance": user.Balance,
-				"user_id": user.ID,
+				"chain_id": holding.ChainID,
+				"token":    holding.TokenAddress,
+				"balance":  holding.Balance,
+				"user_id":  holding.UserAddress,
 			},
 		}
 		issues = append(issues, issue)
 	}
 
-	// 检查余额历史与当前余额的一致性
-	var users []models.User
-	cs.db.Find(&users)
+	// 检查每个持仓与该 (链, 代币) 最新一条余额历史的一致性
+	var holdings []models.Holding
+	cs.db.Find(&holdings)
 
-	for _, user := range users {
-		var latestHistory models.UserBalanceHistory
-		err := cs.db.Where("user_address = ?", user.ID).
-			Order("timestamp desc").
-			First(&latestHistory).Error
+	for _, holding := range holdings {
+		expected, _, err := historyBalance(cs.db, holding.ChainID, holding.TokenAddress, holding.UserAddress)
+		if err != nil {
+			middleware.Error("查询持仓 %s/%s 余额历史失败: %v", holding.TokenAddress, holding.UserAddress, err)
+			continue
+		}
 
-		if err == nil && latestHistory.NewBalance != user.Balance {
+		if expected.String() != holding.Balance {
 			issue := models.ConsistencyIssue{
-				Type:        "balance_mismatch",
+				Type:        "holding_mismatch",
 				Severity:    "medium",
-				Description: fmt.Sprintf("用户 %s 当前余额与历史记录不符: 当前=%s, 历史=%s", 
-					user.ID, user.Balance, latestHistory.NewBalance),
-				UserAddress: user.ID,
+				Description: fmt.Sprintf("用户 %s 在链 %d 代币 %s 的持仓与历史记录不符: 当前=%s, 历史=%s",
+					holding.UserAddress, holding.ChainID, holding.TokenAddress, holding.Balance, expected.String()),
+				UserAddress: holding.UserAddress,
 				Data: map[string]interface{}{
-					"current_balance": user.Balance,
-					"history_balance": latestHistory.NewBalance,
-					"last_updated":   latestHistory.Timestamp,
+					"chain_id":        holding.ChainID,
+					"token":           holding.TokenAddress,
+					"current_balance": holding.Balance,
+					"history_balance": expected.String(),
 				},
 			}
 			issues = append(issues, issue)
@@ -201,15 +206,21 @@ func (cs *ConsistencyService) checkHistoryConsistency() []models.ConsistencyIssu
 
 	middleware.Debug("🔍 检查历史记录完整性...")
 
-	// 检查重复的交易哈希
+	// 检查重复的余额变动记录
+	// 同一笔交易可以有多条日志、每条日志有发送方和接收方两条记录，
+	// 因此按 (chain_id, tx_hash, log_index, user_address, change_type) 判断重复
 	var duplicateTxs []struct {
-		TxHash  string `json:"tx_hash"`
-		Count    int    `json:"count"`
+		ChainID     int64  `json:"chain_id"`
+		TxHash      string `json:"tx_hash"`
+		LogIndex    uint   `json:"log_index"`
+		UserAddress string `json:"user_address"`
+		ChangeType  string `json:"change_type"`
+		Count       int    `json:"count"`
 	}
 
 	err := cs.db.Table("user_balance_history").
-		Select("tx_hash, COUNT(*) as count").
-		Group("tx_hash").
+		Select("chain_id, tx_hash, log_index, user_address, change_type, COUNT(*) as count").
+		Group("chain_id, tx_hash, log_index, user_address, change_type").
 		Having("COUNT(*) > ?", 1).
 		Scan(&duplicateTxs).Error
 
@@ -222,9 +233,13 @@ func (cs *ConsistencyService) checkHistoryConsistency() []models.ConsistencyIssu
 		issue := models.ConsistencyIssue{
 			Type:        "duplicate_transactions",
 			Severity:    "medium",
-			Description: fmt.Sprintf("发现重复的交易哈希: %s (重复 %d 次)", dup.TxHash, dup.Count),
+			Description: fmt.Sprintf("发现重复的余额变动记录: %s#%d (重复 %d 次)", dup.TxHash, dup.LogIndex, dup.Count),
+			UserAddress: dup.UserAddress,
 			Data: map[string]interface{}{
-				"tx_hash":     dup.TxHash,
+				"chain_id":        dup.ChainID,
+				"tx_hash":         dup.TxHash,
+				"log_index":       dup.LogIndex,
+				"change_type":     dup.ChangeType,
 				"duplicate_count": dup.Count,
 			},
 		}
@@ -236,7 +251,9 @@ func (cs *ConsistencyService) checkHistoryConsistency() []models.ConsistencyIssu
 	err = cs.db.Raw(`
 		SELECT h1.* FROM user_balance_history h1
 		INNER JOIN user_balance_history h2 ON h1.user_address = h2.user_address 
-			AND h1.timestamp < h2.timestamp 
+			AND h1.chain_id = h2.chain_id
+			AND h1.token_address = h2.token_address
+			AND h1.block_number < h2.block_number 
 			AND h1.id > h2.id
 		LIMIT 100
 	`).Scan(&outOfOrderRecords).Error
@@ -288,14 +305,19 @@ func (cs *ConsistencyService) fixSingleIssue(issue models.ConsistencyIssue) bool
 	switch issue.Type {
 	case "negative_balance":
 		return cs.fixNegativeBalance(issue)
-	case "balance_mismatch":
-		return cs.fixBalanceMismatch(issue)
+	case "holding_mismatch":
+		return cs.fixHoldingMismatch(issue)
 	case "invalid_points":
 		return cs.fixInvalidPoints(issue)
 	case "points_sum_mismatch":
 		return cs.fixPointsSumMismatch(issue)
 	case "duplicate_transactions":
 		return cs.fixDuplicateTransactions(issue)
+	case onchainMismatchIssue:
+		return cs.fixOnchainMismatch(issue)
+	case supplyMismatchIssue, supplyExceedsMaxIssue:
+		middleware.Warn("⚠️ 供应量问题需要人工排查，不能自动修复: %s", issue.Description)
+		return false
 	default:
 		middleware.Warn("⚠️ 未知的问题类型: %s", issue.Type)
 		return false
@@ -308,10 +330,18 @@ func (cs *ConsistencyService) fixNegativeBalance(issue models.ConsistencyIssue)
 	if !ok {
 		return false
 	}
+	token, ok := issue.Data["token"].(string)
+	if !ok {
+		return false
+	}
+	chainID, ok := issueInt(issue.Data["chain_id"])
+	if !ok {
+		return false
+	}
 
-	// 重置用户余额为0
-	result := cs.db.Model(&models.User{}).
-		Where("id = ?", userAddr).
+	// 重置持仓余额为0
+	result := cs.db.Model(&models.Holding{}).
+		Where("chain_id = ? AND token_address = ? AND user_address = ?", chainID, token, userAddr).
 		Update("balance", "0")
 
 	if result.Error != nil {
@@ -320,32 +350,53 @@ func (cs *ConsistencyService) fixNegativeBalance(issue models.ConsistencyIssue)
 	}
 
 	// 记录修复操作
+	oldBalance, _ := issue.Data["balance"].(string)
 	history := models.UserBalanceHistory{
 		UserAddress:  userAddr,
-		OldBalance:  issue.Data["balance"].(string),
-		NewBalance:  "0",
+		TokenAddress: token,
+		OldBalance:   oldBalance,
+		NewBalance:   "0",
 		ChangeAmount: "0",
-		ChangeType:  "consistency_fix",
-		TxHash:      "CONSISTENCY_FIX_" + time.Now().Format("20060102150405"),
+		ChangeType:   "consistency_fix",
+		TxHash:       "CONSISTENCY_FIX_" + time.Now().Format("20060102150405"),
 		BlockNumber:  0,
+		ChainID:      chainID,
 		Timestamp:    time.Now(),
 	}
 
-	cs.db.Create(&history)
+	if err := cs.db.Create(&history).Error; err != nil {
+		middleware.Error("记录负余额修复失败: %v", err)
+	}
 	return true
 }
 
-// fixBalanceMismatch 修复余额不匹配问题
-func (cs *ConsistencyService) fixBalanceMismatch(issue models.ConsistencyIssue) bool {
-	userAddr := issue.UserAddress
-	historyBalance := issue.Data["history_balance"].(string)
+// fixHoldingMismatch 按余额历史恢复持仓
+func (cs *ConsistencyService) fixHoldingMismatch(issue models.ConsistencyIssue) bool {
+	token, ok := issue.Data["token"].(string)
+	if !ok {
+		return false
+	}
 
-	// 使用历史记录中的余额更新当前余额
-	result := cs.db.Model(&models.User{}).
-		Where("id = ?", userAddr).
-		Update("balance", historyBalance)
+	chainID, ok := issueInt(issue.Data["chain_id"])
+	if !ok {
+		return false
+	}
 
-	return result.Error == nil
+	scope := balanceScope{ChainID: chainID, TokenAddress: token, UserAddress: issue.UserAddress}
+	if err := restoreHolding(cs.db, scope); err != nil {
+		middleware.Error("恢复持仓失败: %v", err)
+		return false
+	}
+	return true
+}
+
+// fixOnchainMismatch 按链上余额修正持仓，写入 reconciliation 余额历史
+func (cs *ConsistencyService) fixOnchainMismatch(issue models.ConsistencyIssue) bool {
+	if err := applyReconciliation(cs.db, &issue); err != nil {
+		middleware.Error("按链上余额修正失败: %v", err)
+		return false
+	}
+	return true
 }
 
 // fixInvalidPoints 修复无效积分记录
@@ -372,15 +423,23 @@ func (cs *ConsistencyService) fixPointsSumMismatch(issue models.ConsistencyIssue
 
 // fixDuplicateTransactions 修复重复交易问题
 func (cs *ConsistencyService) fixDuplicateTransactions(issue models.ConsistencyIssue) bool {
-	txHash := issue.Data["tx_hash"].(string)
+	chainID, _ := issue.Data["chain_id"].(int64)
+	txHash, _ := issue.Data["tx_hash"].(string)
+	logIndex, _ := issue.Data["log_index"].(uint)
+	changeType, _ := issue.Data["change_type"].(string)
 
 	// 保留ID最小的记录，删除重复的
 	result := cs.db.Exec(`
 		DELETE FROM user_balance_history 
-		WHERE tx_hash = ? AND id NOT IN (
-			SELECT MIN(id) FROM user_balance_history WHERE tx_hash = ?
+		WHERE chain_id = ? AND tx_hash = ? AND log_index = ? AND user_address = ? AND change_type = ?
+		AND id NOT IN (
+			SELECT min_id FROM (
+				SELECT MIN(id) AS min_id FROM user_balance_history
+				WHERE chain_id = ? AND tx_hash = ? AND log_index = ? AND user_address = ? AND change_type = ?
+			) AS keep
 		)
-	`, txHash, txHash)
+	`, chainID, txHash, logIndex, issue.UserAddress, changeType,
+		chainID, txHash, logIndex, issue.UserAddress, changeType)
 
 	return result.Error == nil
 }
@@ -402,10 +461,22 @@ func (cs *ConsistencyService) generateRecommendations(issues []models.Consistenc
 				problemTypes["negative_balance"]))
 	}
 
-	if problemTypes["balance_mismatch"] > 0 {
-		recommendations = append(recommendations, 
-			fmt.Sprintf("发现 %d 个余额不匹配问题，建议运行余额重算工具", 
-				problemTypes["balance_mismatch"]))
+	if problemTypes["holding_mismatch"] > 0 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("发现 %d 个持仓与余额历史不符，建议按余额历史恢复持仓",
+				problemTypes["holding_mismatch"]))
+	}
+
+	if problemTypes[onchainMismatchIssue] > 0 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("发现 %d 个持仓与链上 balanceOf 不符，建议检查是否漏掉了非标准 Transfer 事件，确认后按链上余额修正",
+				problemTypes[onchainMismatchIssue]))
+	}
+
+	if supplyIssues := problemTypes[supplyMismatchIssue] + problemTypes[supplyExceedsMaxIssue]; supplyIssues > 0 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("发现 %d 个代币供应量不变量被破坏，建议先运行链上余额核对定位不一致的持有人",
+				supplyIssues))
 	}
 
 	if problemTypes["invalid_points"] > 0 {
@@ -435,10 +506,11 @@ func (cs *ConsistencyService) parseFloat(s string) float64 {
 		return 0
 	}
 	
-	result, _, err := new(big.Float).SetString(s, 10).Float64()
-	if err != nil {
+	f, ok := new(big.Float).SetString(s)
+	if !ok {
 		return 0
 	}
+	result, _ := f.Float64()
 	
 	return result
 }
\ No newline at end of file
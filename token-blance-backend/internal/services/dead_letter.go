@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	deadLetterPending   = "pending"
+	deadLetterResolved  = "resolved"
+	deadLetterDiscarded = "discarded"
+
+	// deadLetterRetryBase 第一次失败后的重试间隔，之后每次失败加倍
+	deadLetterRetryBase = time.Minute
+	// deadLetterRetryMax 重试间隔的上限
+	deadLetterRetryMax = time.Hour
+)
+
+var (
+	// ErrDeadLetterNotFound 死信不存在
+	ErrDeadLetterNotFound = errors.New("死信不存在")
+	// ErrDeadLetterClosed 死信已经重试成功或被丢弃
+	ErrDeadLetterClosed = errors.New("死信已处理")
+)
+
+// DeadLetterService 死信管理服务
+//
+// 死信由同步器在日志入账失败时写入，并按退避间隔自动重试；
+// 这里提供查询、立即重试和丢弃的管理操作。
+type DeadLetterService struct {
+	db *gorm.DB
+}
+
+// NewDeadLetterService 创建死信管理服务
+func NewDeadLetterService(db *gorm.DB) *DeadLetterService {
+	return &DeadLetterService{db: db}
+}
+
+// ListDeadLetters 按链名称和状态查询死信，按区块和日志索引排序
+func (ds *DeadLetterService) ListDeadLetters(chain, status string, limit int) ([]models.DeadLetter, error) {
+	query := ds.db.Model(&models.DeadLetter{})
+	if chain != "" {
+		query = query.Where("chain_name = ?", chain)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	letters := []models.DeadLetter{}
+	err := query.Order("chain_id, block_number, log_index").Limit(limit).Find(&letters).Error
+	return letters, err
+}
+
+// RetryDeadLetter 让同步器在下一次轮询时立即重试，不再等待退避间隔
+func (ds *DeadLetterService) RetryDeadLetter(id uint) (*models.DeadLetter, error) {
+	return ds.updatePending(id, func(tx *gorm.DB, letter *models.DeadLetter) error {
+		letter.NextRetryAt = time.Now()
+		middleware.Info("🔁 死信 %d (%s 区块 %d, TX=%s, LogIndex=%d) 将在下一次轮询时重试",
+			letter.ID, letter.ChainName, letter.BlockNumber, letter.TxHash, letter.LogIndex)
+		return tx.Model(letter).Update("next_retry_at", letter.NextRetryAt).Error
+	})
+}
+
+// DiscardDeadLetter 丢弃死信，同步器之后跳过这条日志，游标可以越过它
+//
+// 被丢弃的日志不会入账，相关地址的余额可能与链上不一致，需要通过链上余额核对修正。
+func (ds *DeadLetterService) DiscardDeadLetter(id uint) (*models.DeadLetter, error) {
+	return ds.updatePending(id, func(tx *gorm.DB, letter *models.DeadLetter) error {
+		now := time.Now()
+		letter.Status = deadLetterDiscarded
+		letter.ResolvedAt = &now
+		middleware.Warn("🗑️ 死信 %d 已被丢弃: %s 区块 %d, TX=%s, LogIndex=%d",
+			letter.ID, letter.ChainName, letter.BlockNumber, letter.TxHash, letter.LogIndex)
+		return tx.Model(letter).Updates(map[string]interface{}{
+			"status":      letter.Status,
+			"resolved_at": now,
+		}).Error
+	})
+}
+
+// updatePending 锁定一条未处理的死信并执行 update
+func (ds *DeadLetterService) updatePending(id uint, update func(tx *gorm.DB, letter *models.DeadLetter) error) (*models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := ds.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&letter, id).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrDeadLetterNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if letter.Status != deadLetterPending {
+			return fmt.Errorf("%w: 状态为 %s", ErrDeadLetterClosed, letter.Status)
+		}
+		return update(tx, &letter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// recordDeadLetter 在写入事务中记录入账失败的日志
+//
+// 同一条日志再次失败时累加重试次数并按退避间隔推迟下一次重试。
+// 首次因负余额失败时额外记录一条一致性问题。
+func recordDeadLetter(tx *gorm.DB, chainName string, logs []types.Log, rejected *rejectedLog) (*models.DeadLetter, error) {
+	event := rejected.Log.EventLog
+	raw, err := rawLogJSON(logs, event.TxHash, event.LogIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var letter models.DeadLetter
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("chain_id = ? AND tx_hash = ? AND log_index = ?", event.ChainID, event.TxHash, event.LogIndex).
+		First(&letter).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("查询死信失败: %v", err)
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		letter = models.DeadLetter{
+			ChainID:       event.ChainID,
+			ChainName:     chainName,
+			TxHash:        event.TxHash,
+			LogIndex:      event.LogIndex,
+			BlockNumber:   event.BlockNumber,
+			TokenAddress:  event.ContractAddress,
+			RawLog:        raw,
+			Error:         rejected.Err.Error(),
+			Attempts:      1,
+			Status:        deadLetterPending,
+			FirstFailedAt: now,
+			LastFailedAt:  now,
+			NextRetryAt:   now.Add(deadLetterBackoff(1)),
+		}
+		if err := tx.Create(&letter).Error; err != nil {
+			return nil, fmt.Errorf("记录死信失败: %v", err)
+		}
+		if rejected.Log.Transfer != nil && errors.Is(rejected.Err, errNegativeBalance) {
+			flagNegativeBalance(tx, rejected.Log.Transfer, rejected.Err)
+		}
+		return &letter, nil
+	}
+
+	letter.RawLog = raw
+	letter.Error = rejected.Err.Error()
+	letter.Attempts++
+	letter.Status = deadLetterPending
+	letter.LastFailedAt = now
+	letter.NextRetryAt = now.Add(deadLetterBackoff(letter.Attempts))
+	letter.ResolvedAt = nil
+	if err := tx.Save(&letter).Error; err != nil {
+		return nil, fmt.Errorf("更新死信失败: %v", err)
+	}
+	return &letter, nil
+}
+
+// deadLetterBackoff 第 attempts 次失败后的重试间隔：1分钟起每次加倍，最长1小时
+func deadLetterBackoff(attempts int) time.Duration {
+	delay := deadLetterRetryBase
+	for i := 1; i < attempts && delay < deadLetterRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > deadLetterRetryMax {
+		delay = deadLetterRetryMax
+	}
+	return delay
+}
+
+// rawLogJSON 从本批原始日志中找到失败的日志并序列化为 JSON
+func rawLogJSON(logs []types.Log, txHash string, logIndex uint) (string, error) {
+	for i := range logs {
+		if logs[i].TxHash.Hex() == txHash && logs[i].Index == logIndex {
+			raw, err := json.Marshal(&logs[i])
+			if err != nil {
+				return "", fmt.Errorf("序列化原始日志失败: %v", err)
+			}
+			return string(raw), nil
+		}
+	}
+	return "", fmt.Errorf("本批日志中找不到 TX=%s, LogIndex=%d", txHash, logIndex)
+}
+
+// resolveDeadLetters 游标推进到 toBlock 后，把该区块及之前未处理的死信标记为重试成功
+func resolveDeadLetters(tx *gorm.DB, chainID int64, toBlock uint64) error {
+	result := tx.Model(&models.DeadLetter{}).
+		Where("chain_id = ? AND status = ? AND block_number <= ?", chainID, deadLetterPending, toBlock).
+		Updates(map[string]interface{}{
+			"status":      deadLetterResolved,
+			"resolved_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("更新死信状态失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		middleware.Info("✅ 链 %d 的 %d 条死信重试成功", chainID, result.RowsAffected)
+	}
+	return nil
+}
+
+// skipDiscarded 去掉已被管理员丢弃的日志，保持原有顺序
+func skipDiscarded(tx *gorm.DB, chainID int64, events []decodedLog) ([]decodedLog, error) {
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	var discarded []eventKey
+	err := tx.Model(&models.DeadLetter{}).
+		Select("chain_id, tx_hash, log_index").
+		Where("chain_id = ? AND status = ? AND block_number BETWEEN ? AND ?", chainID, deadLetterDiscarded,
+			events[0].EventLog.BlockNumber, events[len(events)-1].EventLog.BlockNumber).
+		Find(&discarded).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询已丢弃的死信失败: %v", err)
+	}
+	if len(discarded) == 0 {
+		return events, nil
+	}
+
+	skip := make(map[eventKey]bool, len(discarded))
+	for _, key := range discarded {
+		skip[key] = true
+	}
+	kept := make([]decodedLog, 0, len(events))
+	for _, event := range events {
+		key := eventKey{ChainID: event.EventLog.ChainID, TxHash: event.EventLog.TxHash, LogIndex: event.EventLog.LogIndex}
+		if skip[key] {
+			middleware.Warn("⏭️ 跳过已丢弃的死信日志: TX=%s, LogIndex=%d", key.TxHash, key.LogIndex)
+			continue
+		}
+		kept = append(kept, event)
+	}
+	return kept, nil
+}
+
+// pendingDeadLetter 游标之后最早的一条未处理死信，没有时返回 nil
+func pendingDeadLetter(db *gorm.DB, chainID int64, lastBlock uint64) (*models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := db.Where("chain_id = ? AND status = ? AND block_number > ?", chainID, deadLetterPending, lastBlock).
+		Order("block_number, log_index").
+		First(&letter).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
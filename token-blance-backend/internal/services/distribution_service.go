@@ -0,0 +1,313 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	distributionSourceBalance = "balance"
+	distributionSourcePoints  = "points"
+
+	// distributionPointsDecimals points_records.points 的小数位数 (decimal(20,8))
+	distributionPointsDecimals = 8
+	// distributionLeafBatch 每批写入的叶子数量
+	distributionLeafBatch = 500
+)
+
+var (
+	// ErrInvalidDistribution 分发参数无效
+	ErrInvalidDistribution = errors.New("无效的分发参数")
+	// ErrDistributionNotFound 分发不存在
+	ErrDistributionNotFound = errors.New("分发不存在")
+	// ErrDistributionLeafNotFound 地址不在分发中
+	ErrDistributionLeafNotFound = errors.New("地址不在分发中")
+)
+
+// DistributionService 奖励分发 Merkle 树服务
+//
+// 从余额快照或积分生成每个地址的分配金额，构建与 OpenZeppelin StandardMerkleTree 兼容的 Merkle 树，
+// 保存根和所有叶子，并按地址提供领取证明。
+type DistributionService struct {
+	db *gorm.DB
+}
+
+// NewDistributionService 创建奖励分发服务
+func NewDistributionService(db *gorm.DB) *DistributionService {
+	return &DistributionService{db: db}
+}
+
+// DistributionRequest 生成分发的参数
+//
+// source=balance 时按 chain + token 在 block_number 或 timestamp 的余额快照分配，金额为余额 (最小单位)；
+// source=points 时把 total_amount 按 [from_date, to_date] 内 points_records 的积分占比分配，向下取整，
+// 余数不分配，chain 和 token 为空时包含所有链和代币的积分。
+type DistributionRequest struct {
+	Name        string `json:"name" binding:"required"`                        // 分发名称
+	Source      string `json:"source" binding:"required,oneof=balance points"` // balance 或 points
+	Chain       string `json:"chain"`                                          // 链名称，balance 时必填
+	Token       string `json:"token"`                                          // 代币合约地址，balance 时必填
+	BlockNumber uint64 `json:"block_number"`                                   // balance: 快照区块号
+	Timestamp   string `json:"timestamp"`                                      // balance: 快照时间点，RFC3339 或 Unix 秒
+	MinBalance  string `json:"min_balance"`                                    // balance: 最低余额，按代币精度换算后的数量
+	TotalAmount string `json:"total_amount"`                                   // points: 分配总额 (最小单位)
+	FromDate    string `json:"from_date"`                                      // points: 起始日期 YYYY-MM-DD，包含
+	ToDate      string `json:"to_date"`                                        // points: 结束日期 YYYY-MM-DD，包含
+}
+
+// DistributionProof 一个地址的领取证明
+type DistributionProof struct {
+	DistributionID uint     `json:"distribution_id"`
+	Root           string   `json:"root"`
+	Address        string   `json:"address"`
+	Amount         string   `json:"amount"`
+	TreeIndex      int      `json:"tree_index"`
+	Leaf           string   `json:"leaf"`
+	Proof          []string `json:"proof"`
+}
+
+// CreateDistribution 计算分配金额，生成 Merkle 树并保存根和所有叶子
+func (ds *DistributionService) CreateDistribution(req DistributionRequest) (*models.Distribution, error) {
+	var (
+		leaves []merkleLeaf
+		err    error
+	)
+	switch req.Source {
+	case distributionSourceBalance:
+		leaves, err = ds.balanceAllocation(req)
+	case distributionSourcePoints:
+		leaves, err = ds.pointsAllocation(req)
+	default:
+		return nil, fmt.Errorf("%w: source 只支持 balance 和 points", ErrInvalidDistribution)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := buildMerkleTree(leaves)
+	if err != nil {
+		return nil, err
+	}
+	params, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	total := new(big.Int)
+	for _, leaf := range tree.leaves {
+		total.Add(total, leaf.Amount)
+	}
+	distribution := &models.Distribution{
+		Name:        req.Name,
+		Source:      req.Source,
+		Params:      string(params),
+		Root:        tree.root().Hex(),
+		LeafCount:   len(tree.leaves),
+		TotalAmount: total.String(),
+	}
+
+	err = ds.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(distribution).Error; err != nil {
+			return err
+		}
+		rows := make([]models.DistributionLeaf, 0, len(tree.leaves))
+		for _, leaf := range tree.leaves {
+			proof, err := json.Marshal(tree.proof(leaf.TreeIndex))
+			if err != nil {
+				return err
+			}
+			rows = append(rows, models.DistributionLeaf{
+				DistributionID: distribution.ID,
+				Address:        leaf.Address.Hex(),
+				Amount:         leaf.Amount.String(),
+				TreeIndex:      leaf.TreeIndex,
+				Hash:           leaf.Hash.Hex(),
+				Proof:          string(proof),
+			})
+		}
+		return tx.CreateInBatches(rows, distributionLeafBatch).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	middleware.Info("🌳 分发 %d (%s) 已生成: %d 个地址, 总额 %s, 根 %s",
+		distribution.ID, distribution.Name, distribution.LeafCount, distribution.TotalAmount, distribution.Root)
+	return distribution, nil
+}
+
+// balanceAllocation 按余额快照分配，每个持有人的金额为快照时的余额
+func (ds *DistributionService) balanceAllocation(req DistributionRequest) ([]merkleLeaf, error) {
+	if req.Chain == "" || req.Token == "" {
+		return nil, fmt.Errorf("%w: 按余额分发时必须指定 chain 和 token", ErrInvalidDistribution)
+	}
+	opts := SnapshotOptions{
+		Chain:       req.Chain,
+		Token:       req.Token,
+		BlockNumber: req.BlockNumber,
+		MinBalance:  req.MinBalance,
+	}
+	if req.Timestamp != "" {
+		timestamp, err := ParseSnapshotTime(req.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		opts.Timestamp = timestamp
+	}
+	snapshot, err := NewSnapshotService(ds.db).PrepareSnapshot(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := []merkleLeaf{}
+	err = snapshot.Each(func(entry SnapshotEntry) error {
+		amount, ok := new(big.Int).SetString(entry.Balance, 10)
+		if !ok {
+			return fmt.Errorf("无效的历史余额: %s (%s)", entry.Balance, entry.UserAddress)
+		}
+		leaves = append(leaves, merkleLeaf{Address: common.HexToAddress(entry.UserAddress), Amount: amount})
+		return nil
+	})
+	return leaves, err
+}
+
+// pointsAllocation 把分配总额按积分占比分给每个地址，向下取整
+func (ds *DistributionService) pointsAllocation(req DistributionRequest) ([]merkleLeaf, error) {
+	total, ok := new(big.Int).SetString(req.TotalAmount, 10)
+	if !ok || total.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: 按积分分发时 total_amount 必须是正整数 (最小单位)", ErrInvalidDistribution)
+	}
+
+	query := ds.db.Model(&models.PointsRecord{})
+	if req.Chain != "" {
+		var cursor models.ChainSyncStatus
+		err := ds.db.Where("chain_name = ?", req.Chain).First(&cursor).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrChainNotFound, req.Chain)
+		}
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("chain_id = ?", cursor.ChainID)
+	}
+	if req.Token != "" {
+		if !common.IsHexAddress(req.Token) {
+			return nil, fmt.Errorf("%w: 无效的代币地址 %s", ErrInvalidDistribution, req.Token)
+		}
+		query = query.Where("token_address = ?", common.HexToAddress(req.Token).Hex())
+	}
+	if req.FromDate != "" {
+		from, err := time.ParseInLocation("2006-01-02", req.FromDate, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的起始日期 %s", ErrInvalidDistribution, req.FromDate)
+		}
+		query = query.Where("calculate_date >= ?", from)
+	}
+	if req.ToDate != "" {
+		to, err := time.ParseInLocation("2006-01-02", req.ToDate, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的结束日期 %s", ErrInvalidDistribution, req.ToDate)
+		}
+		query = query.Where("calculate_date < ?", to.AddDate(0, 0, 1))
+	}
+
+	var rows []struct {
+		UserAddress string
+		Points      string
+	}
+	err := query.Select("user_address, SUM(points) AS points").
+		Group("user_address").
+		Having("SUM(points) > 0").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 积分按 8 位小数换算成整数后按比例分配，结果与数据库中的积分完全对应
+	shares := make([]*big.Int, len(rows))
+	sum := new(big.Int)
+	for i, row := range rows {
+		points, err := decimal.NewFromString(row.Points)
+		if err != nil {
+			return nil, fmt.Errorf("无效的积分: %s (%s)", row.Points, row.UserAddress)
+		}
+		shares[i] = points.Shift(distributionPointsDecimals).Truncate(0).BigInt()
+		sum.Add(sum, shares[i])
+	}
+
+	leaves := []merkleLeaf{}
+	if sum.Sign() == 0 {
+		return leaves, nil
+	}
+	for i, row := range rows {
+		amount := new(big.Int).Mul(total, shares[i])
+		amount.Quo(amount, sum)
+		if amount.Sign() == 0 {
+			continue
+		}
+		leaves = append(leaves, merkleLeaf{Address: common.HexToAddress(row.UserAddress), Amount: amount})
+	}
+	return leaves, nil
+}
+
+// ListDistributions 最近生成的分发，按 ID 倒序
+func (ds *DistributionService) ListDistributions(limit int) ([]models.Distribution, error) {
+	distributions := []models.Distribution{}
+	err := ds.db.Order("id desc").Limit(limit).Find(&distributions).Error
+	return distributions, err
+}
+
+// GetDistribution 按 ID 获取分发
+func (ds *DistributionService) GetDistribution(id uint) (*models.Distribution, error) {
+	var distribution models.Distribution
+	err := ds.db.First(&distribution, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrDistributionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &distribution, nil
+}
+
+// GetProof 获取地址在分发中的金额和证明
+func (ds *DistributionService) GetProof(id uint, address string) (*DistributionProof, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("%w: 无效的地址 %s", ErrInvalidDistribution, address)
+	}
+	distribution, err := ds.GetDistribution(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaf models.DistributionLeaf
+	err = ds.db.Where("distribution_id = ? AND address = ?", id, common.HexToAddress(address).Hex()).First(&leaf).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrDistributionLeafNotFound, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &DistributionProof{
+		DistributionID: distribution.ID,
+		Root:           distribution.Root,
+		Address:        leaf.Address,
+		Amount:         leaf.Amount,
+		TreeIndex:      leaf.TreeIndex,
+		Leaf:           leaf.Hash,
+	}
+	if err := json.Unmarshal([]byte(leaf.Proof), &proof.Proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
@@ -3,23 +3,20 @@ package services
 import (
 	"context"
 	"fmt"
-	"math/big"
 	"time"
 	"token-balance/config"
 	"token-balance/internal/middleware"
 	"token-balance/internal/models"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"gorm.io/gorm"
 )
 
 // EventService 事件服务
 // 
 // 任务2: ✅ 使用go语言写一个后端服务来追踪合约事件，重建用户的余额
-// 任务3: ✅ 以太坊延迟六个区块，确保区块链不会回滚
+// 任务3: ✅ 以太坊延迟六个区块，确保区块链不会回滚 (确认策略可按链配置)
 //
 // 功能实现：
 // - ✅ 连接区块链网络 (Sepolia)
@@ -29,9 +26,13 @@ import (
 // - ✅ 记录完整的余额变动历史
 // - ❌ 多链支持 (仅支持Sepolia，待实现Base Sepolia)
 type EventService struct {
-	db       *gorm.DB
-	client   *ethclient.Client
-	contract common.Address
+	db        *gorm.DB
+	client    ChainBackend
+	chainName string // 同步游标使用的链名称 (chain_sync_status.chain_name)
+	chainID   int64
+	startBlock uint64 // 合约部署区块
+	wsURL      string // WebSocket端点，为空时使用轮询
+	finality   finalityPolicy
 }
 
 // NewEventService 创建事件服务
@@ -43,14 +44,14 @@ func NewEventService(db *gorm.DB, cfg interface{}) (*EventService, error) {
 		return nil, nil
 	}
 
-	// 连接到 Sepolia 测试网络
-	rpcURL := appConfig.Ethereum.SepoliaRPCURL
-	if rpcURL == "" {
-		rpcURL = appConfig.Ethereum.RPCEndpoint
+	// 连接到 Sepolia 测试网络 (可以用逗号分隔配置多个RPC端点)
+	rpcURLs := config.SplitList(appConfig.Ethereum.SepoliaRPCURL)
+	if len(rpcURLs) == 0 {
+		rpcURLs = config.SplitList(appConfig.Ethereum.RPCEndpoint)
 	}
 
-	middleware.Info("🔗 连接区块链网络: %s", rpcURL)
-	client, err := ethclient.Dial(rpcURL)
+	middleware.Info("🔗 连接区块链网络: %v", rpcURLs)
+	client, err := DialRPCPool("default", rpcURLs, 0)
 	if err != nil {
 		middleware.Error("连接以太坊 RPC 失败: %v", err)
 		return nil, err
@@ -62,25 +63,76 @@ func NewEventService(db *gorm.DB, cfg interface{}) (*EventService, error) {
 	
 	chainID, err := client.ChainID(ctx)
 	if err != nil {
+		client.Close()
 		middleware.Error("获取链ID失败: %v", err)
 		return nil, err
 	}
 	middleware.Info("✅ 已连接到链ID: %d", chainID)
 
-	// 获取合约地址
+	// 首次同步从合约部署区块开始，链名称和确认策略与多链服务的链定义一致
+	chains, err := loadChainConfigs(db, appConfig)
+	if err != nil {
+		middleware.Warn("⚠️ 读取链定义失败，使用 .env 中的配置: %v", err)
+		chains = appConfig.GetSupportedChains()
+	}
+	chainName := chainNameByID(chains, chainID.Int64())
+	client.chainName = chainName
+	startBlock := appConfig.Ethereum.DeploymentBlock
+	wsURL := ""
+	if chain, ok := chains[chainName]; ok {
+		startBlock = chain.StartBlock
+		wsURL = chain.WSURL
+	}
+
+	// 配置的合约地址自动登记到代币表，其他代币通过 /api/v1/tokens 登记
 	contractAddress := common.HexToAddress(appConfig.Ethereum.ContractAddress)
-	if isZeroAddress(contractAddress) {
-		middleware.Error("❌ 合约地址未配置！请在 .env 中设置 TOKEN_CONTRACT_ADDRESS")
-		middleware.Error("当前配置: %s", appConfig.Ethereum.ContractAddress)
+	if err := registerConfiguredToken(db, chainName, chainID.Int64(), contractAddress, startBlock); err != nil {
+		middleware.Warn("⚠️ %v", err)
 	}
 
 	return &EventService{
-		db:       db,
-		client:   client,
-		contract: contractAddress,
+		db:         db,
+		client:     client,
+		chainName:  chainName,
+		chainID:    chainID.Int64(),
+		startBlock: startBlock,
+		wsURL:      wsURL,
+		finality:   chainFinalityPolicy(appConfig, chains, chainName),
 	}, nil
 }
 
+// NewEventServiceWithBackend 使用指定的链接口创建事件服务 (模拟链、测试等)
+//
+// 只处理代币表中登记在该链上的代币，使用默认的六个区块确认深度。
+func NewEventServiceWithBackend(db *gorm.DB, client ChainBackend, chainName string, startBlock uint64) (*EventService, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取链ID失败: %v", err)
+	}
+
+	return &EventService{
+		db:         db,
+		client:     client,
+		chainName:  chainName,
+		chainID:    chainID.Int64(),
+		startBlock: startBlock,
+		finality:   newFinalityPolicy(chainName, finalityDepth, defaultConfirmationBlocks),
+	}, nil
+}
+
+// chainNameByID 根据链ID查找链定义中的链名称，与多链服务共用同一个同步游标
+func chainNameByID(chains map[string]config.ChainConfig, chainID int64) string {
+	for name, chain := range chains {
+		if chain.ChainID == chainID {
+			return name
+		}
+	}
+	return fmt.Sprintf("chain-%d", chainID)
+}
+
 // isZeroAddress 检查地址是否为零地址
 func isZeroAddress(addr common.Address) bool {
 	return addr == common.HexToAddress("0x0000000000000000000000000000000000000000")
@@ -90,12 +142,17 @@ func isZeroAddress(addr common.Address) bool {
 func (es *EventService) StartEventListener() {
 	middleware.Info("启动区块链事件监听服务...")
 
-	// 检查合约地址是否有效
-	if isZeroAddress(es.contract) {
-		middleware.Warn("⚠️ 合约地址未配置，将监听网络上的所有Transfer事件")
-		middleware.Info("📝 如需监听特定合约，请在 .env 中设置 TOKEN_CONTRACT_ADDRESS")
+	// 列出已登记的代币
+	tokens, err := enabledTokens(es.db, es.chainID)
+	if err != nil {
+		middleware.Error("读取已登记代币失败: %v", err)
+	} else if len(tokens) == 0 {
+		middleware.Warn("⚠️ 链 %s 没有已登记的代币，登记代币后开始同步", es.chainName)
+		middleware.Info("📝 请在 .env 中设置 TOKEN_CONTRACT_ADDRESS，或通过 /api/v1/tokens 登记代币")
 	} else {
-		middleware.Info("✅ 监听特定合约地址: %s", es.contract.Hex())
+		for _, token := range tokens {
+			middleware.Info("✅ 监听代币合约: %s %s", token.Symbol, token.Address)
+		}
 	}
 
 	// 启动事件监听 goroutine
@@ -105,339 +162,53 @@ func (es *EventService) StartEventListener() {
 }
 
 // listenToEvents 监听合约事件
+//
+// 配置了 WebSocket 端点时每个新区块触发一次同步，否则每15秒轮询一次。
 func (es *EventService) listenToEvents() {
-	middleware.Info("🎧 事件监听循环已启动，每15秒检查一次...")
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
-
-	var lastBlockNumber uint64
-	iteration := 0
-
-	for range ticker.C {
-		iteration++
-		middleware.Info("🔍 开始第 %d 次事件检查...", iteration)
-		
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-
-		// 获取最新区块
-		header, err := es.client.HeaderByNumber(ctx, nil)
-		if err != nil {
-			middleware.Error("❌ 获取最新区块失败: %v", err)
-			cancel()
-			continue
-		}
-
-		currentBlockNumber := header.Number.Uint64()
-
-		// 等待6个区块确认以确保区块链不会回滚
-		// 这是为了防止因区块链重组导致的事件处理错误
-		const confirmationBlocks = uint64(6)
-		safeLatestBlock := currentBlockNumber
-		if currentBlockNumber > confirmationBlocks {
-			safeLatestBlock = currentBlockNumber - confirmationBlocks
-		}
-
-		// 首次运行或距离上次查询超过指定区块数
-		// 减小区块范围以避免RPC限制
-		maxBlockRange := uint64(100) // 减少到100个区块
-		if lastBlockNumber == 0 || safeLatestBlock-lastBlockNumber > maxBlockRange {
-			lastBlockNumber = safeLatestBlock - maxBlockRange
-			if lastBlockNumber < 1 {
-				lastBlockNumber = 1
-			}
-		}
-
-		// 查询所有 Transfer 事件（不限制合约地址）
-		var addresses []common.Address
-		
-		// 如果合约地址有效，则监听特定合约；否则监听所有合约
-		if !isZeroAddress(es.contract) {
-			addresses = []common.Address{es.contract}
-		}
-		
-		query := ethereum.FilterQuery{
-			FromBlock: new(big.Int).SetUint64(lastBlockNumber),
-			ToBlock:   new(big.Int).SetUint64(safeLatestBlock), // 使用安全的区块高度
-			Addresses: addresses, // 空数组表示监听所有地址
-			Topics: [][]common.Hash{
-				{common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")}, // Transfer事件签名
-			},
-		}
-
-		if safeLatestBlock < currentBlockNumber {
-			middleware.Debug("🛡️  安全模式：查询到区块 %d (当前最新 %d，延迟 %d 个区块确认)", 
-				safeLatestBlock, currentBlockNumber, currentBlockNumber - safeLatestBlock)
-		}
-
-		logs, err := es.client.FilterLogs(ctx, query)
-		if err != nil {
-			middleware.Error("查询事件日志失败: %v", err)
-			cancel()
-			continue
-		}
-
-	if len(logs) > 0 {
-		middleware.Info("📊 查询到 %d 个Transfer事件 (区块范围: %d - %d)", len(logs), lastBlockNumber, currentBlockNumber)
-		
-		successCount := 0
-		for _, log := range logs {
-			middleware.Info("🔄 处理Transfer事件: TX=%s, Block=%d, Contract=%s",
-				log.TxHash.Hex()[:10]+"...", log.BlockNumber, log.Address.Hex()[:10]+"...")
-
-			// 保存事件到数据库
-			if err := es.saveEventLogSync(&log); err != nil {
-				middleware.Error("❌ 保存事件失败: %v", err)
-			} else {
-				successCount++
-			}
-		}
-		middleware.Info("✅ 成功处理 %d/%d 个事件", successCount, len(logs))
+	if es.wsURL != "" {
+		middleware.Info("🎧 事件监听循环已启动，订阅新区块 (断开时每15秒轮询)...")
 	} else {
-		middleware.Debug("📭 当前区块范围内没有Transfer事件")
+		middleware.Info("🎧 事件监听循环已启动，每15秒检查一次...")
 	}
 
-		lastBlockNumber = currentBlockNumber
-
-		cancel()
-	}
+	newChainWatcher(es.syncer(), es.wsURL).run(nil)
 }
 
-// saveEventLog 保存事件日志到数据库
-func (es *EventService) saveEventLog(log *types.Log) {
-	// 调用同步版本但忽略错误
-	if err := es.saveEventLogSync(log); err != nil {
-		middleware.Error("保存事件日志失败: %v", err)
-	}
-}
-
-// saveEventLogSync 同步保存事件日志到数据库
-func (es *EventService) saveEventLogSync(log *types.Log) error {
-	eventLog := models.EventLog{
-		TxHash:      log.TxHash.Hex(),
-		BlockNumber: log.BlockNumber,
-		ContractAddress: log.Address.Hex(), // 添加合约地址
-		Data:        common.Bytes2Hex(log.Data),
-		Timestamp:   time.Now(),
-	}
-
-	// 解析Transfer事件
-	// Transfer 事件签名: keccak256("Transfer(address,address,uint256)")
-	transferEventSig := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
-
-	if len(log.Topics) >= 3 && log.Topics[0] == transferEventSig {
-		eventLog.EventName = "Transfer"
-		
-		// 解析地址
-		fromAddress := common.BytesToAddress(log.Topics[1].Bytes())
-		toAddress := common.BytesToAddress(log.Topics[2].Bytes())
-		
-		// 解析金额（如果有的话）
-		var amount string = "0"
-		if len(log.Data) >= 32 {
-			amount = new(big.Int).SetBytes(log.Data).String()
-		}
-		
-		// 记录相关地址信息
-		eventLog.UserAddress = toAddress.Hex() // 主要关注接收方
-		eventLog.Data = fmt.Sprintf("from:%s,to:%s,amount:%s", fromAddress.Hex(), toAddress.Hex(), amount)
-		eventLog.Amount = amount
-		
-		// 更新用户余额
-		es.updateUserBalanceFromTransfer(fromAddress.Hex(), toAddress.Hex(), amount, log.TxHash.Hex(), log.BlockNumber)
-		
-		middleware.Info("Transfer事件解析完成: From=%s, To=%s, Amount=%s", 
-			fromAddress.Hex(), toAddress.Hex(), amount)
-	}
-
-	if err := es.db.Create(&eventLog).Error; err != nil {
-		middleware.Error("保存事件日志失败: %v", err)
-		return err
-	}
-
-	middleware.Debug("事件已保存到数据库: %s, Contract=%s, TX=%s", 
-		eventLog.EventName, eventLog.ContractAddress, eventLog.TxHash)
-	return nil
-}
-
-// handleTransferEvent 处理Transfer事件
-func (es *EventService) handleTransferEvent(transfer *models.EventLog) {
-	if transfer == nil {
-		return
-	}
-	middleware.Info("检测到Transfer事件: data=%s", transfer.Data)
-
-	// 更新用户余额 (placeholder implementation)
-	// 实际应该从事件中解析出from、to、value等信息
-}
-
-// updateUserBalanceFromTransfer 从Transfer事件更新用户余额
-func (es *EventService) updateUserBalanceFromTransfer(fromAddr, toAddr, amount, txHash string, blockNumber uint64) {
-	// 处理接收方余额增加
-	if toAddr != "0x0000000000000000000000000000000000000000" {
-		es.updateSingleUserBalance(toAddr, amount, "transfer_in", txHash, blockNumber)
-	}
-	
-	// 处理发送方余额减少（如果是mint事件，from地址可能是零地址）
-	if fromAddr != "0x0000000000000000000000000000000000000000" {
-		// 这里简化处理，实际应该根据具体代币合约逻辑来计算
-		// 由于我们无法直接获取发送方的新余额，先记录事件
-		es.recordTransferEvent(fromAddr, amount, "transfer_out", txHash, blockNumber)
-	}
-}
-
-// updateSingleUserBalance 更新单个用户余额
-func (es *EventService) updateSingleUserBalance(address, amount, changeType, txHash string, blockNumber uint64) {
-	// 获取用户当前余额
-	var user models.User
-	err := es.db.Where("id = ?", address).First(&user).Error
-	
-	if err != nil && err != gorm.ErrRecordNotFound {
-		middleware.Error("查询用户余额失败: %v", err)
-		return
-	}
-
-	// 如果用户不存在，创建新用户
-	if err == gorm.ErrRecordNotFound {
-		user = models.User{
-			ID:          address,
-			Balance:     "0",
-			TotalPoints: 0,
-		}
-		if err := es.db.Create(&user).Error; err != nil {
-			middleware.Error("创建用户失败: %v", err)
-			return
-		}
-	}
-
-	// 计算新余额（这里简化处理，实际应该调用合约获取当前余额）
-	oldBalance := user.Balance
-	var newBalance string
-	
-	if changeType == "transfer_in" {
-		// 接收代币，余额增加
-		oldAmount := new(big.Int)
-		if oldBalanceStr := user.Balance; oldBalanceStr != "" {
-			oldAmount, _ = new(big.Int).SetString(oldBalanceStr, 10)
+// SyncToHead 连续同步直到追上安全高度，返回新入账的事件数
+func (es *EventService) SyncToHead(ctx context.Context) (int, error) {
+	syncer := es.syncer()
+	saved := 0
+	for {
+		result, err := syncer.syncNext(ctx)
+		if err != nil {
+			return saved, err
 		}
-		
-		addAmount := new(big.Int)
-		if amount != "" {
-			addAmount, _ = new(big.Int).SetString(amount, 10)
+		saved += result.Saved
+		if result.CaughtUp {
+			return saved, nil
 		}
-		
-		newBalance = new(big.Int).Add(oldAmount, addAmount).String()
-	} else {
-		// 发送代币，这里简化处理，实际应该查询合约获取最新余额
-		newBalance = user.Balance // 暂时保持不变
 	}
-
-	// 更新用户余额
-	if err := es.db.Model(&user).Update("balance", newBalance).Error; err != nil {
-		middleware.Error("更新用户余额失败: %v", err)
-		return
-	}
-
-	// 记录余额变动历史
-	history := models.UserBalanceHistory{
-		UserAddress:  address,
-		OldBalance:   oldBalance,
-		NewBalance:   newBalance,
-		ChangeAmount: amount,
-		ChangeType:   changeType,
-		TxHash:       txHash,
-		BlockNumber:  blockNumber,
-		Timestamp:    time.Now(),
-	}
-
-	if err := es.db.Create(&history).Error; err != nil {
-		middleware.Error("记录余额变动历史失败: %v", err)
-	}
-
-	middleware.Info("用户余额更新: Address=%s, Old=%s, New=%s, Change=%s", 
-		address, oldBalance, newBalance, amount)
 }
 
-// recordTransferEvent 记录转账事件（用于发送方）
-func (es *EventService) recordTransferEvent(address, amount, changeType, txHash string, blockNumber uint64) {
-	// 对于发送方，我们先记录事件，后续可以通过合约查询获取最新余额
-	history := models.UserBalanceHistory{
-		UserAddress:  address,
-		OldBalance:   "", // 待更新
-		NewBalance:   "", // 待更新
-		ChangeAmount: amount,
-		ChangeType:   changeType,
-		TxHash:       txHash,
-		BlockNumber:  blockNumber,
-		Timestamp:    time.Now(),
-	}
-
-	if err := es.db.Create(&history).Error; err != nil {
-		middleware.Error("记录转账事件失败: %v", err)
-	}
-}
-
-// updateUserBalance 更新用户余额并记录历史（保留原函数兼容性）
-func (es *EventService) updateUserBalance(address, amount, changeType string) {
-	// 获取用户当前余额
-	var user models.User
-	err := es.db.Where("id = ?", address).First(&user).Error
-	if err != nil && err != gorm.ErrRecordNotFound {
-		middleware.Error("查询用户余额失败: %v", err)
-		return
-	}
-
-	// 如果用户不存在，创建新用户
-	if err == gorm.ErrRecordNotFound {
-		user = models.User{
-			ID:          address,
-			Balance:     "0",
-			TotalPoints: 0,
-		}
-		if err := es.db.Create(&user).Error; err != nil {
-			middleware.Error("创建用户失败: %v", err)
-			return
-		}
-	}
-
-	// 解析金额
-	oldBalance := user.Balance
-
-	// 计算新余额
-	if changeType == "transfer_out" {
-		// 发送方减少余额
-		// 这里应该有更复杂的余额计算逻辑
-		// 暂时简化处理
-	} else if changeType == "transfer_in" {
-		// 接收方增加余额
-		// 这里应该有更复杂的余额计算逻辑
-	}
-
-	// 记录余额变动历史
-	history := models.UserBalanceHistory{
-		UserAddress:  address,
-		OldBalance:   oldBalance,
-		NewBalance:   user.Balance, // 这里应该更新为新余额
-		ChangeAmount: amount,
-		ChangeType:   changeType,
-		TxHash:       "0x...", // 应该从事件中获取
-		BlockNumber:  0,       // 应该从事件中获取
-		Timestamp:    time.Now(),
-	}
-
-	if err := es.db.Create(&history).Error; err != nil {
-		middleware.Error("记录余额变动历史失败: %v", err)
+// syncer 创建使用本服务保存事件的链同步器
+func (es *EventService) syncer() *chainSyncer {
+	return &chainSyncer{
+		db:         es.db,
+		client:     es.client,
+		chainName:  es.chainName,
+		chainID:    es.chainID,
+		startBlock: es.startBlock,
+		finality:   es.finality,
+		decode:     es.decodeEventLog,
 	}
 }
 
-// SyncEvents 手动同步事件
-func (es *EventService) SyncEvents() error {
-	middleware.Info("开始手动同步区块链事件...")
-
-	// 这里应该实现完整的事件同步逻辑
-	// 包括获取历史事件、重建用户余额等
-
-	middleware.Info("区块链事件同步完成")
-	return nil
+// decodeEventLog 把日志解码为待写入的事件日志和 Transfer 事件
+//
+// 同步器的解码阶段并行调用，只做解析不访问数据库；写入、去重和入账由 storeEventBatch 完成。
+// blockTime 为日志所在区块的链上时间戳。
+func (es *EventService) decodeEventLog(log *types.Log, blockTime time.Time) decodedLog {
+	return decodeLog(es.chainID, log, blockTime)
 }
 
 // GetRecentEvents 获取最近事件
@@ -455,13 +226,18 @@ func (es *EventService) GetRecentEvents(page, pageSize string) (*models.Paginate
 		return nil, err
 	}
 
-	err = es.db.Order("timestamp desc").
+	err = es.db.Order("block_number desc, log_index desc").
 		Offset(offset).
 		Limit(StringToInt(pageSize)).
 		Find(&events).Error
 	if err != nil {
 		return nil, err
 	}
+	decimals, err := loadTokenDecimals(es.db)
+	if err != nil {
+		return nil, err
+	}
+	formatEventLogs(events, decimals)
 
 	totalPages := (total + int64(StringToInt(pageSize)) - 1) / int64(StringToInt(pageSize))
 
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 确认策略
+const (
+	finalityDepth     = "depth"     // 最新区块减去固定确认深度
+	finalitySafe      = "safe"      // 节点的 safe 区块标签
+	finalityFinalized = "finalized" // 节点的 finalized 区块标签
+)
+
+// defaultConfirmationBlocks 未配置确认策略时延迟六个区块确认
+const defaultConfirmationBlocks = uint64(6)
+
+// finalityPolicy 链的确认策略，决定索引器可以处理到的最高区块
+//
+// 以太坊主网和测试网可以直接使用节点的 safe/finalized 标签；L2 的 finalized
+// 依赖 L1 提交，延迟较大；本地节点 (Hardhat 31337) 可以使用较小的固定深度。
+type finalityPolicy struct {
+	Mode  string `json:"mode"`
+	Depth uint64 `json:"depth"` // depth 策略的确认区块数，其他策略为0
+}
+
+// newFinalityPolicy 根据配置创建确认策略，无法识别的策略回退为固定深度
+func newFinalityPolicy(chainName, mode string, depth uint64) finalityPolicy {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case finalitySafe:
+		return finalityPolicy{Mode: finalitySafe}
+	case finalityFinalized:
+		return finalityPolicy{Mode: finalityFinalized}
+	case "", finalityDepth:
+		return finalityPolicy{Mode: finalityDepth, Depth: depth}
+	default:
+		middleware.Warn("⚠️ 链 %s 的确认策略 %q 无效，使用固定深度 %d", chainName, mode, depth)
+		return finalityPolicy{Mode: finalityDepth, Depth: depth}
+	}
+}
+
+// chainFinalityPolicy 链定义中的确认策略，未定义的链使用 ETHEREUM_FINALITY/ETHEREUM_CONFIRMATIONS
+func chainFinalityPolicy(cfg *config.Config, chains map[string]config.ChainConfig, chainName string) finalityPolicy {
+	if chain, ok := chains[chainName]; ok {
+		return newFinalityPolicy(chainName, chain.Finality, chain.ConfirmationBlocks)
+	}
+	return newFinalityPolicy(chainName, cfg.Ethereum.Finality, cfg.Ethereum.ConfirmationBlocks)
+}
+
+// String 策略的可读描述
+func (p finalityPolicy) String() string {
+	if p.Mode == finalityDepth {
+		return fmt.Sprintf("%s(%d)", p.Mode, p.Depth)
+	}
+	return p.Mode
+}
+
+// safeHead 索引器可以处理到的最高区块，不会超过 latest
+func (p finalityPolicy) safeHead(ctx context.Context, client ChainBackend, latest uint64) (uint64, error) {
+	switch p.Mode {
+	case finalitySafe, finalityFinalized:
+		height, err := taggedBlockNumber(ctx, client, p.Mode)
+		if err != nil {
+			return 0, err
+		}
+		if height > latest {
+			height = latest
+		}
+		return height, nil
+	default:
+		if latest <= p.Depth {
+			return 0, nil
+		}
+		return latest - p.Depth, nil
+	}
+}
+
+// taggedBlockNumber 查询 safe 或 finalized 标签对应的区块高度
+func taggedBlockNumber(ctx context.Context, client ChainBackend, tag string) (uint64, error) {
+	header, err := client.HeaderByNumber(ctx, blockTag(tag))
+	if err != nil {
+		return 0, fmt.Errorf("获取 %s 区块失败: %w", tag, err)
+	}
+	return header.Number.Uint64(), nil
+}
+
+// blockTag safe 或 finalized 标签对应的特殊区块号
+func blockTag(tag string) *big.Int {
+	if tag == finalityFinalized {
+		return big.NewInt(int64(rpc.FinalizedBlockNumber))
+	}
+	return big.NewInt(int64(rpc.SafeBlockNumber))
+}
+
+// headerPeeker 查询区块头但不计入熔断器 (RPCPool 实现)
+type headerPeeker interface {
+	peekHeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// finalityHeights 查询链当前的 safe 和 finalized 高度，节点不支持时对应的值为 nil
+//
+// 状态接口对每条链都会调用，与链的确认策略无关；节点不支持这些标签时的错误
+// 不能计入同步使用的熔断器，因此端点池上绕过熔断器查询。
+func finalityHeights(client ChainBackend) (safe, finalized *uint64) {
+	fetch := client.HeaderByNumber
+	if peeker, ok := client.(headerPeeker); ok {
+		fetch = peeker.peekHeaderByNumber
+	}
+
+	lookup := func(tag string) *uint64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		header, err := fetch(ctx, blockTag(tag))
+		if err != nil {
+			middleware.Debug("查询 %s 高度失败: %v", tag, err)
+			return nil
+		}
+		height := header.Number.Uint64()
+		return &height
+	}
+	return lookup(finalitySafe), lookup(finalityFinalized)
+}
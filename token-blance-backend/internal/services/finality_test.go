@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// taggedChain 按 safe/finalized 标签返回固定高度的链，高度为 nil 时节点不支持该标签
+func taggedChain(safe, finalized *uint64) *stubChain {
+	return &stubChain{headerByNumber: func(number *big.Int) (*types.Header, error) {
+		var height *uint64
+		switch rpc.BlockNumber(number.Int64()) {
+		case rpc.SafeBlockNumber:
+			height = safe
+		case rpc.FinalizedBlockNumber:
+			height = finalized
+		}
+		if height == nil {
+			return nil, errors.New("unsupported block tag")
+		}
+		return &types.Header{Number: new(big.Int).SetUint64(*height)}, nil
+	}}
+}
+
+func TestFinalityPolicySafeHead(t *testing.T) {
+	safe, finalized := uint64(990), uint64(960)
+
+	tests := []struct {
+		name    string
+		policy  finalityPolicy
+		client  *stubChain
+		latest  uint64
+		want    uint64
+		wantErr bool
+	}{
+		{name: "depth", policy: newFinalityPolicy("test", "depth", 6), client: taggedChain(nil, nil), latest: 1000, want: 994},
+		{name: "depth longer than chain", policy: newFinalityPolicy("test", "", 6), client: taggedChain(nil, nil), latest: 5, want: 0},
+		{name: "unknown mode falls back to depth", policy: newFinalityPolicy("test", "latest", 2), client: taggedChain(nil, nil), latest: 1000, want: 998},
+		{name: "safe tag", policy: newFinalityPolicy("test", "safe", 0), client: taggedChain(&safe, &finalized), latest: 1000, want: 990},
+		{name: "finalized tag", policy: newFinalityPolicy("test", "Finalized", 0), client: taggedChain(&safe, &finalized), latest: 1000, want: 960},
+		{name: "tag capped at latest", policy: newFinalityPolicy("test", "safe", 0), client: taggedChain(&safe, &finalized), latest: 980, want: 980},
+		{name: "tag unsupported", policy: newFinalityPolicy("test", "finalized", 0), client: taggedChain(&safe, nil), latest: 1000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.safeHead(context.Background(), tt.client, tt.latest)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeHead = %d, want error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("safeHead = (%d, %v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinalityHeights(t *testing.T) {
+	safe, finalized := uint64(990), uint64(960)
+
+	tests := []struct {
+		name                string
+		client              *stubChain
+		wantSafe, wantFinal *uint64
+	}{
+		{name: "both supported", client: taggedChain(&safe, &finalized), wantSafe: &safe, wantFinal: &finalized},
+		{name: "finalized unsupported", client: taggedChain(&safe, nil), wantSafe: &safe},
+		{name: "no tags", client: taggedChain(nil, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSafe, gotFinal := finalityHeights(tt.client)
+			if !equalHeight(gotSafe, tt.wantSafe) || !equalHeight(gotFinal, tt.wantFinal) {
+				t.Fatalf("finalityHeights = (%v, %v), want (%v, %v)", gotSafe, gotFinal, tt.wantSafe, tt.wantFinal)
+			}
+		})
+	}
+}
+
+// equalHeight 比较两个可能为 nil 的高度
+func equalHeight(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"token-balance/internal/models"
+)
+
+// 健康状态，按严重程度递增
+const (
+	healthHealthy  = "healthy"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// healthRank 健康状态的严重程度，用于取最差状态
+var healthRank = map[string]int{
+	healthHealthy:  0,
+	healthDegraded: 1,
+	healthDown:     2,
+}
+
+// HealthReport 多链健康检查结果
+type HealthReport struct {
+	Status    string         `json:"status"` // healthy、degraded 或 down
+	Database  DatabaseHealth `json:"database"`
+	Chains    []ChainHealth  `json:"chains"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+// DatabaseHealth 数据库连接检查结果
+type DatabaseHealth struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ChainHealth 单条链的检查结果
+//
+// BlockLag 为按确认策略计算的已确认高度与已处理区块的差距，HeadLag 为与最新区块的差距。
+type ChainHealth struct {
+	Name              string   `json:"name"`
+	ChainID           int64    `json:"chain_id"`
+	Status            string   `json:"status"`
+	Running           bool     `json:"running"`
+	RPCLatencyMs      float64  `json:"rpc_latency_ms"`
+	HeadBlock         uint64   `json:"head_block"`
+	SafeBlock         uint64   `json:"safe_block"`
+	LastBlock         uint64   `json:"last_block"`
+	HeadLag           uint64   `json:"head_lag"`
+	BlockLag          uint64   `json:"block_lag"`
+	SecondsSinceSync  *float64 `json:"seconds_since_sync"` // 从未同步成功时为 null
+	ConsecutiveErrors int      `json:"consecutive_errors"`
+	CircuitState      string   `json:"circuit_state,omitempty"`
+	Reasons           []string `json:"reasons,omitempty"` // 状态不是 healthy 的原因
+}
+
+// HealthCheck 检查数据库和所有已启用链的健康状态
+//
+// 每条链实际测量一次 RPC 往返延迟，并对比已确认高度与同步游标、上次同步成功的时间
+// 和连续失败次数，阈值来自 HEALTH_* 配置。数据库不可用时整体为 down；任何一条链
+// 不健康时整体为 degraded，所有链都为 down 时整体为 down。
+func (mcs *MultiChainService) HealthCheck(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Status:    healthHealthy,
+		Chains:    []ChainHealth{},
+		CheckedAt: time.Now(),
+	}
+
+	report.Database = mcs.checkDatabaseHealth(ctx)
+	if report.Database.Status == healthDown {
+		report.Status = healthDown
+		return report
+	}
+
+	var definitions []models.ChainDefinition
+	if err := mcs.db.WithContext(ctx).Where("enabled = ?", true).Order("id asc").Find(&definitions).Error; err != nil {
+		report.Database = DatabaseHealth{Status: healthDown, Error: err.Error()}
+		report.Status = healthDown
+		return report
+	}
+
+	downChains := 0
+	for _, definition := range definitions {
+		chainHealth := mcs.checkChainHealth(ctx, definition)
+		if chainHealth.Status == healthDown {
+			downChains++
+		}
+		if chainHealth.Status != healthHealthy {
+			report.Status = healthDegraded
+		}
+		report.Chains = append(report.Chains, chainHealth)
+	}
+	if len(definitions) > 0 && downChains == len(definitions) {
+		report.Status = healthDown
+	}
+
+	return report
+}
+
+// checkDatabaseHealth 测量数据库 ping 延迟
+func (mcs *MultiChainService) checkDatabaseHealth(ctx context.Context) DatabaseHealth {
+	sqlDB, err := mcs.db.DB()
+	if err != nil {
+		return DatabaseHealth{Status: healthDown, Error: err.Error()}
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err = sqlDB.PingContext(pingCtx)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		return DatabaseHealth{Status: healthDown, LatencyMs: latency, Error: err.Error()}
+	}
+	return DatabaseHealth{Status: healthHealthy, LatencyMs: latency}
+}
+
+// checkChainHealth 检查单条链：RPC 延迟、确认高度落后、上次同步时间和连续失败次数
+func (mcs *MultiChainService) checkChainHealth(ctx context.Context, definition models.ChainDefinition) ChainHealth {
+	thresholds := mcs.cfg.Health
+	health := ChainHealth{
+		Name:    definition.Name,
+		ChainID: definition.ChainID,
+		Status:  healthHealthy,
+	}
+
+	var record models.ChainSyncStatus
+	if err := mcs.db.WithContext(ctx).Where("chain_name = ?", definition.Name).First(&record).Error; err == nil {
+		health.LastBlock = record.LastBlock
+		health.ConsecutiveErrors = record.ConsecutiveErrors
+		if record.LastSuccessTime != nil {
+			age := time.Since(*record.LastSuccessTime).Seconds()
+			health.SecondsSinceSync = &age
+		}
+	}
+
+	mcs.mu.RLock()
+	chain, running := mcs.chains[definition.Name]
+	mcs.mu.RUnlock()
+	health.Running = running
+	if !running {
+		health.mark(healthDown, "链已启用但没有在监听")
+		return health
+	}
+	health.CircuitState = breakerFor(definition.Name).State()
+
+	// RPC 往返延迟：获取一次最新区块头，超过 down 阈值即视为不可用
+	rpcTimeout := time.Duration(thresholds.RPCLatencyDownMs) * time.Millisecond
+	if rpcTimeout <= 0 {
+		rpcTimeout = 10 * time.Second
+	}
+	rpcCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	start := time.Now()
+	header, err := chain.Client.HeaderByNumber(rpcCtx, nil)
+	health.RPCLatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		health.mark(healthDown, fmt.Sprintf("RPC 不可用: %v", err))
+	} else {
+		health.HeadBlock = header.Number.Uint64()
+		health.SafeBlock = health.HeadBlock
+		if safe, err := chain.Finality.safeHead(rpcCtx, chain.Client, health.HeadBlock); err == nil {
+			health.SafeBlock = safe
+		}
+		if health.HeadBlock > health.LastBlock {
+			health.HeadLag = health.HeadBlock - health.LastBlock
+		}
+		if health.SafeBlock > health.LastBlock {
+			health.BlockLag = health.SafeBlock - health.LastBlock
+		}
+
+		health.checkThreshold(health.RPCLatencyMs, float64(thresholds.RPCLatencyDegradedMs), float64(thresholds.RPCLatencyDownMs),
+			"RPC 延迟 %.0fms 超过阈值 %.0fms")
+		health.checkThreshold(float64(health.BlockLag), float64(thresholds.BlockLagDegraded), float64(thresholds.BlockLagDown),
+			"已确认区块落后 %.0f 个，超过阈值 %.0f")
+	}
+
+	if health.SecondsSinceSync == nil {
+		health.mark(healthDegraded, "尚未同步成功过")
+	} else {
+		health.checkThreshold(*health.SecondsSinceSync, float64(thresholds.SyncAgeDegradedSec), float64(thresholds.SyncAgeDownSec),
+			"距离上次同步成功 %.0f 秒，超过阈值 %.0f 秒")
+	}
+	health.checkThreshold(float64(health.ConsecutiveErrors), float64(thresholds.ErrorsDegraded), float64(thresholds.ErrorsDown),
+		"连续同步失败 %.0f 次，达到阈值 %.0f 次")
+
+	return health
+}
+
+// checkThreshold 按 degraded/down 阈值标记状态，阈值为0表示不检查
+func (h *ChainHealth) checkThreshold(value, degraded, down float64, reason string) {
+	switch {
+	case down > 0 && value >= down:
+		h.mark(healthDown, fmt.Sprintf(reason, value, down))
+	case degraded > 0 && value >= degraded:
+		h.mark(healthDegraded, fmt.Sprintf(reason, value, degraded))
+	}
+}
+
+// mark 记录原因，并把状态提升到更严重的一级
+func (h *ChainHealth) mark(status, reason string) {
+	if healthRank[status] > healthRank[h.Status] {
+		h.Status = status
+	}
+	h.Reasons = append(h.Reasons, reason)
+}
+
+// IsReady 整体状态是否可以接收流量 (healthy 或 degraded)
+func (r *HealthReport) IsReady() bool {
+	return r.Status != healthDown
+}
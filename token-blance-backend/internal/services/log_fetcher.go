@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// eth_getLogs 自适应区块范围的上下限
+const (
+	minBlockRange = uint64(1)
+	maxBlockRange = uint64(5000)
+)
+
+// rangeLimitErrors RPC 节点对查询范围或结果数量超限返回的错误信息
+var rangeLimitErrors = []string{
+	"more than 10000 results",
+	"query returned more than",
+	"block range",
+	"range too large",
+	"range is too large",
+	"exceed maximum block range",
+	"too many blocks",
+	"too many results",
+	"response size exceeded",
+	"response size should not",
+	"range limit exceeded",
+}
+
+// rateLimitErrors 节点限流返回的错误信息，其中常带有 "limit exceeded"，不属于范围超限
+var rateLimitErrors = []string{
+	"rate limit",
+	"too many requests",
+	"request rate",
+}
+
+// isRangeLimitError 判断是否为查询范围/结果数超限错误（缩小范围后可以重试）
+//
+// 已经分类的 RPCError 直接使用分类结果；限流错误不算范围超限，缩小范围只会让请求更多。
+func isRangeLimitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Kind == rpcErrorRangeLimit
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range rateLimitErrors {
+		if strings.Contains(message, pattern) {
+			return false
+		}
+	}
+	for _, pattern := range rangeLimitErrors {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchLogs 查询 [from, to] 内的日志，遇到范围或结果数超限时将范围折半重试
+//
+// 返回实际查询到的最后一个区块和查询成功时使用的区块范围；
+// 缩小到 minBlockRange 仍然失败时返回错误。
+func fetchLogs(ctx context.Context, client ChainBackend, query ethereum.FilterQuery, from, to uint64) ([]types.Log, uint64, uint64, error) {
+	blockRange := to - from + 1
+	for {
+		query.FromBlock = new(big.Int).SetUint64(from)
+		query.ToBlock = new(big.Int).SetUint64(to)
+
+		logs, err := client.FilterLogs(ctx, query)
+		if err == nil {
+			return logs, to, blockRange, nil
+		}
+		if !isRangeLimitError(err) || blockRange <= minBlockRange {
+			return nil, 0, blockRange, err
+		}
+
+		blockRange = blockRange / 2
+		if blockRange < minBlockRange {
+			blockRange = minBlockRange
+		}
+		to = from + blockRange - 1
+		middleware.Warn("✂️ 查询区块范围超限，缩小为 %d 个区块重试 (%d - %d): %v", blockRange, from, to, err)
+	}
+}
+
+// growBlockRange 查询成功后逐步扩大区块范围 (每次增加25%)
+func growBlockRange(blockRange uint64) uint64 {
+	blockRange += blockRange/4 + 1
+	if blockRange > maxBlockRange {
+		blockRange = maxBlockRange
+	}
+	return blockRange
+}
+
+// saveBlockRange 记录链的最佳查询区块范围，重启后继续使用
+func saveBlockRange(db *gorm.DB, chainName string, blockRange uint64) error {
+	err := db.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ?", chainName).
+		Update("block_range", blockRange).Error
+	if err != nil {
+		return fmt.Errorf("保存 %s 区块范围失败: %v", chainName, err)
+	}
+	return nil
+}
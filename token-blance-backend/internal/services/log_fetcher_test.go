@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFetchLogsHalvesRange(t *testing.T) {
+	rangeErr := errors.New("query returned more than 10000 results")
+
+	tests := []struct {
+		name       string
+		from, to   uint64
+		maxRange   uint64 // 节点接受的最大区块范围，0 表示总是失败
+		err        error  // 超过 maxRange 时返回的错误
+		wantTo     uint64
+		wantRange  uint64
+		wantQuery  [][2]uint64
+		wantErrMsg string
+	}{
+		{
+			name: "accepted at once", from: 100, to: 199, maxRange: 100, err: rangeErr,
+			wantTo: 199, wantRange: 100, wantQuery: [][2]uint64{{100, 199}},
+		},
+		{
+			name: "halved until accepted", from: 100, to: 199, maxRange: 30, err: rangeErr,
+			wantTo: 124, wantRange: 25, wantQuery: [][2]uint64{{100, 199}, {100, 149}, {100, 124}},
+		},
+		{
+			name: "fails at one block", from: 100, to: 103, err: rangeErr,
+			wantRange:  1,
+			wantQuery:  [][2]uint64{{100, 103}, {100, 101}, {100, 100}},
+			wantErrMsg: rangeErr.Error(),
+		},
+		{
+			// 限流正文中的 "limit exceeded" 不是范围超限，不能缩小范围
+			name: "rate limit is not a range limit", from: 100, to: 199,
+			err:        errors.New("429 Too Many Requests: rate limit exceeded"),
+			wantRange:  100,
+			wantQuery:  [][2]uint64{{100, 199}},
+			wantErrMsg: "429 Too Many Requests: rate limit exceeded",
+		},
+		{
+			name: "classified rate limit from the pool", from: 100, to: 199,
+			err:        &RPCError{Method: "eth_getLogs", Kind: rpcErrorTransient, Err: errors.New("rate limit exceeded")},
+			wantRange:  100,
+			wantQuery:  [][2]uint64{{100, 199}},
+			wantErrMsg: "[transient] eth_getLogs: rate limit exceeded",
+		},
+		{
+			name: "other errors are not retried", from: 100, to: 199, err: errors.New("connection refused"),
+			wantRange:  100,
+			wantQuery:  [][2]uint64{{100, 199}},
+			wantErrMsg: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries [][2]uint64
+			client := &stubChain{filterLogs: func(query ethereum.FilterQuery) ([]types.Log, error) {
+				from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+				queries = append(queries, [2]uint64{from, to})
+				if to-from+1 > tt.maxRange {
+					return nil, tt.err
+				}
+				return []types.Log{{BlockNumber: from}}, nil
+			}}
+
+			logs, to, blockRange, err := fetchLogs(context.Background(), client, ethereum.FilterQuery{}, tt.from, tt.to)
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("err = %v, want %s", err, tt.wantErrMsg)
+				}
+			} else if err != nil || len(logs) != 1 || to != tt.wantTo {
+				t.Fatalf("fetchLogs = (%v, %d, %v), want to %d", logs, to, err, tt.wantTo)
+			}
+			if blockRange != tt.wantRange {
+				t.Errorf("blockRange = %d, want %d", blockRange, tt.wantRange)
+			}
+			if len(queries) != len(tt.wantQuery) {
+				t.Fatalf("queries = %v, want %v", queries, tt.wantQuery)
+			}
+			for i := range queries {
+				if queries[i] != tt.wantQuery[i] {
+					t.Fatalf("queries = %v, want %v", queries, tt.wantQuery)
+				}
+			}
+		})
+	}
+}
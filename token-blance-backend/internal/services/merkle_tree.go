@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// merkleLeaf 一个地址的分配金额
+type merkleLeaf struct {
+	Address   common.Address
+	Amount    *big.Int
+	Hash      common.Hash
+	TreeIndex int
+}
+
+// merkleTree 与 OpenZeppelin StandardMerkleTree 布局一致的完全二叉树
+//
+// 叶子按哈希升序排列后倒序放在数组末尾，nodes[0] 为根，节点 i 的子节点为 2i+1 和 2i+2。
+// 相同的分配生成的根和证明与 JS 库 @openzeppelin/merkle-tree 完全一致。
+type merkleTree struct {
+	nodes  []common.Hash
+	leaves []merkleLeaf
+}
+
+// merkleLeafHash 叶子哈希: keccak256(bytes.concat(keccak256(abi.encode(address, uint256))))
+func merkleLeafHash(address common.Address, amount *big.Int) common.Hash {
+	encoded := make([]byte, 0, 64)
+	encoded = append(encoded, common.LeftPadBytes(address.Bytes(), 32)...)
+	encoded = append(encoded, math.U256Bytes(new(big.Int).Set(amount))...)
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded))
+}
+
+// merkleHashPair 两个节点排序后拼接哈希，与 MerkleProof 的 _hashPair 一致
+func merkleHashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a.Bytes(), b.Bytes())
+}
+
+// buildMerkleTree 生成 Merkle 树，地址不能重复，金额必须在 uint256 范围内
+func buildMerkleTree(leaves []merkleLeaf) (*merkleTree, error) {
+	if len(leaves) == 0 {
+		return nil, fmt.Errorf("%w: 没有可分配的地址", ErrInvalidDistribution)
+	}
+	seen := make(map[common.Address]bool, len(leaves))
+	for i := range leaves {
+		leaf := &leaves[i]
+		if seen[leaf.Address] {
+			return nil, fmt.Errorf("%w: 地址 %s 重复", ErrInvalidDistribution, leaf.Address.Hex())
+		}
+		seen[leaf.Address] = true
+		if leaf.Amount.Sign() < 0 || leaf.Amount.BitLen() > 256 {
+			return nil, fmt.Errorf("%w: 地址 %s 的金额超出 uint256 范围", ErrInvalidDistribution, leaf.Address.Hex())
+		}
+		leaf.Hash = merkleLeafHash(leaf.Address, leaf.Amount)
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].Hash.Bytes(), leaves[j].Hash.Bytes()) < 0
+	})
+
+	nodes := make([]common.Hash, 2*len(leaves)-1)
+	for i := range leaves {
+		leaves[i].TreeIndex = len(nodes) - 1 - i
+		nodes[leaves[i].TreeIndex] = leaves[i].Hash
+	}
+	for i := len(nodes) - 1 - len(leaves); i >= 0; i-- {
+		nodes[i] = merkleHashPair(nodes[2*i+1], nodes[2*i+2])
+	}
+	return &merkleTree{nodes: nodes, leaves: leaves}, nil
+}
+
+// root Merkle 根
+func (t *merkleTree) root() common.Hash {
+	return t.nodes[0]
+}
+
+// proof 从叶子到根路径上每一层的兄弟节点
+func (t *merkleTree) proof(treeIndex int) []string {
+	proof := []string{}
+	for i := treeIndex; i > 0; i = (i - 1) / 2 {
+		sibling := i + 1
+		if i%2 == 0 {
+			sibling = i - 1
+		}
+		proof = append(proof, t.nodes[sibling].Hex())
+	}
+	return proof
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 与 @openzeppelin/merkle-tree 的 StandardMerkleTree.of(values, ["address", "uint256"]) 结果一致
+func TestBuildMerkleTreeKnownVector(t *testing.T) {
+	first := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	second := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	amount := func(value string) *big.Int {
+		n, _ := new(big.Int).SetString(value, 10)
+		return n
+	}
+
+	tree, err := buildMerkleTree([]merkleLeaf{
+		{Address: first, Amount: amount("5000000000000000000")},
+		{Address: second, Amount: amount("2500000000000000000")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := tree.root().Hex(); root != "0xd4dee0beab2d53f2cc83e567171bd2820e49898130a22622b10ead383e90bd77" {
+		t.Fatalf("root = %s", root)
+	}
+
+	want := map[common.Address]struct {
+		treeIndex int
+		proof     []string
+	}{
+		first:  {1, []string{"0xb92c48e9d7abe27fd8dfd6b5dfdbfb1c9a463f80c712b66f3a5180a090cccafc"}},
+		second: {2, []string{"0xeb02c421cfa48976e66dfb29120745909ea3a0f843456c263cf8f1253483e283"}},
+	}
+	for _, leaf := range tree.leaves {
+		expected := want[leaf.Address]
+		if leaf.TreeIndex != expected.treeIndex {
+			t.Errorf("%s treeIndex = %d, want %d", leaf.Address.Hex(), leaf.TreeIndex, expected.treeIndex)
+		}
+		if proof := tree.proof(leaf.TreeIndex); !reflect.DeepEqual(proof, expected.proof) {
+			t.Errorf("%s proof = %v, want %v", leaf.Address.Hex(), proof, expected.proof)
+		}
+	}
+}
+
+func TestBuildMerkleTreeRejectsInvalidLeaves(t *testing.T) {
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	tests := []struct {
+		name   string
+		leaves []merkleLeaf
+	}{
+		{name: "empty"},
+		{name: "duplicate address", leaves: []merkleLeaf{{Address: address, Amount: big.NewInt(1)}, {Address: address, Amount: big.NewInt(2)}}},
+		{name: "negative amount", leaves: []merkleLeaf{{Address: address, Amount: big.NewInt(-1)}}},
+		{name: "amount overflows uint256", leaves: []merkleLeaf{{Address: address, Amount: new(big.Int).Lsh(big.NewInt(1), 256)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildMerkleTree(tt.leaves); !errors.Is(err, ErrInvalidDistribution) {
+				t.Fatalf("err = %v, want ErrInvalidDistribution", err)
+			}
+		})
+	}
+}
@@ -1,20 +1,18 @@
 package services
 
 import (
-	"context"
 	"fmt"
-	"math/big"
+	"strings"
 	"sync"
 	"time"
 	"token-balance/config"
 	"token-balance/internal/middleware"
 	"token-balance/internal/models"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // MultiChainService 多链服务
@@ -25,15 +23,14 @@ import (
 // - ✅ 支持多链同时监听
 // - ✅ 每个链独立的事件处理
 // - ✅ 统一的余额管理
-// - ✅ 链配置动态管理
+// - ✅ 链配置动态管理 (链定义保存在 chain_definitions 表，可单独启停)
 // - ✅ 错误隔离和恢复机制
 type MultiChainService struct {
-	db            *gorm.DB
-	chains        map[string]*ChainClient
-	cfg           *config.Config
-	wg            sync.WaitGroup
-	stopChan      chan struct{}
-	mu            sync.RWMutex
+	db     *gorm.DB
+	chains map[string]*ChainClient
+	cfg    *config.Config
+	mu     sync.RWMutex // 保护 chains
+	opMu   sync.Mutex   // 串行执行启动、停止等管理操作
 }
 
 // ChainClient 单链客户端
@@ -41,358 +38,552 @@ type ChainClient struct {
 	Name         string
 	ChainID      int64
 	RPCURL       string
-	Client       *ethclient.Client
+	WSURL        string
+	Client       *RPCPool
 	ContractAddr common.Address
 	Enabled      bool
-	LastBlock    uint64
+	StartBlock   uint64        // 合约部署区块
+	Finality     finalityPolicy
 	Service      *EventService // 复用单链事件服务逻辑
+	StartedAt    time.Time
+
+	watcher *chainWatcher
+	stop    chan struct{} // 关闭后该链的监听循环退出
+	done    chan struct{} // 监听循环退出后关闭
 }
 
 // NewMultiChainService 创建多链服务
 func NewMultiChainService(db *gorm.DB, cfg *config.Config) *MultiChainService {
 	return &MultiChainService{
-		db:       db,
-		chains:   make(map[string]*ChainClient),
-		cfg:      cfg,
-		stopChan: make(chan struct{}),
+		db:     db,
+		chains: make(map[string]*ChainClient),
+		cfg:    cfg,
 	}
 }
 
-// StartAllChains 启动所有配置的链
+// StartAllChains 启动所有已启用的链
+//
+// 链定义来自 chain_definitions 表，首次运行时用 .env 中的链配置初始化。
 func (mcs *MultiChainService) StartAllChains() error {
 	middleware.Info("🌐 启动多链事件监听服务...")
 
-	chains := mcs.cfg.GetSupportedChains()
-	
-	for chainName, chainConfig := range chains {
+	chains, err := loadChainConfigs(mcs.db, mcs.cfg)
+	if err != nil {
+		middleware.Error("❌ 读取链定义失败: %v", err)
+		return err
+	}
+
+	for _, chainName := range sortedChainNames(chains) {
+		chainConfig := chains[chainName]
 		if !chainConfig.Enabled {
 			middleware.Info("⏭️ 跳过已禁用的链: %s", chainName)
 			continue
 		}
 
-		if err := mcs.startChain(chainName, chainConfig); err != nil {
+		if err := mcs.StartChain(chainName); err != nil {
 			middleware.Error("❌ 启动链 %s 失败: %v", chainName, err)
 			continue
 		}
 	}
 
-	if len(mcs.chains) == 0 {
+	running := mcs.runningCount()
+	if running == 0 {
 		middleware.Error("❌ 没有可用的链配置")
 		return fmt.Errorf("没有可用的链配置")
 	}
 
-	middleware.Info("✅ 成功启动 %d 个链的监听服务", len(mcs.chains))
+	middleware.Info("✅ 成功启动 %d 个链的监听服务", running)
+	return nil
+}
+
+// StartChain 启动单个链的监听，不影响其他链；已在运行时返回错误
+func (mcs *MultiChainService) StartChain(name string) error {
+	mcs.opMu.Lock()
+	defer mcs.opMu.Unlock()
+
+	if mcs.running(name) {
+		return fmt.Errorf("链 %s 已在运行", name)
+	}
+
+	definition, err := getChainDefinition(mcs.db, name)
+	if err != nil {
+		return err
+	}
+	return mcs.startChain(definition)
+}
+
+// StopChain 停止单个链的监听并等待其退出，不影响其他链
+func (mcs *MultiChainService) StopChain(name string) error {
+	mcs.opMu.Lock()
+	defer mcs.opMu.Unlock()
+
+	if !mcs.stopChain(name) {
+		return fmt.Errorf("链 %s 没有在运行", name)
+	}
 	return nil
 }
 
-// startChain 启动单个链
-func (mcs *MultiChainService) startChain(name string, config config.ChainConfig) error {
-	middleware.Info("🔗 启动链 %s (ChainID: %d)", name, config.ChainID)
+// RestartChain 重新读取链定义并重启单个链的监听，没有运行时直接启动
+func (mcs *MultiChainService) RestartChain(name string) error {
+	mcs.opMu.Lock()
+	defer mcs.opMu.Unlock()
 
-	// 连接到链RPC
-	client, err := ethclient.Dial(config.RPCURL)
+	definition, err := getChainDefinition(mcs.db, name)
 	if err != nil {
-		return fmt.Errorf("连接 %s RPC失败: %v", name, err)
+		return err
+	}
+	mcs.stopChain(name)
+	return mcs.startChain(definition)
+}
+
+// EnableChain 启用链：服务启动时自动监听，并立即启动
+func (mcs *MultiChainService) EnableChain(name string) error {
+	if err := mcs.setChainEnabled(name, true); err != nil {
+		return err
 	}
+	if mcs.running(name) {
+		return nil
+	}
+	return mcs.StartChain(name)
+}
 
-	// 测试连接并获取链ID
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// DisableChain 禁用链：停止监听，服务重启后也不再自动监听
+func (mcs *MultiChainService) DisableChain(name string) error {
+	if err := mcs.setChainEnabled(name, false); err != nil {
+		return err
+	}
+
+	mcs.opMu.Lock()
+	defer mcs.opMu.Unlock()
+	mcs.stopChain(name)
+	return nil
+}
 
-	chainID, err := client.ChainID(ctx)
+// setChainEnabled 修改链定义的启用状态
+func (mcs *MultiChainService) setChainEnabled(name string, enabled bool) error {
+	definition, err := getChainDefinition(mcs.db, name)
 	if err != nil {
-		client.Close()
-		return fmt.Errorf("获取 %s 链ID失败: %v", name, err)
+		return err
+	}
+	return mcs.db.Model(definition).Update("enabled", enabled).Error
+}
+
+// ListChainDefinitions 获取所有链定义
+func (mcs *MultiChainService) ListChainDefinitions() ([]models.ChainDefinition, error) {
+	if err := seedChainDefinitions(mcs.db, mcs.cfg); err != nil {
+		return nil, err
+	}
+
+	var definitions []models.ChainDefinition
+	err := mcs.db.Order("id asc").Find(&definitions).Error
+	return definitions, err
+}
+
+// GetChainDefinition 获取单个链定义
+func (mcs *MultiChainService) GetChainDefinition(name string) (*models.ChainDefinition, error) {
+	return getChainDefinition(mcs.db, name)
+}
+
+// CreateChainDefinition 新增链定义，启用时立即启动监听
+func (mcs *MultiChainService) CreateChainDefinition(input ChainDefinitionInput) (*models.ChainDefinition, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, fmt.Errorf("链名称不能为空")
+	}
+	if input.ChainID <= 0 {
+		return nil, fmt.Errorf("无效的链ID: %d", input.ChainID)
 	}
 
-	if chainID.Int64() != config.ChainID {
-		client.Close()
-		return fmt.Errorf("%s 链ID不匹配: 期望 %d, 实际 %d", 
-			name, config.ChainID, chainID.Int64())
+	definition := models.ChainDefinition{
+		Name:               name,
+		DisplayName:        name,
+		ChainID:            input.ChainID,
+		Finality:           finalityDepth,
+		ConfirmationBlocks: defaultConfirmationBlocks,
+		Enabled:            true,
+	}
+	if err := applyChainDefinitionInput(&definition, input); err != nil {
+		return nil, err
 	}
 
-	middleware.Info("✅ %s 连接成功 (ChainID: %d, RPC: %s)", 
-		name, config.ChainID, config.RPCURL)
+	result := mcs.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&definition)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("链 %s 或链ID %d 已存在", name, input.ChainID)
+	}
+	middleware.Info("🌐 新增链定义: %s (ChainID: %d)", name, input.ChainID)
+
+	if definition.Enabled {
+		if err := mcs.StartChain(name); err != nil {
+			return &definition, fmt.Errorf("链定义已保存，但启动失败: %v", err)
+		}
+	}
+	return &definition, nil
+}
+
+// UpdateChainDefinition 修改链定义，正在运行的链按新定义重启
+func (mcs *MultiChainService) UpdateChainDefinition(name string, input ChainDefinitionInput) (*models.ChainDefinition, error) {
+	definition, err := getChainDefinition(mcs.db, name)
+	if err != nil {
+		return nil, err
+	}
+	if input.ChainID != 0 && input.ChainID != definition.ChainID {
+		return nil, fmt.Errorf("链ID不能修改 (当前 %d)", definition.ChainID)
+	}
+	if err := applyChainDefinitionInput(definition, input); err != nil {
+		return nil, err
+	}
+	if err := mcs.db.Save(definition).Error; err != nil {
+		return nil, err
+	}
+	middleware.Info("🌐 修改链定义: %s", name)
+
+	if mcs.running(name) {
+		if !definition.Enabled {
+			return definition, mcs.StopChain(name)
+		}
+		if err := mcs.RestartChain(name); err != nil {
+			return definition, fmt.Errorf("链定义已保存，但重启失败: %v", err)
+		}
+	}
+	return definition, nil
+}
+
+// DeleteChainDefinition 停止并删除链定义，已同步的数据和同步游标保留
+func (mcs *MultiChainService) DeleteChainDefinition(name string) error {
+	definition, err := getChainDefinition(mcs.db, name)
+	if err != nil {
+		return err
+	}
+
+	mcs.opMu.Lock()
+	mcs.stopChain(name)
+	mcs.opMu.Unlock()
+
+	if err := mcs.db.Delete(definition).Error; err != nil {
+		return err
+	}
+	middleware.Info("🌐 删除链定义: %s", name)
+	return nil
+}
+
+// startChain 连接链并启动独立的监听 goroutine，调用方持有 opMu
+func (mcs *MultiChainService) startChain(definition *models.ChainDefinition) error {
+	name := definition.Name
+	chainConfig := chainConfigFromDefinition(*definition)
+	middleware.Info("🔗 启动链 %s (ChainID: %d)", name, chainConfig.ChainID)
+
+	// 连接到链的所有RPC端点，并校验链ID
+	client, err := DialRPCPool(name, chainConfig.RPCURLs, chainConfig.ChainID)
+	if err != nil {
+		return err
+	}
+
+	middleware.Info("✅ %s 连接成功 (ChainID: %d, RPC端点: %d 个)", 
+		name, chainConfig.ChainID, len(client.Stats()))
+
+	// 链定义中的合约自动登记到代币表
+	for _, contract := range definition.Contracts {
+		if err := registerConfiguredToken(mcs.db, name, chainConfig.ChainID, common.HexToAddress(contract), chainConfig.StartBlock); err != nil {
+			middleware.Warn("⚠️ %v", err)
+		}
+	}
+
+	finality := newFinalityPolicy(name, chainConfig.Finality, chainConfig.ConfirmationBlocks)
+	middleware.Info("🛡️ %s 确认策略: %s", name, finality)
 
 	// 创建事件服务
 	eventService := &EventService{
-		db:       mcs.db,
-		client:   client,
-		contract: common.HexToAddress(config.ContractAddr),
+		db:         mcs.db,
+		client:     client,
+		chainName:  name,
+		chainID:    chainConfig.ChainID,
+		startBlock: chainConfig.StartBlock,
+		wsURL:      chainConfig.WSURL,
+		finality:   finality,
 	}
 
 	// 创建链客户端
 	chainClient := &ChainClient{
 		Name:         name,
-		ChainID:      config.ChainID,
-		RPCURL:       config.RPCURL,
+		ChainID:      chainConfig.ChainID,
+		RPCURL:       chainConfig.RPCURL,
+		WSURL:        chainConfig.WSURL,
 		Client:       client,
-		ContractAddr: common.HexToAddress(config.ContractAddr),
-		Enabled:      true,
-		LastBlock:    0,
+		ContractAddr: common.HexToAddress(chainConfig.ContractAddr),
+		Enabled:      definition.Enabled,
+		StartBlock:   chainConfig.StartBlock,
+		Finality:     finality,
 		Service:      eventService,
+		StartedAt:    time.Now(),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
 	}
 
+	chainClient.watcher = newChainWatcher(mcs.chainSyncer(chainClient), chainConfig.WSURL)
+
 	mcs.mu.Lock()
 	mcs.chains[name] = chainClient
 	mcs.mu.Unlock()
 
 	// 启动该链的独立监听
-	mcs.wg.Add(1)
 	go mcs.monitorChain(chainClient)
 
 	return nil
 }
 
+// stopChain 通知单个链的监听退出并等待，链没有运行时返回 false，调用方持有 opMu
+func (mcs *MultiChainService) stopChain(name string) bool {
+	mcs.mu.Lock()
+	chain, ok := mcs.chains[name]
+	delete(mcs.chains, name)
+	mcs.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	close(chain.stop)
+	<-chain.done
+	return true
+}
+
+// running 链是否正在监听
+func (mcs *MultiChainService) running(name string) bool {
+	mcs.mu.RLock()
+	defer mcs.mu.RUnlock()
+	_, ok := mcs.chains[name]
+	return ok
+}
+
+// runningCount 正在监听的链数量
+func (mcs *MultiChainService) runningCount() int {
+	mcs.mu.RLock()
+	defer mcs.mu.RUnlock()
+	return len(mcs.chains)
+}
+
 // monitorChain 监听单个链的事件
+//
+// 配置了 WebSocket 端点时订阅新区块，订阅断开时回退为15秒轮询。
+// chain.stop 关闭后退出并关闭 RPC 连接。
 func (mcs *MultiChainService) monitorChain(chain *ChainClient) {
-	defer mcs.wg.Done()
+	defer close(chain.done)
 	defer chain.Client.Close()
 
 	middleware.Info("🎧 开始监听链 %s 的事件...", chain.Name)
 
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
-
-	var lastBlockNumber uint64
+	chain.watcher.run(chain.stop)
+	middleware.Info("🛑 停止监听链 %s", chain.Name)
+}
 
-	for {
-		select {
-		case <-mcs.stopChan:
-			middleware.Info("🛑 停止监听链 %s", chain.Name)
-			return
-		case <-ticker.C:
-			if err := mcs.processChainEvents(chain, &lastBlockNumber); err != nil {
-				middleware.Error("❌ 处理链 %s 事件失败: %v", chain.Name, err)
-			}
-		}
+// chainSyncer 创建链的同步器
+//
+// 从 chain_sync_status 中的游标继续处理，事件与游标在同一事务中提交。
+func (mcs *MultiChainService) chainSyncer(chain *ChainClient) *chainSyncer {
+	return &chainSyncer{
+		db:         mcs.db,
+		client:     chain.Client,
+		chainName:  chain.Name,
+		chainID:    chain.ChainID,
+		startBlock: chain.StartBlock,
+		finality:   chain.Finality,
+		decode: func(log *types.Log, blockTime time.Time) decodedLog {
+			return mcs.decodeChainEvent(chain, log, blockTime)
+		},
 	}
 }
 
-// processChainEvents 处理单个链的事件
-func (mcs *MultiChainService) processChainEvents(chain *ChainClient, lastBlockNumber *uint64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// decodeChainEvent 把链事件解码为待写入的事件日志和 Transfer 事件
+//
+// 同步器的解码阶段并行调用，写入时以 (chain_id, tx_hash, log_index) 去重。
+// blockTime 为日志所在区块的链上时间戳。
+func (mcs *MultiChainService) decodeChainEvent(chain *ChainClient, log *types.Log, blockTime time.Time) decodedLog {
+	return decodeLog(chain.ChainID, log, blockTime)
+}
 
-	// 获取最新区块
-	header, err := chain.Client.HeaderByNumber(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("获取 %s 最新区块失败: %v", chain.Name, err)
-	}
+// Stop 停止所有链监听
+func (mcs *MultiChainService) Stop() {
+	middleware.Info("🛑 停止多链监听服务...")
 
-	currentBlockNumber := header.Number.Uint64()
+	mcs.opMu.Lock()
+	defer mcs.opMu.Unlock()
 
-	// 六区块延迟确认
-	const confirmationBlocks = uint64(6)
-	safeLatestBlock := currentBlockNumber
-	if currentBlockNumber > confirmationBlocks {
-		safeLatestBlock = currentBlockNumber - confirmationBlocks
+	mcs.mu.RLock()
+	names := make([]string, 0, len(mcs.chains))
+	for name := range mcs.chains {
+		names = append(names, name)
 	}
+	mcs.mu.RUnlock()
 
-	// 首次运行或区块范围过大时调整
-	maxBlockRange := uint64(100)
-	if *lastBlockNumber == 0 || safeLatestBlock-*lastBlockNumber > maxBlockRange {
-		*lastBlockNumber = safeLatestBlock - maxBlockRange
-		if *lastBlockNumber < 1 {
-			*lastBlockNumber = 1
-		}
+	for _, name := range names {
+		mcs.stopChain(name)
 	}
 
-	// 查询Transfer事件
-	var addresses []common.Address
-	if chain.ContractAddr != (common.Address{}) {
-		addresses = []common.Address{chain.ContractAddr}
-	}
+	middleware.Info("✅ 多链监听服务已停止")
+}
 
-	query := ethereum.FilterQuery{
-		FromBlock: new(big.Int).SetUint64(*lastBlockNumber),
-		ToBlock:   new(big.Int).SetUint64(safeLatestBlock),
-		Addresses: addresses,
-		Topics: [][]common.Hash{
-			{common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")},
-		},
+// GetChainStatus 获取链状态
+//
+// 同步进度来自 chain_sync_status 表，而不是内存中的计数；
+// safe/finalized 高度实时向节点查询，节点不支持对应标签时为 null。
+// 已定义但没有运行的链也会列出 (running 为 false)。
+func (mcs *MultiChainService) GetChainStatus() map[string]interface{} {
+	// 复制运行中的链后释放锁，查询安全/最终确认高度的 RPC 调用不持有锁
+	mcs.mu.RLock()
+	chains := make(map[string]*ChainClient, len(mcs.chains))
+	for name, chain := range mcs.chains {
+		chains[name] = chain
 	}
+	mcs.mu.RUnlock()
 
-	logs, err := chain.Client.FilterLogs(ctx, query)
-	if err != nil {
-		return fmt.Errorf("查询 %s 事件日志失败: %v", chain.Name, err)
+	var definitions []models.ChainDefinition
+	if err := mcs.db.Find(&definitions).Error; err != nil {
+		middleware.Error("查询链定义失败: %v", err)
 	}
 
-	if len(logs) > 0 {
-		middleware.Info("📊 %s 查询到 %d 个事件 (区块: %d - %d)", 
-			chain.Name, len(logs), *lastBlockNumber, safeLatestBlock)
-
-		successCount := 0
-		for _, log := range logs {
-			if err := mcs.saveChainEvent(chain, &log); err != nil {
-				middleware.Error("❌ %s 保存事件失败: %v", chain.Name, err)
-			} else {
-				successCount++
-			}
-		}
-		middleware.Info("✅ %s 成功处理 %d/%d 个事件", chain.Name, successCount, len(logs))
+	names := make([]string, 0, len(chains)+len(definitions))
+	for name := range chains {
+		names = append(names, name)
 	}
-
-	*lastBlockNumber = safeLatestBlock
-	return nil
-}
-
-// saveChainEvent 保存链事件
-func (mcs *MultiChainService) saveChainEvent(chain *ChainClient, log *types.Log) error {
-	eventLog := models.EventLog{
-		TxHash:          log.TxHash.Hex(),
-		BlockNumber:      log.BlockNumber,
-		ContractAddress:  log.Address.Hex(),
-		Data:            fmt.Sprintf("chain:%s,%s", chain.Name, common.Bytes2Hex(log.Data)),
-		Timestamp:       time.Now(),
-	}
-
-	// 解析Transfer事件
-	transferEventSig := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
-	if len(log.Topics) >= 3 && log.Topics[0] == transferEventSig {
-		eventLog.EventName = "Transfer"
-		
-		fromAddress := common.BytesToAddress(log.Topics[1].Bytes())
-		toAddress := common.BytesToAddress(log.Topics[2].Bytes())
-		
-		var amount string = "0"
-		if len(log.Data) >= 32 {
-			amount = new(big.Int).SetBytes(log.Data).String()
+	for _, definition := range definitions {
+		if _, ok := chains[definition.Name]; !ok {
+			names = append(names, definition.Name)
 		}
-		
-		eventLog.UserAddress = toAddress.Hex()
-		eventLog.Amount = amount
-		eventLog.Data = fmt.Sprintf("chain:%s,from:%s,to:%s,amount:%s", 
-			chain.Name, fromAddress.Hex(), toAddress.Hex(), amount)
-		
-		// 更新用户余额
-		mcs.updateUserBalanceFromMultiChain(chain.Name, fromAddress.Hex(), toAddress.Hex(), amount, log.TxHash.Hex(), log.BlockNumber)
 	}
 
-	return mcs.db.Create(&eventLog).Error
-}
-
-// updateUserBalanceFromMultiChain 从多链Transfer事件更新用户余额
-func (mcs *MultiChainService) updateUserBalanceFromMultiChain(chainName, fromAddr, toAddr, amount, txHash string, blockNumber uint64) {
-	// 接收方余额增加
-	if toAddr != "0x0000000000000000000000000000000000000000000" {
-		mcs.updateSingleUserBalanceOnChain(chainName, toAddr, amount, "transfer_in", txHash, blockNumber)
+	syncStatus := make(map[string]models.ChainSyncStatus)
+	var records []models.ChainSyncStatus
+	if err := mcs.db.Where("chain_name IN ?", names).Find(&records).Error; err != nil {
+		middleware.Error("查询链同步状态失败: %v", err)
 	}
-	
-	// 发送方余额处理（如果是mint事件，from可能是零地址）
-	if fromAddr != "0x0000000000000000000000000000000000000000000" {
-		mcs.recordTransferEventOnChain(chainName, fromAddr, amount, "transfer_out", txHash, blockNumber)
+	for _, record := range records {
+		syncStatus[record.ChainName] = record
 	}
-}
 
-// updateSingleUserBalanceOnChain 更新单链用户余额
-func (mcs *MultiChainService) updateSingleUserBalanceOnChain(chainName, address, amount, changeType, txHash string, blockNumber uint64) {
-	var user models.User
-	err := mcs.db.Where("id = ?", address).First(&user).Error
-	
-	if err != nil && err != gorm.ErrRecordNotFound {
-		middleware.Error("查询用户失败: %v", err)
-		return
-	}
-
-	if err == gorm.ErrRecordNotFound {
-		user = models.User{
-			ID:          address,
-			Balance:     "0",
-			TotalPoints: 0,
-		}
-		if err := mcs.db.Create(&user).Error; err != nil {
-			middleware.Error("创建用户失败: %v", err)
-			return
+	status := make(map[string]interface{})
+	for name, chain := range chains {
+		record := syncStatus[name]
+		safeBlock, finalizedBlock := finalityHeights(chain.Client)
+		status[name] = map[string]interface{}{
+			"name":          chain.Name,
+			"chain_id":      chain.ChainID,
+			"rpc_url":       redactRPCURL(chain.RPCURL),
+			"contract_addr": chain.ContractAddr.Hex(),
+			"enabled":       chain.Enabled,
+			"last_block":    record.LastBlock,
+			"latest_block":  record.LatestBlock,
+			"block_delay":   record.BlockDelay,
+			"block_range":   record.BlockRange,
+			"finality":        chain.Finality,
+			"safe_block":      safeBlock,
+			"finalized_block": finalizedBlock,
+			"ingest_mode":   chain.watcher.Mode(),
+			"rpc_endpoints": chain.Client.Stats(),
+			"circuit_state": breakerFor(chain.Name).State(),
+			"last_error":    record.LastError,
+			"last_error_time": record.LastErrorTime,
+			"consecutive_errors": record.ConsecutiveErrors,
+			"sync_status":   record.Status,
+			"last_synced":   record.UpdatedAt,
+			"running":       true,
+			"started_at":    chain.StartedAt,
 		}
 	}
 
-	oldBalance := user.Balance
-	var newBalance string
-	
-	if changeType == "transfer_in" {
-		oldAmount := new(big.Int)
-		if oldBalanceStr := user.Balance; oldBalanceStr != "" {
-			oldAmount, _ = new(big.Int).SetString(oldBalanceStr, 10)
+	for _, definition := range definitions {
+		if _, ok := chains[definition.Name]; ok {
+			continue
 		}
-		
-		addAmount := new(big.Int)
-		if amount != "" {
-			addAmount, _ = new(big.Int).SetString(amount, 10)
+		record := syncStatus[definition.Name]
+		status[definition.Name] = map[string]interface{}{
+			"name":         definition.Name,
+			"chain_id":     definition.ChainID,
+			"enabled":      definition.Enabled,
+			"finality":     newFinalityPolicy(definition.Name, definition.Finality, definition.ConfirmationBlocks),
+			"last_block":   record.LastBlock,
+			"latest_block": record.LatestBlock,
+			"sync_status":  record.Status,
+			"last_synced":  record.UpdatedAt,
+			"running":      false,
 		}
-		
-		newBalance = new(big.Int).Add(oldAmount, addAmount).String()
-	} else {
-		newBalance = user.Balance
 	}
 
-	if err := mcs.db.Model(&user).Update("balance", newBalance).Error; err != nil {
-		middleware.Error("更新用户余额失败: %v", err)
-		return
+	return status
+}
+
+
+// GetChainEvents 分页获取指定链的事件日志
+func (mcs *MultiChainService) GetChainEvents(chainName, page, pageSize string) (*models.PaginatedData, error) {
+	definition, err := getChainDefinition(mcs.db, chainName)
+	if err != nil {
+		return nil, err
 	}
 
-	history := models.UserBalanceHistory{
-		UserAddress: address,
-		OldBalance:  oldBalance,
-		NewBalance:  newBalance,
-		ChangeAmount: amount,
-		ChangeType:  changeType,
-		TxHash:      txHash,
-		BlockNumber: blockNumber,
-		Timestamp:   time.Now(),
+	var events []models.EventLog
+	var total int64
+
+	query := mcs.db.Model(&models.EventLog{}).Where("chain_id = ?", definition.ChainID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
 	}
 
-	if err := mcs.db.Create(&history).Error; err != nil {
-		middleware.Error("记录余额历史失败: %v", err)
+	offset := (StringToInt(page) - 1) * StringToInt(pageSize)
+	err = query.Order("block_number desc, log_index desc").
+		Offset(offset).
+		Limit(StringToInt(pageSize)).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := loadTokenDecimals(mcs.db)
+	if err != nil {
+		return nil, err
 	}
+	formatEventLogs(events, decimals)
+
+	totalPages := (total + int64(StringToInt(pageSize)) - 1) / int64(StringToInt(pageSize))
 
-	middleware.Debug("💰 %s 用户余额更新: %s=%s (+%s)", chainName, address, newBalance, amount)
+	return &models.PaginatedData{
+		Items:      events,
+		Total:      total,
+		Page:       StringToInt(page),
+		PageSize:   StringToInt(pageSize),
+		TotalPages: totalPages,
+	}, nil
 }
 
-// recordTransferEventOnChain 记录链上转账事件
-func (mcs *MultiChainService) recordTransferEventOnChain(chainName, address, amount, changeType, txHash string, blockNumber uint64) {
-	history := models.UserBalanceHistory{
-		UserAddress: address,
-		OldBalance:  "",
-		NewBalance:  "",
-		ChangeAmount: amount,
-		ChangeType:  changeType,
-		TxHash:      txHash,
-		BlockNumber: blockNumber,
-		Timestamp:   time.Now(),
-	}
+// GetReorgReports 分页获取链重组报告
+func (mcs *MultiChainService) GetReorgReports(chainName, page, pageSize string) (*models.PaginatedData, error) {
+	var reports []models.ReorgReport
+	var total int64
 
-	if err := mcs.db.Create(&history).Error; err != nil {
-		middleware.Error("记录转账事件失败: %v", err)
+	query := mcs.db.Model(&models.ReorgReport{})
+	if chainName != "" {
+		query = query.Where("chain_name = ?", chainName)
 	}
-}
 
-// Stop 停止所有链监听
-func (mcs *MultiChainService) Stop() {
-	middleware.Info("🛑 停止多链监听服务...")
-	
-	close(mcs.stopChan)
-	mcs.wg.Wait()
-	
-	middleware.Info("✅ 多链监听服务已停止")
-}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
 
-// GetChainStatus 获取链状态
-func (mcs *MultiChainService) GetChainStatus() map[string]interface{} {
-	mcs.mu.RLock()
-	defer mcs.mu.RUnlock()
-	
-	status := make(map[string]interface{})
-	for name, chain := range mcs.chains {
-		status[name] = map[string]interface{}{
-			"name":         chain.Name,
-			"chain_id":     chain.ChainID,
-			"rpc_url":      chain.RPCURL,
-			"contract_addr": chain.ContractAddr.Hex(),
-			"enabled":      chain.Enabled,
-			"last_block":   chain.LastBlock,
-		}
+	offset := (StringToInt(page) - 1) * StringToInt(pageSize)
+	err := query.Order("detected_at desc").
+		Offset(offset).
+		Limit(StringToInt(pageSize)).
+		Find(&reports).Error
+	if err != nil {
+		return nil, err
 	}
-	
-	return status
-}
\ No newline at end of file
+
+	totalPages := (total + int64(StringToInt(pageSize)) - 1) / int64(StringToInt(pageSize))
+
+	return &models.PaginatedData{
+		Items:      reports,
+		Total:      total,
+		Page:       StringToInt(page),
+		PageSize:   StringToInt(pageSize),
+		TotalPages: totalPages,
+	}, nil
+}
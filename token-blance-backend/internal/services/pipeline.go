@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"token-balance/internal/middleware"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 同步流水线分为三个阶段：
+//   - 获取：查询一段区块的日志、首尾区块头和区块时间，当前区块段写库时在后台预取下一段
+//   - 解码：多个 goroutine 并行把日志解码为事件和余额变动，结果保持链上顺序
+//   - 写入：按区块把日志分批，每批在一个事务中写入并推进游标，批次之间严格按
+//     (区块, 日志索引) 顺序执行，同一地址的余额变动顺序与链上一致
+const (
+	// persistBatchLogs 每个写入事务最多包含的日志数，同一区块的日志不会拆到两个事务中
+	persistBatchLogs = 500
+	// parallelDecodeMinLogs 日志数达到该值时才并行解码
+	parallelDecodeMinLogs = 64
+	// prefetchTimeout 后台预取一段区块的超时时间
+	prefetchTimeout = 60 * time.Second
+)
+
+// fetchedRange 获取阶段的结果
+type fetchedRange struct {
+	FromBlock  uint64
+	ToBlock    uint64 // 实际查询到的最后一个区块 (范围超限时会缩小)
+	Requested  uint64 // 请求的区块数
+	UsedRange  uint64 // 最终使用的区块数
+	Logs       []types.Log
+	FromHeader *types.Header
+	ToHeader   *types.Header
+	BlockTimes map[uint64]time.Time
+}
+
+// prefetchedRange 正在后台获取的下一段区块
+type prefetchedRange struct {
+	fromBlock uint64
+	filterKey string // 代币地址列表，登记的代币变化后预取结果作废
+	done      chan struct{}
+	result    *fetchedRange
+	err       error
+}
+
+// logBatch 一个写入批次在日志列表中的范围 [Start, End)
+type logBatch struct {
+	Start int
+	End   int
+}
+
+// fetchRange 获取阶段：查询 [fromBlock, toBlock] 的日志、首尾区块头和日志所在区块的时间
+//
+// 日志查询失败时仍然返回 Requested/UsedRange，供调用方调整区块范围。
+func (s *chainSyncer) fetchRange(ctx context.Context, query ethereum.FilterQuery, fromBlock, toBlock uint64) (*fetchedRange, error) {
+	fetched := &fetchedRange{
+		FromBlock: fromBlock,
+		Requested: toBlock - fromBlock + 1,
+		UsedRange: toBlock - fromBlock + 1,
+	}
+
+	fromHeader, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(fromBlock))
+	if err != nil {
+		return fetched, fmt.Errorf("获取 %s 区块 %d 失败: %w", s.chainName, fromBlock, err)
+	}
+	fetched.FromHeader = fromHeader
+
+	// 范围或结果数超限时折半重试
+	logs, toBlock, usedRange, err := fetchLogs(ctx, s.client, query, fromBlock, toBlock)
+	fetched.UsedRange = usedRange
+	if err != nil {
+		return fetched, fmt.Errorf("查询 %s 事件日志失败: %w", s.chainName, err)
+	}
+	fetched.ToBlock = toBlock
+	fetched.Logs = logs
+
+	fetched.ToHeader = fromHeader
+	if toBlock != fromBlock {
+		fetched.ToHeader, err = s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(toBlock))
+		if err != nil {
+			return fetched, fmt.Errorf("获取 %s 区块 %d 失败: %w", s.chainName, toBlock, err)
+		}
+	}
+
+	// 每个区块只获取一次链上时间戳
+	fetched.BlockTimes, err = resolveBlockTimes(ctx, s.db, s.client, s.chainID, logs)
+	if err != nil {
+		return fetched, fmt.Errorf("获取 %s 区块时间失败: %w", s.chainName, err)
+	}
+	return fetched, nil
+}
+
+// startPrefetch 在后台获取下一段区块，当前区块段写库的同时进行
+func (s *chainSyncer) startPrefetch(query ethereum.FilterQuery, fromBlock, toBlock uint64) {
+	pending := &prefetchedRange{
+		fromBlock: fromBlock,
+		filterKey: filterKey(query),
+		done:      make(chan struct{}),
+	}
+	s.prefetched = pending
+
+	go func() {
+		defer close(pending.done)
+		// 调用方的 context 在本次同步结束后可能被取消，预取使用独立的超时
+		ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+		defer cancel()
+		pending.result, pending.err = s.fetchRange(ctx, query, fromBlock, toBlock)
+	}()
+}
+
+// takePrefetch 取出从 fromBlock 开始的预取结果
+//
+// 起始区块、代币列表不一致，结果超过安全高度或预取失败时丢弃，返回 nil 由调用方重新获取。
+func (s *chainSyncer) takePrefetch(ctx context.Context, query ethereum.FilterQuery, fromBlock, safeLatestBlock uint64) *fetchedRange {
+	pending := s.prefetched
+	s.prefetched = nil
+	if pending == nil || pending.fromBlock != fromBlock || pending.filterKey != filterKey(query) {
+		return nil
+	}
+
+	select {
+	case <-pending.done:
+	case <-ctx.Done():
+		return nil
+	}
+	if pending.err != nil {
+		middleware.Debug("%s 预取区块 %d 失败，重新获取: %v", s.chainName, fromBlock, pending.err)
+		return nil
+	}
+	if pending.result.ToBlock > safeLatestBlock {
+		return nil
+	}
+	return pending.result
+}
+
+// filterKey 日志查询的代币地址列表
+func filterKey(query ethereum.FilterQuery) string {
+	addresses := make([]string, 0, len(query.Addresses))
+	for _, address := range query.Addresses {
+		addresses = append(addresses, address.Hex())
+	}
+	return strings.Join(addresses, ",")
+}
+
+// decodeLogs 解码阶段：并行解码日志，结果与 logs 一一对应
+func decodeLogs(logs []types.Log, blockTimes map[uint64]time.Time, decode func(log *types.Log, blockTime time.Time) decodedLog) []decodedLog {
+	decoded := make([]decodedLog, len(logs))
+	workers := runtime.NumCPU()
+	if len(logs) < parallelDecodeMinLogs || workers < 2 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := worker; i < len(logs); i += workers {
+				decoded[i] = decode(&logs[i], blockTimes[logs[i].BlockNumber])
+			}
+		}(worker)
+	}
+	wg.Wait()
+	return decoded
+}
+
+// blockBatches 按区块把日志切分为写入批次
+//
+// 每批最多 persistBatchLogs 条日志，单个区块的日志超过上限时独占一批。
+// 没有日志时返回一个空批次，用于推进游标。
+func blockBatches(logs []types.Log) []logBatch {
+	if len(logs) == 0 {
+		return []logBatch{{}}
+	}
+
+	var batches []logBatch
+	start := 0
+	for i := 1; i <= len(logs); i++ {
+		blockEnd := i == len(logs) || logs[i].BlockNumber != logs[i-1].BlockNumber
+		if !blockEnd {
+			continue
+		}
+		// 当前批次再加入下一个区块就会超过上限时在区块边界切分
+		if i == len(logs) || i-start >= persistBatchLogs || nextBlockEnd(logs, i)-start > persistBatchLogs {
+			batches = append(batches, logBatch{Start: start, End: i})
+			start = i
+		}
+	}
+	return batches
+}
+
+// nextBlockEnd 从 start 开始的区块在日志列表中的结束位置
+func nextBlockEnd(logs []types.Log, start int) int {
+	end := start + 1
+	for end < len(logs) && logs[end].BlockNumber == logs[start].BlockNumber {
+		end++
+	}
+	return end
+}
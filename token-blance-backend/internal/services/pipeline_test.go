@@ -0,0 +1,53 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockLogs 按每个区块的日志数生成日志列表，区块号从1开始
+func blockLogs(counts ...int) []types.Log {
+	var logs []types.Log
+	for i, count := range counts {
+		for j := 0; j < count; j++ {
+			logs = append(logs, types.Log{BlockNumber: uint64(i + 1), Index: uint(j)})
+		}
+	}
+	return logs
+}
+
+func TestBlockBatches(t *testing.T) {
+	tests := []struct {
+		name string
+		logs []types.Log
+		want []logBatch
+	}{
+		{name: "no logs", want: []logBatch{{}}},
+		{name: "fits in one batch", logs: blockLogs(2, 3, 1), want: []logBatch{{Start: 0, End: 6}}},
+		{
+			name: "split at block boundary",
+			logs: blockLogs(300, 300),
+			want: []logBatch{{Start: 0, End: 300}, {Start: 300, End: 600}},
+		},
+		{
+			name: "exactly the limit",
+			logs: blockLogs(persistBatchLogs-1, 1, 1),
+			want: []logBatch{{Start: 0, End: persistBatchLogs}, {Start: persistBatchLogs, End: persistBatchLogs + 1}},
+		},
+		{
+			name: "oversized block gets its own batch",
+			logs: blockLogs(1, persistBatchLogs+10, 1),
+			want: []logBatch{{Start: 0, End: 1}, {Start: 1, End: persistBatchLogs + 11}, {Start: persistBatchLogs + 11, End: persistBatchLogs + 12}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockBatches(tt.logs); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("blockBatches = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 // - ✅ 每小时定时任务 (使用cron: "0 * * * *")
 // - ✅ 基于余额的积分计算 (5%费率)
 // - ✅ 积分记录持久化存储
+// - ✅ 余额按代币精度换算为代币数量后计算 (100 个 token 按 100 而不是 1e20 计算)
 // - ⚠️ 精确计算: 基于历史余额变化 (部分实现)
 // - ❌ 异常回溯: 程序错误/RPC问题导致几天未计算时的恢复机制 (待实现)
 //
@@ -61,29 +62,32 @@ func (ps *PointsService) StartPointsCalculation() {
 }
 
 // CalculateHourlyPoints 计算小时积分
+//
+// 积分按 (链, 代币, 用户) 分别计算和记录，用户总积分为各代币积分之和。
 func (ps *PointsService) CalculateHourlyPoints() {
 	middleware.Info("🏦 开始计算积分（基于已确认6个区块的余额数据）...")
 
-	// 获取所有用户
-	var users []models.User
-	err := ps.db.Find(&users).Error
+	// 获取所有持有过代币的 (链, 代币, 用户)
+	scopes, err := ps.balanceScopes(time.Time{}, time.Time{})
 	if err != nil {
 		middleware.Error("获取用户列表失败: %v", err)
 		return
 	}
 
-	// 为每个用户计算积分
-	for _, user := range users {
-		points := ps.calculateUserPoints(user.ID, user.Balance)
+	now := time.Now()
+	for _, scope := range scopes {
+		points := ps.calculateUserPoints(scope, now)
 		if points > 0 {
 			// 记录积分
 			record := models.PointsRecord{
-				UserAddress:   user.ID,
+				UserAddress:   scope.UserAddress,
+				ChainID:       scope.ChainID,
+				TokenAddress:  scope.TokenAddress,
 				Points:        points,
-				Balance:       user.Balance,
+				Balance:       ps.scopeBalance(scope, now),
 				Hours:         1,    // 每小时1小时
 				Rate:          0.05, // 5%费率
-				CalculateDate: time.Now(),
+				CalculateDate: now,
 			}
 
 			if err := ps.db.Create(&record).Error; err != nil {
@@ -92,8 +96,8 @@ func (ps *PointsService) CalculateHourlyPoints() {
 			}
 
 			// 更新用户总积分
-			newTotalPoints := user.TotalPoints + points
-			if err := ps.db.Model(&user).Update("total_points", newTotalPoints).Error; err != nil {
+			if err := ps.db.Model(&models.User{}).Where("id = ?", scope.UserAddress).
+				Update("total_points", gorm.Expr("total_points + ?", points)).Error; err != nil {
 				middleware.Error("更新用户总积分失败: %v", err)
 			}
 		}
@@ -102,8 +106,59 @@ func (ps *PointsService) CalculateHourlyPoints() {
 	middleware.Info("积分计算完成")
 }
 
-// calculateUserPoints 计算用户积分（基于历史余额变化）
-func (ps *PointsService) calculateUserPoints(address, balance string) float64 {
+// balanceScope 余额和积分的计算范围：一个用户在一条链上持有的一个代币
+type balanceScope struct {
+	ChainID      int64
+	TokenAddress string
+	UserAddress  string
+}
+
+// balanceScopes 余额历史中出现过的 (链, 代币, 用户)，startTime 不为零时只取该时间段内有变动的
+func (ps *PointsService) balanceScopes(startTime, endTime time.Time) ([]balanceScope, error) {
+	query := ps.db.Model(&models.UserBalanceHistory{}).
+		Select("DISTINCT chain_id, token_address, user_address")
+	if !startTime.IsZero() {
+		query = query.Where("timestamp BETWEEN ? AND ?", startTime, endTime)
+	}
+
+	var scopes []balanceScope
+	err := query.Scan(&scopes).Error
+	return scopes, err
+}
+
+// scopeDecimals 范围内代币的精度，未登记时为默认精度
+func (ps *PointsService) scopeDecimals(scope balanceScope) uint8 {
+	var token models.Token
+	err := ps.db.Select("decimals").
+		Where("chain_id = ? AND address = ?", scope.ChainID, scope.TokenAddress).
+		First(&token).Error
+	if err != nil {
+		return defaultTokenDecimals
+	}
+	return token.Decimals
+}
+
+// scopeQuery 限定余额历史查询的 (链, 代币, 用户)
+func (ps *PointsService) scopeQuery(scope balanceScope) *gorm.DB {
+	return ps.db.Where("chain_id = ? AND token_address = ? AND user_address = ?",
+		scope.ChainID, scope.TokenAddress, scope.UserAddress)
+}
+
+// scopeBalance 截至 at 时该范围内的余额 (最后一条余额历史)
+func (ps *PointsService) scopeBalance(scope balanceScope, at time.Time) string {
+	var history models.UserBalanceHistory
+	err := ps.scopeQuery(scope).
+		Where("timestamp <= ?", at).
+		Order("block_number desc, log_index desc, id desc").
+		First(&history).Error
+	if err != nil {
+		return "0"
+	}
+	return history.NewBalance
+}
+
+// calculateUserPoints 计算用户某个代币在最近一小时的积分（基于历史余额变化）
+func (ps *PointsService) calculateUserPoints(scope balanceScope, now time.Time) float64 {
 	// 📊 精确积分计算：基于用户余额历史变化
 	// 示例：
 	// - 15:00: 0个token
@@ -112,7 +167,7 @@ func (ps *PointsService) calculateUserPoints(address, balance string) float64 {
 	// - 16:00: 计算积分
 	// 积分 = 100*0.05*20/60 + 200*0.05*30/60
 
-	return ps.calculatePointsFromHistory(address, time.Now().Add(-time.Hour), time.Now())
+	return ps.calculatePointsFromHistory(scope, now.Add(-time.Hour), now)
 }
 
 // calculatePointsFromHistory 基于历史余额变化精确计算积分
@@ -135,16 +190,18 @@ func (ps *PointsService) calculateUserPoints(address, balance string) float64 {
 // 3. 15:15:20-15:30:45: 50 * 0.05 * 0.2583小时 = 0.6458  
 // 4. 15:30:45-16:00:00: 200 * 0.05 * 0.4858小时 = 4.8580
 // 总计: 5.8983积分
-func (ps *PointsService) calculatePointsFromHistory(address string, startTime, endTime time.Time) float64 {
-	middleware.Debug("🎯 开始精确积分计算: User=%s, %s → %s", 
-		address, startTime.Format("15:04:05"), endTime.Format("15:04:05"))
+func (ps *PointsService) calculatePointsFromHistory(scope balanceScope, startTime, endTime time.Time) float64 {
+	address := scope.UserAddress
+	// 余额历史是最小单位的整数，积分按代币精度换算后的数量计算
+	decimals := ps.scopeDecimals(scope)
+	middleware.Debug("🎯 开始精确积分计算: User=%s, Token=%s, %s → %s", 
+		address, scope.TokenAddress, startTime.Format("15:04:05"), endTime.Format("15:04:05"))
 
 	var history []models.UserBalanceHistory
 	
-	// 📈 获取指定时间段内的余额变化历史 (按时间戳排序)
-	err := ps.db.Where("user_address = ? AND timestamp BETWEEN ? AND ?", 
-		address, startTime, endTime).
-		Order("timestamp asc").
+	// 📈 获取该代币指定时间段内的余额变化历史 (按区块号和日志索引排序)
+	err := ps.scopeQuery(scope).Where("timestamp BETWEEN ? AND ?", startTime, endTime).
+		Order("block_number asc, log_index asc, id asc").
 		Find(&history).Error
 	
 	if err != nil {
@@ -154,7 +211,7 @@ func (ps *PointsService) calculatePointsFromHistory(address string, startTime, e
 
 	// 🔍 数据完整性检查
 	if len(history) > 0 {
-		// 检查是否有连续的时间记录
+		// 检查区块时间是否随区块号递增
 		for i := 1; i < len(history); i++ {
 			if history[i].Timestamp.Before(history[i-1].Timestamp) {
 				middleware.Error("❌ 余额历史时间顺序错误: %s", address)
@@ -171,27 +228,27 @@ func (ps *PointsService) calculatePointsFromHistory(address string, startTime, e
 	if len(history) == 0 {
 		// 查找开始时间之前最近的一条记录
 		var prevRecord models.UserBalanceHistory
-		err := ps.db.Where("user_address = ? AND timestamp < ?", address, startTime).
-			Order("timestamp desc").
+		err := ps.scopeQuery(scope).Where("timestamp < ?", startTime).
+			Order("block_number desc, log_index desc, id desc").
 			First(&prevRecord).Error
 		
 		if err == nil {
-			lastBalance = ps.parseFloat(prevRecord.NewBalance)
+			lastBalance = tokenAmount(prevRecord.NewBalance, decimals).InexactFloat64()
 			middleware.Debug("📅 使用历史余额作为起点: %.2f", lastBalance)
 		} else {
-			// 完全没有历史记录，使用当前余额简化计算
-			return ps.calculateSimplePoints(address, startTime, endTime)
+			// 开始时间之前没有余额变动，这段时间余额为0
+			return 0
 		}
 	} else {
 		// 使用第一条历史记录之前的余额
 		if history[0].Timestamp.After(startTime) {
 			var prevRecord models.UserBalanceHistory
-			err := ps.db.Where("user_address = ? AND timestamp < ?", address, history[0].Timestamp).
-				Order("timestamp desc").
+			err := ps.scopeQuery(scope).Where("timestamp < ?", history[0].Timestamp).
+				Order("block_number desc, log_index desc, id desc").
 				First(&prevRecord).Error
 			
 			if err == nil {
-				lastBalance = ps.parseFloat(prevRecord.NewBalance)
+				lastBalance = tokenAmount(prevRecord.NewBalance, decimals).InexactFloat64()
 			}
 		}
 	}
@@ -232,7 +289,7 @@ func (ps *PointsService) calculatePointsFromHistory(address string, startTime, e
 		}
 
 		// 更新余额和时间点
-		lastBalance = ps.parseFloat(record.NewBalance)
+		lastBalance = tokenAmount(record.NewBalance, decimals).InexactFloat64()
 		lastTime = record.Timestamp
 		
 		// 如果已经到达endTime，提前结束
@@ -271,42 +328,17 @@ func (ps *PointsService) calculatePointsFromHistory(address string, startTime, e
 	return totalPoints
 }
 
-// calculateSimplePoints 简化积分计算（当没有历史记录时的备用方案）
-func (ps *PointsService) calculateSimplePoints(address string, startTime, endTime time.Time) float64 {
-	// 获取用户当前余额
-	var user models.User
-	err := ps.db.Where("id = ?", address).First(&user).Error
-	if err != nil {
-		middleware.Error("获取用户信息失败: %v", err)
-		return 0
-	}
-
-	balance := ps.parseFloat(user.Balance)
-	if balance <= 0 {
-		return 0
-	}
-
-	durationHours := endTime.Sub(startTime).Hours()
-	points := balance * 0.05 * durationHours
-
-	middleware.Debug("使用简化积分计算: Address=%s, Balance=%.2f, Duration=%.2f小时, Points=%.4f", 
-		address, balance, durationHours, points)
-
-	return points
-}
-
 // GetPointsLeaderboard 获取积分排行榜
 func (ps *PointsService) GetPointsLeaderboard(limitStr string) ([]models.LeaderboardEntry, error) {
 	limit := StringToInt(limitStr)
 
 	var results []struct {
 		Address     string  `json:"address"`
-		Balance     string  `json:"balance"`
 		TotalPoints float64 `json:"total_points"`
 	}
 
 	err := ps.db.Table("users").
-		Select("id as address, balance, total_points").
+		Select("id as address, total_points").
 		Order("total_points desc").
 		Limit(limit).
 		Find(&results).Error
@@ -314,19 +346,58 @@ func (ps *PointsService) GetPointsLeaderboard(limitStr string) ([]models.Leaderb
 		return nil, err
 	}
 
+	addresses := make([]string, 0, len(results))
+	for _, result := range results {
+		addresses = append(addresses, result.Address)
+	}
+	holdings, err := ps.userHoldings(addresses)
+	if err != nil {
+		return nil, err
+	}
+
 	var leaderboard []models.LeaderboardEntry
 	for i, result := range results {
 		entry := models.LeaderboardEntry{
 			Rank:        i + 1,
 			Address:     result.Address,
-			Balance:     result.Balance,
 			TotalPoints: result.TotalPoints,
+			Holdings:    holdings[result.Address],
+		}
+		if entry.Holdings == nil {
+			entry.Holdings = []models.Holding{}
 		}
 		leaderboard = append(leaderboard, entry)
 	}
 
 	return leaderboard, nil
-} // CalculatePoints 手动计算积分（增强版异常回溯机制）
+}
+
+// userHoldings 用户各链各代币的持仓，按精度填写可读余额
+func (ps *PointsService) userHoldings(addresses []string) (map[string][]models.Holding, error) {
+	byUser := make(map[string][]models.Holding, len(addresses))
+	if len(addresses) == 0 {
+		return byUser, nil
+	}
+
+	var holdings []models.Holding
+	err := ps.db.Where("user_address IN ?", addresses).
+		Order("chain_id asc, token_address asc").
+		Find(&holdings).Error
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := loadTokenDecimals(ps.db)
+	if err != nil {
+		return nil, err
+	}
+	formatHoldings(holdings, decimals)
+	for _, holding := range holdings {
+		byUser[holding.UserAddress] = append(byUser[holding.UserAddress], holding)
+	}
+	return byUser, nil
+}
+
+// CalculatePoints 手动计算积分（增强版异常回溯机制）
 //
 // 异常回溯处理: 如果程序错误了，或者rpc有问题，导致好几天没有计算积分。此时应该如何正确回溯？
 //
@@ -447,40 +518,37 @@ func (ps *PointsService) validateDataIntegrity(startTime, endTime time.Time) err
 
 // calculateDayPoints 计算单日积分
 func (ps *PointsService) calculateDayPoints(dayStart, dayEnd time.Time) (int, float64, int, error) {
-	// 获取当天有余额变动的所有用户
-	var users []string
-	err := ps.db.Table("user_balance_history").
-		Select("DISTINCT user_address").
-		Where("timestamp BETWEEN ? AND ?", dayStart, dayEnd).
-		Pluck("user_address", &users).Error
-	
+	// 获取当天有余额变动的所有 (链, 代币, 用户)
+	scopes, err := ps.balanceScopes(dayStart, dayEnd)
 	if err != nil {
 		return 0, 0, 0, err
 	}
 
-	dayUsers := len(users)
+	users := make(map[string]bool)
 	dayPoints := 0.0
 	hoursInDay := int(dayEnd.Sub(dayStart).Hours())
 
-	// 为每个用户计算当天的积分
-	for _, userAddr := range users {
-		userPoints, err := ps.calculateUserPointsForDay(userAddr, dayStart, dayEnd)
+	// 为每个用户的每个代币计算当天的积分
+	for _, scope := range scopes {
+		users[scope.UserAddress] = true
+		userPoints, err := ps.calculateUserPointsForDay(scope, dayStart, dayEnd)
 		if err != nil {
-			middleware.Error("计算用户 %s 当天积分失败: %v", userAddr, err)
+			middleware.Error("计算用户 %s 代币 %s 当天积分失败: %v", scope.UserAddress, scope.TokenAddress, err)
 			continue
 		}
 		dayPoints += userPoints
 	}
 
-	return dayUsers, dayPoints, hoursInDay, nil
+	return len(users), dayPoints, hoursInDay, nil
 }
 
-// calculateUserPointsForDay 计算用户单日积分
-func (ps *PointsService) calculateUserPointsForDay(address string, dayStart, dayEnd time.Time) (float64, error) {
-	// 检查是否已经计算过这个用户的积分
+// calculateUserPointsForDay 计算用户某个代币的单日积分
+func (ps *PointsService) calculateUserPointsForDay(scope balanceScope, dayStart, dayEnd time.Time) (float64, error) {
+	// 检查是否已经计算过这个用户这个代币的积分
 	var existingCount int64
 	err := ps.db.Model(&models.PointsRecord{}).
-		Where("user_address = ? AND calculate_date BETWEEN ? AND ?", address, dayStart, dayEnd).
+		Where("chain_id = ? AND token_address = ? AND user_address = ? AND calculate_date BETWEEN ? AND ?",
+			scope.ChainID, scope.TokenAddress, scope.UserAddress, dayStart, dayEnd).
 		Count(&existingCount).Error
 	
 	if err != nil {
@@ -493,29 +561,16 @@ func (ps *PointsService) calculateUserPointsForDay(address string, dayStart, day
 	}
 
 	// 基于历史余额变化精确计算积分
-	points := ps.calculatePointsFromHistory(address, dayStart, dayEnd)
+	points := ps.calculatePointsFromHistory(scope, dayStart, dayEnd)
 	
 	if points > 0 {
-		// 获取用户的最终余额
-		var user models.User
-		err := ps.db.Where("id = ?", address).First(&user).Error
-		if err != nil {
-			// 使用历史记录中的最后余额
-			var history models.UserBalanceHistory
-			err := ps.db.Where("user_address = ? AND timestamp BETWEEN ? AND ?", 
-				address, dayStart, dayEnd).
-				Order("timestamp desc").
-				First(&history).Error
-			if err == nil {
-				user.Balance = history.NewBalance
-			}
-		}
-
-		// 创建积分记录
+		// 创建积分记录，余额为当天结束时该代币的余额
 		record := models.PointsRecord{
-			UserAddress:   address,
+			UserAddress:   scope.UserAddress,
+			ChainID:       scope.ChainID,
+			TokenAddress:  scope.TokenAddress,
 			Points:        points,
-			Balance:       user.Balance,
+			Balance:       ps.scopeBalance(scope, dayEnd),
 			Hours:         dayEnd.Sub(dayStart).Hours(),
 			Rate:          0.05,
 			CalculateDate: dayStart,
@@ -596,31 +651,6 @@ type LeaderboardEntry struct {
 	TotalPoints float64 `json:"total_points"`
 }
 
-// parseFloat 将字符串转换为float64，支持高精度计算
-func parseFloat(s string) float64 {
-	if s == "" {
-		return 0
-	}
-	result := 0.0
-	decimal := false
-	decimalPlace := 1.0
-	
-	for _, r := range s {
-		if r == '.' {
-			decimal = true
-		} else if r >= '0' && r <= '9' {
-			digit := float64(r - '0')
-			if decimal {
-				decimalPlace *= 10.0
-				result += digit / decimalPlace
-			} else {
-				result = result*10 + digit
-			}
-		}
-	}
-	return result
-}
-
 // calculatePrecisePoints 高精度积分计算，支持秒级精度
 func (ps *PointsService) calculatePrecisePoints(balance float64, duration time.Duration) float64 {
 	if balance <= 0 || duration <= 0 {
@@ -0,0 +1,622 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+	"token-balance/pkg/contracts"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// onchainMismatchIssue 链上 balanceOf 与索引余额不一致的一致性问题类型
+	onchainMismatchIssue = "onchain_balance_mismatch"
+	// reconciliationChangeType 按链上余额修正时写入的余额历史类型
+	reconciliationChangeType = "reconciliation"
+	// reconciliationLogIndex 修正记录的日志索引，排在同一区块所有真实日志之后
+	reconciliationLogIndex = math.MaxInt32
+)
+
+// ErrReconciliationRunning 上一轮核对尚未结束
+var ErrReconciliationRunning = errors.New("链上余额核对正在进行中")
+
+// errReconciliationStale 发现不一致之后持仓又有变动，需要重新核对
+var errReconciliationStale = errors.New("持仓在核对之后有变动，请重新核对")
+
+// ReconciliationService 链上余额核对服务
+//
+// 一致性检查只在数据库表之间互相比较，这里把索引结果与链上状态对比：以链的同步
+// 游标为固定区块 B，对已登记代币的持有人调用 balanceOf(holder) (区块 B)，与索引
+// 得到的 B 时刻余额比较。不一致时记录 onchain_balance_mismatch 一致性问题；开启修正
+// 时按链上余额修正持仓，并写入一条 reconciliation 余额历史，TxHash 指向对应的问题。
+type ReconciliationService struct {
+	db  *gorm.DB
+	cfg *config.Config
+
+	running       sync.Mutex // 同一时间只运行一轮核对
+	supplyRunning sync.Mutex // 同一时间只运行一轮供应量核对
+
+	mu           sync.RWMutex
+	offsets      map[string]uint                 // 抽样核对时每个代币上一轮核对到的持仓ID
+	reports      map[string]ReconciliationReport // 每条链最近一轮的核对结果
+	supplyChecks map[string]SupplyCheck          // 每个代币最近一次的供应量核对结果
+}
+
+// ReconcileOptions 手动核对的参数
+type ReconcileOptions struct {
+	Chain      string `json:"chain"`       // 链名称，为空时核对所有已启用的链
+	SampleSize *int   `json:"sample_size"` // 每个代币核对的持仓数，默认 RECONCILE_SAMPLE_SIZE，0 表示全部
+	Fix        *bool  `json:"fix"`         // 是否修正不一致，默认 RECONCILE_AUTO_FIX
+}
+
+// ReconciliationReport 一条链一轮核对的结果
+type ReconciliationReport struct {
+	ChainName   string                    `json:"chain_name"`
+	ChainID     int64                     `json:"chain_id"`
+	BlockNumber uint64                    `json:"block_number"` // 核对所在的区块 (同步游标)
+	Checked     int                       `json:"checked"`      // 核对的持仓数 (含下面的无持仓收款地址)
+	Recipients  int                       `json:"recipients"`   // raw_logs 中收到过转账但没有持仓记录、按0余额核对的地址数
+	Mismatches  int                       `json:"mismatches"`
+	Fixed       int                       `json:"fixed"`
+	Issues      []models.ConsistencyIssue `json:"issues"` // 本轮发现的不一致
+	Errors      []string                  `json:"errors,omitempty"`
+	StartedAt   time.Time                 `json:"started_at"`
+	FinishedAt  time.Time                 `json:"finished_at"`
+}
+
+// NewReconciliationService 创建链上余额核对服务
+func NewReconciliationService(db *gorm.DB, cfg *config.Config) *ReconciliationService {
+	return &ReconciliationService{
+		db:           db,
+		cfg:          cfg,
+		offsets:      make(map[string]uint),
+		reports:      make(map[string]ReconciliationReport),
+		supplyChecks: make(map[string]SupplyCheck),
+	}
+}
+
+// StartReconciliation 定时核对所有已启用的链
+//
+// 持有人余额按 RECONCILE_SCHEDULE 核对，totalSupply 与持有人余额之和按 RECONCILE_SUPPLY_SCHEDULE 核对。
+func (rs *ReconciliationService) StartReconciliation() {
+	if !rs.cfg.Reconcile.Enabled {
+		middleware.Info("链上余额核对未启用 (RECONCILE_ENABLED=false)")
+		return
+	}
+	middleware.Info("启动链上余额核对定时任务: 余额 %s, 供应量 %s", rs.cfg.Reconcile.Schedule, rs.cfg.Reconcile.SupplySchedule)
+
+	c := cron.New()
+	_, err := c.AddFunc(rs.cfg.Reconcile.Schedule, func() {
+		if _, err := rs.Reconcile(context.Background(), ReconcileOptions{}); err != nil {
+			middleware.Error("链上余额核对失败: %v", err)
+		}
+	})
+	if err != nil {
+		middleware.Error("创建链上余额核对定时任务失败: %v", err)
+		return
+	}
+	_, err = c.AddFunc(rs.cfg.Reconcile.SupplySchedule, func() {
+		if _, err := rs.CheckSupply(context.Background(), ""); err != nil {
+			middleware.Error("供应量核对失败: %v", err)
+		}
+	})
+	if err != nil {
+		middleware.Error("创建供应量核对定时任务失败: %v", err)
+		return
+	}
+
+	c.Start()
+}
+
+// Reconcile 执行一轮核对，返回每条链的结果
+func (rs *ReconciliationService) Reconcile(ctx context.Context, opts ReconcileOptions) ([]ReconciliationReport, error) {
+	if !rs.running.TryLock() {
+		return nil, ErrReconciliationRunning
+	}
+	defer rs.running.Unlock()
+
+	sampleSize := rs.cfg.Reconcile.SampleSize
+	if opts.SampleSize != nil {
+		sampleSize = *opts.SampleSize
+	}
+	fix := rs.cfg.Reconcile.AutoFix
+	if opts.Fix != nil {
+		fix = *opts.Fix
+	}
+
+	chains, names, err := rs.selectChains(opts.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]ReconciliationReport, 0, len(names))
+	for _, name := range names {
+		report := rs.reconcileChain(ctx, name, chains[name], sampleSize, fix)
+		reports = append(reports, report)
+
+		rs.mu.Lock()
+		rs.reports[name] = report
+		rs.mu.Unlock()
+	}
+	return reports, nil
+}
+
+// selectChains 要核对的链：chain 为空时为所有已启用的链，返回按名称排序的链名
+func (rs *ReconciliationService) selectChains(chain string) (map[string]config.ChainConfig, []string, error) {
+	chains, err := loadChainConfigs(rs.db, rs.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chain != "" {
+		if _, ok := chains[chain]; !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrChainNotFound, chain)
+		}
+	}
+
+	names := make([]string, 0, len(chains))
+	for name, definition := range chains {
+		if chain == name || (chain == "" && definition.Enabled) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return chains, names, nil
+}
+
+// LastReports 每条链最近一轮的核对结果
+func (rs *ReconciliationService) LastReports() []ReconciliationReport {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	reports := make([]ReconciliationReport, 0, len(rs.reports))
+	for _, report := range rs.reports {
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ChainName < reports[j].ChainName })
+	return reports
+}
+
+// ListIssues 链上核对发现的一致性问题 (持有人余额和供应量)
+//
+// issueType 为空时返回所有核对问题类型，status 为空时返回所有状态。
+func (rs *ReconciliationService) ListIssues(issueType, status string, limit int) ([]models.ConsistencyIssue, error) {
+	types := []string{onchainMismatchIssue, supplyMismatchIssue, supplyExceedsMaxIssue}
+	if issueType != "" {
+		types = []string{issueType}
+	}
+
+	query := rs.db.Where("type IN ?", types)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var issues []models.ConsistencyIssue
+	if err := query.Order("id desc").Limit(limit).Find(&issues).Error; err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+// FixIssue 按记录的链上余额修正一个尚未处理的不一致
+func (rs *ReconciliationService) FixIssue(id uint) (*models.ConsistencyIssue, error) {
+	var issue models.ConsistencyIssue
+	err := rs.db.Where("id = ? AND type = ?", id, onchainMismatchIssue).First(&issue).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("链上余额不一致问题 %d 不存在", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyReconciliation(rs.db, &issue); err != nil {
+		return nil, err
+	}
+	if err := rs.db.First(&issue, id).Error; err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// reconcileChain 在同步游标所在区块核对一条链上所有已启用代币的持仓
+func (rs *ReconciliationService) reconcileChain(ctx context.Context, name string, chain config.ChainConfig, sampleSize int, fix bool) ReconciliationReport {
+	report := ReconciliationReport{
+		ChainName: name,
+		ChainID:   chain.ChainID,
+		Issues:    []models.ConsistencyIssue{},
+		StartedAt: time.Now(),
+	}
+	rs.checkChain(ctx, name, chain, sampleSize, fix, &report)
+	report.FinishedAt = time.Now()
+
+	if report.Mismatches > 0 || len(report.Errors) > 0 {
+		middleware.Warn("⚠️ %s 链上余额核对 (区块 %d): 核对 %d 个持仓，不一致 %d 个，已修正 %d 个，错误 %d 个",
+			name, report.BlockNumber, report.Checked, report.Mismatches, report.Fixed, len(report.Errors))
+	} else {
+		middleware.Info("✅ %s 链上余额核对 (区块 %d): 核对 %d 个持仓，全部一致", name, report.BlockNumber, report.Checked)
+	}
+	return report
+}
+
+// checkTarget 一条链在固定区块上的核对对象
+type checkTarget struct {
+	BlockNumber uint64 // 同步游标：之前的日志都已入账，索引余额在该区块是完整的
+	BlockTime   time.Time
+	Tokens      []models.Token // 已启用的代币
+	Client      ChainBackend
+	TokenABI    abi.ABI
+}
+
+// openCheckTarget 读取链的同步游标和已启用的代币，并连接链的 RPC
+//
+// 没有已启用的代币时 Client 为 nil；Client 不为 nil 时由调用方关闭。
+func (rs *ReconciliationService) openCheckTarget(ctx context.Context, name string, chain config.ChainConfig) (*checkTarget, error) {
+	var cursor models.ChainSyncStatus
+	if err := rs.db.Where("chain_name = ?", name).First(&cursor).Error; err != nil {
+		return nil, fmt.Errorf("读取同步游标失败: %v", err)
+	}
+	if cursor.LastBlock == 0 {
+		return nil, errors.New("链尚未同步任何区块")
+	}
+	target := &checkTarget{BlockNumber: cursor.LastBlock}
+
+	if err := rs.db.Where("chain_name = ? AND enabled = ?", name, true).Order("id asc").Find(&target.Tokens).Error; err != nil {
+		return target, fmt.Errorf("读取代币列表失败: %v", err)
+	}
+	if len(target.Tokens) == 0 {
+		return target, nil
+	}
+
+	tokenABI, err := contracts.TokenBalanceABI()
+	if err != nil {
+		return target, err
+	}
+	target.TokenABI = tokenABI
+
+	client, err := DialRPCPool(name, chain.RPCURLs, chain.ChainID)
+	if err != nil {
+		return target, err
+	}
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(target.BlockNumber))
+	if err != nil {
+		client.Close()
+		return target, fmt.Errorf("获取区块 %d 失败: %v", target.BlockNumber, err)
+	}
+	target.BlockTime = time.Unix(int64(header.Time), 0)
+	target.Client = client
+	return target, nil
+}
+
+// checkChain 核对一条链，结果写入 report
+func (rs *ReconciliationService) checkChain(ctx context.Context, name string, chain config.ChainConfig, sampleSize int, fix bool, report *ReconciliationReport) {
+	target, err := rs.openCheckTarget(ctx, name, chain)
+	if target != nil {
+		report.BlockNumber = target.BlockNumber
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return
+	}
+	if target.Client == nil {
+		return
+	}
+	defer target.Client.Close()
+
+	for _, token := range target.Tokens {
+		holdings, err := rs.sampleHoldings(token, sampleSize)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("读取代币 %s 的持仓失败: %v", token.Address, err))
+			continue
+		}
+
+		// 抽样只覆盖已有持仓的地址；收到过转账却没有持仓记录的地址说明入账遗漏，每轮都核对
+		recipients, err := rs.recipientsWithoutHolding(token)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("读取代币 %s 的收款地址失败: %v", token.Address, err))
+		}
+		report.Recipients += len(recipients)
+		holdings = append(holdings, recipients...)
+
+		for _, holding := range holdings {
+			if ctx.Err() != nil {
+				report.Errors = append(report.Errors, ctx.Err().Error())
+				return
+			}
+			report.Checked++
+
+			issue, err := rs.checkHolding(ctx, target.Client, target.TokenABI, name, holding, target.BlockNumber, target.BlockTime)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("核对 %s 的 %s 余额失败: %v", holding.UserAddress, holding.TokenAddress, err))
+				continue
+			}
+			if issue == nil {
+				continue
+			}
+
+			report.Mismatches++
+			if fix {
+				if err := applyReconciliation(rs.db, issue); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("修正问题 %d 失败: %v", issue.ID, err))
+				} else {
+					report.Fixed++
+					if err := rs.db.First(issue, issue.ID).Error; err != nil {
+						report.Errors = append(report.Errors, fmt.Sprintf("读取已修正的问题 %d 失败: %v", issue.ID, err))
+					}
+				}
+			}
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+}
+
+// sampleHoldings 本轮要核对的持仓
+//
+// sampleSize 为0时返回代币的所有持仓；否则从上一轮结束的位置按ID继续取 sampleSize 个，
+// 到末尾后从头开始，多轮之后覆盖所有持有人。
+func (rs *ReconciliationService) sampleHoldings(token models.Token, sampleSize int) ([]models.Holding, error) {
+	scope := rs.db.Where("chain_id = ? AND token_address = ?", token.ChainID, common.HexToAddress(token.Address).Hex())
+
+	var holdings []models.Holding
+	if sampleSize <= 0 {
+		err := scope.Session(&gorm.Session{}).Order("id asc").Find(&holdings).Error
+		return holdings, err
+	}
+
+	key := tokenKey(token.ChainID, token.Address)
+	rs.mu.RLock()
+	after := rs.offsets[key]
+	rs.mu.RUnlock()
+
+	if err := scope.Session(&gorm.Session{}).Where("id > ?", after).Order("id asc").Limit(sampleSize).Find(&holdings).Error; err != nil {
+		return nil, err
+	}
+	if len(holdings) < sampleSize && after > 0 {
+		var wrapped []models.Holding
+		if err := scope.Session(&gorm.Session{}).Where("id <= ?", after).Order("id asc").Limit(sampleSize - len(holdings)).Find(&wrapped).Error; err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, wrapped...)
+	}
+
+	if len(holdings) > 0 {
+		rs.mu.Lock()
+		rs.offsets[key] = holdings[len(holdings)-1].ID
+		rs.mu.Unlock()
+	}
+	return holdings, nil
+}
+
+// recipientsWithoutHolding raw_logs 中收到过该代币转账、但没有持仓记录的地址，作为0余额持仓返回
+func (rs *ReconciliationService) recipientsWithoutHolding(token models.Token) ([]models.Holding, error) {
+	tokenAddress := common.HexToAddress(token.Address).Hex()
+	var addresses []string
+	err := rs.db.Model(&models.RawLog{}).
+		Distinct("to_address").
+		Where("chain_id = ? AND address = ? AND to_address <> '' AND to_address <> ? AND removed = ?",
+			token.ChainID, tokenAddress, common.Address{}.Hex(), false).
+		Where("to_address NOT IN (?)", rs.db.Model(&models.Holding{}).Select("user_address").
+			Where("chain_id = ? AND token_address = ?", token.ChainID, tokenAddress)).
+		Order("to_address asc").
+		Pluck("to_address", &addresses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	holdings := make([]models.Holding, 0, len(addresses))
+	for _, address := range addresses {
+		holdings = append(holdings, models.Holding{
+			ChainID:      token.ChainID,
+			TokenAddress: tokenAddress,
+			UserAddress:  address,
+			Balance:      "0",
+		})
+	}
+	return holdings, nil
+}
+
+// checkHolding 对比一个持仓在区块 blockNumber 的索引余额和链上余额
+//
+// 不一致时记录 (或更新) 一致性问题并返回；一致时关闭该持仓之前未处理的问题，返回 nil。
+func (rs *ReconciliationService) checkHolding(ctx context.Context, client ChainBackend, tokenABI abi.ABI, chainName string, holding models.Holding, blockNumber uint64, blockTime time.Time) (*models.ConsistencyIssue, error) {
+	// 持仓在核对区块之后又有变动时，从余额历史取该区块的余额
+	var indexed *big.Int
+	if holding.BlockNumber <= blockNumber {
+		balance, ok := new(big.Int).SetString(holding.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("无效的持仓余额: %s", holding.Balance)
+		}
+		indexed = balance
+	} else {
+		balance, err := historyBalanceAt(rs.db, holding.ChainID, holding.TokenAddress, holding.UserAddress, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		indexed = balance
+	}
+
+	onchain, err := callTokenUintAt(ctx, client, tokenABI, common.HexToAddress(holding.TokenAddress), blockNumber, "balanceOf", common.HexToAddress(holding.UserAddress))
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := findOpenIssue(rs.db, onchainMismatchIssue, holding.UserAddress, holding.ChainID, holding.TokenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if onchain.Cmp(indexed) == 0 {
+		if existing != nil {
+			now := time.Now()
+			if err := rs.db.Model(existing).Updates(map[string]interface{}{"status": "fixed", "resolved_at": now}).Error; err != nil {
+				return nil, fmt.Errorf("关闭问题 %d 失败: %v", existing.ID, err)
+			}
+			middleware.Info("✅ 问题 %d 已一致: %s 在区块 %d 的 %s 余额为 %s",
+				existing.ID, holding.UserAddress, blockNumber, holding.TokenAddress, onchain.String())
+		}
+		return nil, nil
+	}
+
+	issue := existing
+	if issue == nil {
+		issue = &models.ConsistencyIssue{
+			Type:        onchainMismatchIssue,
+			Severity:    "high",
+			UserAddress: holding.UserAddress,
+			Status:      "open",
+		}
+	}
+	issue.Description = fmt.Sprintf("用户 %s 在链 %s 代币 %s 区块 %d 的余额与链上不符: 索引=%s, 链上=%s",
+		holding.UserAddress, chainName, holding.TokenAddress, blockNumber, indexed.String(), onchain.String())
+	issue.Data = map[string]interface{}{
+		"chain_id":        holding.ChainID,
+		"chain_name":      chainName,
+		"token":           holding.TokenAddress,
+		"block_number":    blockNumber,
+		"block_time":      blockTime.Unix(),
+		"indexed_balance": indexed.String(),
+		"chain_balance":   onchain.String(),
+		"difference":      new(big.Int).Sub(onchain, indexed).String(),
+	}
+	if err := rs.db.Save(issue).Error; err != nil {
+		return nil, fmt.Errorf("记录链上余额不一致失败: %v", err)
+	}
+
+	middleware.Warn("⚠️ %s", issue.Description)
+	return issue, nil
+}
+
+// findOpenIssue 指定 (链, 代币, 地址) 尚未处理的一致性问题，没有时返回 nil
+func findOpenIssue(db *gorm.DB, issueType, userAddress string, chainID int64, token string) (*models.ConsistencyIssue, error) {
+	var issues []models.ConsistencyIssue
+	err := db.Where("type = ? AND user_address = ? AND status = ?", issueType, userAddress, "open").
+		Order("id asc").
+		Find(&issues).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range issues {
+		issueChainID, _ := issueInt(issues[i].Data["chain_id"])
+		if issueChainID == chainID && issues[i].Data["token"] == token {
+			return &issues[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// callTokenUintAt 调用代币合约返回 uint256 的只读方法，读取指定区块的状态
+func callTokenUintAt(ctx context.Context, client ChainBackend, tokenABI abi.ABI, token common.Address, blockNumber uint64, method string, args ...interface{}) (*big.Int, error) {
+	data, err := callTokenRaw(ctx, client, tokenABI, token, new(big.Int).SetUint64(blockNumber), method, args...)
+	if err != nil {
+		return nil, err
+	}
+	values, err := tokenABI.Unpack(method, data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s() 返回值失败: %v", method, err)
+	}
+	value, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("%s() 返回值无效: %v", method, values[0])
+	}
+	return value, nil
+}
+
+// applyReconciliation 按一致性问题中记录的链上余额修正持仓
+//
+// 修正量为 链上余额 - 索引余额，并写入一条 reconciliation 余额历史：区块为核对所在区块，
+// 日志索引排在该区块所有日志之后，TxHash 为 "reconciliation-<问题ID>"。持仓在核对之后有变动或问题已经处理过时不修正。
+func applyReconciliation(db *gorm.DB, issue *models.ConsistencyIssue) error {
+	chainID, ok1 := issueInt(issue.Data["chain_id"])
+	blockNumber, ok2 := issueInt(issue.Data["block_number"])
+	blockTime, ok3 := issueInt(issue.Data["block_time"])
+	token, ok4 := issue.Data["token"].(string)
+	indexedValue, ok5 := issue.Data["indexed_balance"].(string)
+	chainValue, ok6 := issue.Data["chain_balance"].(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+		return fmt.Errorf("问题 %d 缺少核对数据", issue.ID)
+	}
+	indexed, ok1 := new(big.Int).SetString(indexedValue, 10)
+	onchain, ok2 := new(big.Int).SetString(chainValue, 10)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("问题 %d 的余额无效", issue.ID)
+	}
+
+	address := common.HexToAddress(issue.UserAddress)
+	// 修正视为一条只有接收方的余额变动，与日志入账共用加锁和记账逻辑
+	adjustment := &transferEvent{
+		ChainID:     chainID,
+		Token:       common.HexToAddress(token),
+		TxHash:      fmt.Sprintf("reconciliation-%d", issue.ID),
+		LogIndex:    reconciliationLogIndex,
+		BlockNumber: uint64(blockNumber),
+		To:          address,
+		Amount:      new(big.Int),
+		Timestamp:   time.Unix(blockTime, 0),
+	}
+	scope := balanceScope{ChainID: chainID, TokenAddress: adjustment.Token.Hex(), UserAddress: address.Hex()}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current models.ConsistencyIssue
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, issue.ID).Error; err != nil {
+			return err
+		}
+		if current.Status != "open" {
+			return fmt.Errorf("问题 %d 的状态为 %s，无需修正", issue.ID, current.Status)
+		}
+
+		ledger, err := lockBalanceLedger(tx, []decodedLog{{Transfer: adjustment}})
+		if err != nil {
+			return err
+		}
+		holding := ledger.holdings[scope]
+		if holding.BlockNumber > adjustment.BlockNumber || holding.Balance.Cmp(indexed) != 0 {
+			return errReconciliationStale
+		}
+
+		history := ledger.applyBalanceChange(adjustment, address, new(big.Int).Sub(onchain, indexed), reconciliationChangeType)
+		if err := tx.Create(&history).Error; err != nil {
+			return fmt.Errorf("写入修正记录失败: %v", err)
+		}
+		if err := ledger.flush(tx); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&current).Updates(map[string]interface{}{"status": "fixed", "resolved_at": now}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	middleware.Info("🩹 已按链上余额修正: %s 代币 %s (链 %d, 区块 %d) %s -> %s，问题 %d",
+		scope.UserAddress, scope.TokenAddress, chainID, blockNumber, indexed.String(), onchain.String(), issue.ID)
+	return nil
+}
+
+// issueInt 读取一致性问题数据中的整数，从数据库读出的 JSON 数字为 float64
+func issueInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRecipientsWithoutHolding(t *testing.T) {
+	db := openTestDB(t)
+	token := common.HexToAddress("0x00000000000000000000000000000000000000aa").Hex()
+	held := common.HexToAddress("0x0000000000000000000000000000000000000001").Hex()
+	missing := common.HexToAddress("0x0000000000000000000000000000000000000002").Hex()
+	removed := common.HexToAddress("0x0000000000000000000000000000000000000003").Hex()
+	otherToken := common.HexToAddress("0x00000000000000000000000000000000000000bb").Hex()
+
+	if err := db.Create(&models.User{ID: held}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Holding{ChainID: 1, TokenAddress: token, UserAddress: held, Balance: "5"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	logs := []models.RawLog{
+		{ChainID: 1, Address: token, ToAddress: held, LogIndex: 0},
+		{ChainID: 1, Address: token, ToAddress: missing, LogIndex: 1},
+		{ChainID: 1, Address: token, ToAddress: missing, LogIndex: 2},
+		{ChainID: 1, Address: token, ToAddress: common.Address{}.Hex(), LogIndex: 3},
+		{ChainID: 1, Address: token, ToAddress: removed, LogIndex: 4, Removed: true},
+		{ChainID: 1, Address: otherToken, ToAddress: missing, LogIndex: 5},
+		{ChainID: 2, Address: token, ToAddress: removed, LogIndex: 6},
+	}
+	for i := range logs {
+		logs[i].TxHash = common.BigToHash(common.Big1).Hex()
+		logs[i].BlockHash = logs[i].TxHash
+		logs[i].BlockNumber = 10
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rs := NewReconciliationService(db, nil)
+	recipients, err := rs.recipientsWithoutHolding(models.Token{ChainID: 1, Address: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 1 {
+		t.Fatalf("recipients = %+v, want only %s", recipients, missing)
+	}
+	got := recipients[0]
+	if got.UserAddress != missing || got.Balance != "0" || got.ChainID != 1 || got.TokenAddress != token {
+		t.Fatalf("recipient = %+v", got)
+	}
+}
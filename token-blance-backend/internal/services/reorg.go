@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxReorgSearchBlocks 查找共同祖先时最多回溯的已记录区块数
+const maxReorgSearchBlocks = 1000
+
+// reorgCheck 链重组检测的结果
+type reorgCheck int
+
+const (
+	reorgNone       reorgCheck = iota // 父哈希一致
+	reorgRolledBack                   // 已回滚到共同祖先，游标已回退
+	reorgPending                      // 游标区块仍在规范链上但父哈希不一致，链头正在切换
+)
+
+// checkChainReorg 比对父哈希检测链重组
+//
+// fromHeader 是本次待处理范围的第一个区块，它的父哈希应当等于游标区块的已记录哈希。
+// 不一致说明已处理的区块被替换（重组深度超过了确认窗口），此时回滚到共同祖先，
+// 记录重组报告并返回 reorgRolledBack；下一次同步会从共同祖先之后重新同步规范链。
+func checkChainReorg(ctx context.Context, db *gorm.DB, client ChainBackend, chainName string, chainID int64, cursor *models.ChainSyncStatus, fromHeader *types.Header) (reorgCheck, error) {
+	if cursor.LastBlock == 0 {
+		return reorgNone, nil
+	}
+
+	var cursorBlock models.ChainBlock
+	err := db.Where("chain_id = ? AND block_number = ?", chainID, cursor.LastBlock).First(&cursorBlock).Error
+	if err == gorm.ErrRecordNotFound {
+		// 升级前处理的区块没有哈希记录，无法比对
+		return reorgNone, nil
+	}
+	if err != nil {
+		return reorgNone, fmt.Errorf("查询游标区块哈希失败: %v", err)
+	}
+
+	if fromHeader.ParentHash.Hex() == cursorBlock.BlockHash {
+		return reorgNone, nil
+	}
+
+	middleware.Warn("⚠️ %s 检测到链重组: 区块 %d 已记录哈希 %s, 新链父哈希 %s",
+		chainName, cursor.LastBlock, cursorBlock.BlockHash, fromHeader.ParentHash.Hex())
+
+	ancestor, replaced, err := findCommonAncestor(ctx, db, client, chainID, cursor.LastBlock)
+	if err != nil {
+		return reorgNone, err
+	}
+	if ancestor == cursor.LastBlock {
+		// 游标区块仍在规范链上，说明链头正在切换，下次轮询再处理
+		middleware.Debug("⏳ %s 区块 %d 的父哈希暂不一致，等待链头稳定", chainName, fromHeader.Number.Uint64())
+		return reorgPending, nil
+	}
+
+	report, err := rollbackToAncestor(db, chainName, chainID, cursor.LastBlock, ancestor, replaced,
+		cursorBlock.BlockHash, fromHeader.ParentHash.Hex())
+	if err != nil {
+		return reorgNone, err
+	}
+
+	middleware.Warn("🔁 %s 链重组回滚完成: 共同祖先=%d, 深度=%d, 替换区块=%d, 删除事件=%d, 影响用户=%d",
+		chainName, report.CommonAncestor, report.Depth, len(report.BlocksReplaced),
+		report.EventsRemoved, len(report.UsersAffected))
+	return reorgRolledBack, nil
+}
+
+// findCommonAncestor 从游标往回查找哈希仍与规范链一致的最高已记录区块
+//
+// 已记录区块只要有一个与规范链一致，它之前的所有区块也必然一致（哈希链），
+// 因此只需要比对 chain_blocks 中的记录。返回共同祖先和被替换的已记录区块。
+func findCommonAncestor(ctx context.Context, db *gorm.DB, client ChainBackend, chainID int64, lastBlock uint64) (uint64, []uint64, error) {
+	var blocks []models.ChainBlock
+	err := db.Where("chain_id = ? AND block_number <= ?", chainID, lastBlock).
+		Order("block_number desc").
+		Limit(maxReorgSearchBlocks).
+		Find(&blocks).Error
+	if err != nil {
+		return 0, nil, fmt.Errorf("查询已记录区块失败: %v", err)
+	}
+
+	var replaced []uint64
+	for _, block := range blocks {
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(block.BlockNumber))
+		if err != nil {
+			return 0, nil, fmt.Errorf("获取区块 %d 失败: %w", block.BlockNumber, err)
+		}
+		if header.Hash().Hex() == block.BlockHash {
+			return block.BlockNumber, replaced, nil
+		}
+		replaced = append(replaced, block.BlockNumber)
+	}
+
+	return 0, nil, fmt.Errorf("在最近 %d 个已记录区块中未找到共同祖先", len(blocks))
+}
+
+// rollbackToAncestor 回滚共同祖先之后的所有派生数据
+//
+// 在一个事务中回滚共同祖先之后的事件、余额、积分和每日汇总（见 revertChainData），
+// 回退同步游标并写入重组报告。
+// 余额按变化量回滚而不是直接恢复旧值，避免覆盖其他链对同一地址的更新。
+func rollbackToAncestor(db *gorm.DB, chainName string, chainID int64, lastBlock, ancestor uint64, replaced []uint64, oldHeadHash, newHeadHash string) (*models.ReorgReport, error) {
+	report := &models.ReorgReport{
+		ChainName:      chainName,
+		ChainID:        chainID,
+		CommonAncestor: ancestor,
+		Depth:          lastBlock - ancestor,
+		OldHeadHash:    oldHeadHash,
+		NewHeadHash:    newHeadHash,
+		BlocksReplaced: replaced,
+		DetectedAt:     time.Now(),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSyncCursor(tx, chainName); err != nil {
+			return err
+		}
+		reverted, err := revertChainData(tx, chainID, ancestor)
+		if err != nil {
+			return err
+		}
+		report.EventsRemoved = reverted.Events
+		report.UsersAffected = reverted.Users
+		report.PointsRemoved = reverted.PointsRemoved
+		report.SummariesRemoved = reverted.SummariesRemoved
+
+		if err := rewindSyncCursor(tx, chainName, lastBlock, ancestor); err != nil {
+			return err
+		}
+
+		return tx.Create(report).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("回滚到区块 %d 失败: %v", ancestor, err)
+	}
+
+	return report, nil
+}
+
+// revertedChainData revertChainData 删除和失效的数据
+type revertedChainData struct {
+	Events           int64    // 删除的事件数
+	Users            []string // 余额被回滚的用户
+	PointsRemoved    int64    // 失效的积分记录数
+	SummariesRemoved int64    // 失效的每日汇总数
+}
+
+// revertChainData 删除某条链在 ancestor 之后的派生数据，并恢复受影响的持仓
+//
+// 删除 ancestor 之后的 event_logs、user_balance_history、chain_blocks 和 dead_letter_logs，
+// raw_logs 保留并标记为 removed，受影响的持仓恢复为剩余历史中的最新余额。
+// 按被删除余额历史计算的积分和每日汇总一并失效 (见 invalidateDerivedPoints)。
+func revertChainData(tx *gorm.DB, chainID int64, ancestor uint64) (*revertedChainData, error) {
+	var histories []models.UserBalanceHistory
+	err := tx.Where("chain_id = ? AND block_number > ?", chainID, ancestor).
+		Order("block_number desc, id desc").
+		Find(&histories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 汇总受影响的用户和需要恢复的持仓
+	users := []string{}
+	seenUsers := make(map[string]bool)
+	scopes := []balanceScope{}
+	since := make(map[balanceScope]time.Time)
+	for _, history := range histories {
+		scope := balanceScope{ChainID: history.ChainID, TokenAddress: history.TokenAddress, UserAddress: history.UserAddress}
+		if first, seen := since[scope]; !seen {
+			scopes = append(scopes, scope)
+			since[scope] = history.Timestamp
+		} else if history.Timestamp.Before(first) {
+			since[scope] = history.Timestamp
+		}
+		if !seenUsers[history.UserAddress] {
+			seenUsers[history.UserAddress] = true
+			users = append(users, history.UserAddress)
+		}
+	}
+
+	if err := tx.Where("chain_id = ? AND block_number > ?", chainID, ancestor).
+		Delete(&models.UserBalanceHistory{}).Error; err != nil {
+		return nil, err
+	}
+
+	for _, scope := range scopes {
+		if err := restoreHolding(tx, scope); err != nil {
+			return nil, err
+		}
+	}
+
+	reverted := &revertedChainData{Users: users}
+	reverted.PointsRemoved, reverted.SummariesRemoved, err = invalidateDerivedPoints(tx, scopes, since)
+	if err != nil {
+		return nil, err
+	}
+
+	result := tx.Where("chain_id = ? AND block_number > ?", chainID, ancestor).Delete(&models.EventLog{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := tx.Where("chain_id = ? AND block_number > ?", chainID, ancestor).
+		Delete(&models.ChainBlock{}).Error; err != nil {
+		return nil, err
+	}
+
+	// 原始日志保留归档，只标记为已移出规范链
+	if err := tx.Model(&models.RawLog{}).
+		Where("chain_id = ? AND block_number > ? AND removed = ?", chainID, ancestor, false).
+		Update("removed", true).Error; err != nil {
+		return nil, err
+	}
+
+	// 被替换区块中的日志已不在规范链上，对应的死信一并删除
+	if err := tx.Where("chain_id = ? AND block_number > ?", chainID, ancestor).
+		Delete(&models.DeadLetter{}).Error; err != nil {
+		return nil, err
+	}
+
+	reverted.Events = result.RowsAffected
+	return reverted, nil
+}
+
+// invalidateDerivedPoints 删除按被回滚的余额历史计算出的积分记录和每日汇总，并重新汇总用户总积分
+//
+// since 为每个 (链, 代币, 用户) 被删除的最早一条余额历史的时间，计算区间结束于它之后的积分记录
+// 和它所在日期及之后的每日汇总都不再可信。每日汇总可在链重新同步后通过回放重建；
+// 失效区间的积分不会自动补算，之后的每小时计算从重新同步后的余额历史继续累计。
+func invalidateDerivedPoints(tx *gorm.DB, scopes []balanceScope, since map[balanceScope]time.Time) (int64, int64, error) {
+	var pointsRemoved, summariesRemoved int64
+	userSince := make(map[string]time.Time)
+	for _, scope := range scopes {
+		from := since[scope]
+		if first, ok := userSince[scope.UserAddress]; !ok || from.Before(first) {
+			userSince[scope.UserAddress] = from
+		}
+
+		// 积分记录的区间长度为 hours，按日计算的记录最长 25 小时 (夏令时)
+		var records []models.PointsRecord
+		err := tx.Select("id, calculate_date, hours").
+			Where("chain_id = ? AND token_address = ? AND user_address = ? AND calculate_date > ?",
+				scope.ChainID, scope.TokenAddress, scope.UserAddress, from.Add(-25*time.Hour)).
+			Find(&records).Error
+		if err != nil {
+			return 0, 0, err
+		}
+		ids := []uint{}
+		for _, record := range records {
+			if record.CalculateDate.Add(time.Duration(record.Hours * float64(time.Hour))).After(from) {
+				ids = append(ids, record.ID)
+			}
+		}
+		if len(ids) > 0 {
+			result := tx.Where("id IN ?", ids).Delete(&models.PointsRecord{})
+			if result.Error != nil {
+				return 0, 0, result.Error
+			}
+			pointsRemoved += result.RowsAffected
+		}
+	}
+
+	for address, from := range userSince {
+		result := tx.Where("user_address = ? AND summary_date >= ?", address, startOfDay(from).Format("2006-01-02")).
+			Delete(&models.UserDailySummary{})
+		if result.Error != nil {
+			return 0, 0, result.Error
+		}
+		summariesRemoved += result.RowsAffected
+
+		var totalPoints float64
+		err := tx.Model(&models.PointsRecord{}).Where("user_address = ?", address).
+			Select("COALESCE(SUM(points), 0)").Row().Scan(&totalPoints)
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", address).Update("total_points", totalPoints).Error; err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if pointsRemoved > 0 || summariesRemoved > 0 {
+		middleware.Warn("🧹 回滚的余额历史涉及 %d 个用户，已删除 %d 条积分记录和 %d 条每日汇总",
+			len(userSince), pointsRemoved, summariesRemoved)
+	}
+	return pointsRemoved, summariesRemoved, nil
+}
+
+// recordChainBlocks 记录本次处理范围内的区块哈希
+//
+// head 为范围的最后一个区块（即新的游标），同时记录父哈希；按区块分批提交时中间批次传入 nil，
+// 游标所在区块的哈希从日志中取得。包含事件的区块从日志中取得区块哈希，并缓存 blockTimes 中的链上时间戳。
+func recordChainBlocks(tx *gorm.DB, chainID int64, head *types.Header, logs []types.Log, blockTimes map[uint64]time.Time) error {
+	blocks := []models.ChainBlock{}
+	seen := map[uint64]bool{}
+	if head != nil {
+		headTime := headerTime(head)
+		blocks = append(blocks, models.ChainBlock{
+			ChainID:     chainID,
+			BlockNumber: head.Number.Uint64(),
+			BlockHash:   head.Hash().Hex(),
+			ParentHash:  head.ParentHash.Hex(),
+			BlockTime:   &headTime,
+		})
+		seen[head.Number.Uint64()] = true
+	}
+
+	for _, log := range logs {
+		if seen[log.BlockNumber] {
+			continue
+		}
+		seen[log.BlockNumber] = true
+		block := models.ChainBlock{
+			ChainID:     chainID,
+			BlockNumber: log.BlockNumber,
+			BlockHash:   log.BlockHash.Hex(),
+		}
+		if blockTime, ok := blockTimes[log.BlockNumber]; ok {
+			block.BlockTime = &blockTime
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	// 已存在的区块只补写缺失的时间戳
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain_id"}, {Name: "block_number"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"block_time": gorm.Expr("COALESCE(block_time, VALUES(block_time))"),
+		}),
+	}).Create(&blocks).Error
+}
+
+// restoreHolding 把持仓恢复为余额历史中的最新余额，没有剩余历史时删除持仓
+func restoreHolding(tx *gorm.DB, scope balanceScope) error {
+	balance, blockNumber, err := historyBalance(tx, scope.ChainID, scope.TokenAddress, scope.UserAddress)
+	if err != nil {
+		return err
+	}
+
+	holdings := tx.Where("chain_id = ? AND token_address = ? AND user_address = ?",
+		scope.ChainID, scope.TokenAddress, scope.UserAddress)
+	if blockNumber == 0 && balance.Sign() == 0 {
+		return holdings.Delete(&models.Holding{}).Error
+	}
+	return holdings.Model(&models.Holding{}).Updates(map[string]interface{}{
+		"balance":      balance.String(),
+		"block_number": blockNumber,
+	}).Error
+}
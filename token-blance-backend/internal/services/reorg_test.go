@@ -0,0 +1,134 @@
+package services
+
+import (
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+func TestRevertChainData(t *testing.T) {
+	db := openTestDB(t)
+	token := common.HexToAddress("0x00000000000000000000000000000000000000aa").Hex()
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001").Hex()
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002").Hex()
+	day1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	history := func(chainID int64, user string, block uint64, changeType, oldBalance, newBalance string, at time.Time) models.UserBalanceHistory {
+		return models.UserBalanceHistory{
+			ChainID: chainID, TokenAddress: token, UserAddress: user, BlockNumber: block, Timestamp: at,
+			TxHash: common.BigToHash(new(big.Int).SetUint64(block)).Hex(), ChangeType: changeType,
+			OldBalance: oldBalance, NewBalance: newBalance, ChangeAmount: "0",
+		}
+	}
+	rawLog := func(chainID int64, block uint64) models.RawLog {
+		hash := common.BigToHash(new(big.Int).SetUint64(block)).Hex()
+		return models.RawLog{ChainID: chainID, Address: token, BlockNumber: block, TxHash: hash, BlockHash: hash}
+	}
+	rows := []interface{}{
+		&[]models.User{{ID: alice}, {ID: bob}},
+		&[]models.UserBalanceHistory{
+			history(1, alice, 10, "mint", "0", "100", day1),
+			history(1, alice, 20, "transfer_out", "100", "60", day2.Add(time.Hour)),
+			history(1, bob, 20, "transfer_in", "0", "40", day2.Add(time.Hour)),
+			history(2, alice, 30, "mint", "0", "7", day2.Add(time.Hour)),
+		},
+		&[]models.Holding{
+			{ChainID: 1, TokenAddress: token, UserAddress: alice, Balance: "60", BlockNumber: 20},
+			{ChainID: 1, TokenAddress: token, UserAddress: bob, Balance: "40", BlockNumber: 20},
+			{ChainID: 2, TokenAddress: token, UserAddress: alice, Balance: "7", BlockNumber: 30},
+		},
+		&[]models.EventLog{
+			{ChainID: 1, EventName: "Transfer", UserAddress: alice, ContractAddress: token, Amount: "100", TxHash: "0x10", BlockNumber: 10, Timestamp: day1},
+			{ChainID: 1, EventName: "Transfer", UserAddress: alice, ContractAddress: token, Amount: "40", TxHash: "0x20", BlockNumber: 20, Timestamp: day2},
+		},
+		&[]models.RawLog{rawLog(1, 10), rawLog(1, 20), rawLog(2, 30)},
+		&[]models.ChainBlock{{ChainID: 1, BlockNumber: 10, BlockHash: "0x10"}, {ChainID: 1, BlockNumber: 20, BlockHash: "0x20"}},
+		&models.DeadLetter{ChainID: 1, ChainName: "test", TxHash: "0x21", BlockNumber: 21, RawLog: "{}", Status: deadLetterPending,
+			FirstFailedAt: day2, LastFailedAt: day2, NextRetryAt: day2},
+		&[]models.PointsRecord{
+			{ChainID: 1, TokenAddress: token, UserAddress: alice, Points: 1, Balance: "100", Hours: 24, CalculateDate: day1},
+			{ChainID: 1, TokenAddress: token, UserAddress: alice, Points: 2, Balance: "60", Hours: 24, CalculateDate: day2},
+			{ChainID: 1, TokenAddress: token, UserAddress: bob, Points: 3, Balance: "40", Hours: 24, CalculateDate: day2},
+		},
+		&[]models.UserDailySummary{
+			{UserAddress: alice, SummaryDate: day1, OpeningBalance: "0", ClosingBalance: "100", AverageBalance: "100"},
+			{UserAddress: alice, SummaryDate: day2, OpeningBalance: "100", ClosingBalance: "60", AverageBalance: "60"},
+		},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reverted *revertedChainData
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		reverted, err = revertChainData(tx, 1, 15)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(reverted.Users)
+	if reverted.Events != 1 || reverted.PointsRemoved != 2 || reverted.SummariesRemoved != 1 ||
+		len(reverted.Users) != 2 || reverted.Users[0] != alice || reverted.Users[1] != bob {
+		t.Fatalf("reverted = %+v", reverted)
+	}
+
+	var holdings []models.Holding
+	if err := db.Order("chain_id, user_address").Find(&holdings).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 2 ||
+		holdings[0].ChainID != 1 || holdings[0].UserAddress != alice || holdings[0].Balance != "100" || holdings[0].BlockNumber != 10 ||
+		holdings[1].ChainID != 2 || holdings[1].Balance != "7" {
+		t.Fatalf("holdings = %+v", holdings)
+	}
+
+	var rawLogs []models.RawLog
+	if err := db.Order("chain_id, block_number").Find(&rawLogs).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range rawLogs {
+		if want := raw.ChainID == 1 && raw.BlockNumber > 15; raw.Removed != want {
+			t.Errorf("raw log %d/%d removed = %v, want %v", raw.ChainID, raw.BlockNumber, raw.Removed, want)
+		}
+	}
+
+	counts := []struct {
+		model interface{}
+		want  int64
+	}{
+		{&models.UserBalanceHistory{}, 2},
+		{&models.EventLog{}, 1},
+		{&models.ChainBlock{}, 1},
+		{&models.DeadLetter{}, 0},
+		{&models.PointsRecord{}, 1},
+		{&models.UserDailySummary{}, 1},
+	}
+	for _, count := range counts {
+		var got int64
+		if err := db.Model(count.model).Count(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got != count.want {
+			t.Errorf("%T rows = %d, want %d", count.model, got, count.want)
+		}
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.TotalPoints != 1 {
+		t.Errorf("alice total points = %v, want 1", user.TotalPoints)
+	}
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// replayFlushSize 回放时每累计多少条余额历史写入一次影子表
+const replayFlushSize = 1000
+
+// replayPosition 日志在链上的位置，按 (区块, 日志索引) 排序
+type replayPosition struct {
+	Block    uint64
+	LogIndex uint
+}
+
+// before 是否排在 other 之前
+func (p replayPosition) before(other replayPosition) bool {
+	if p.Block != other.Block {
+		return p.Block < other.Block
+	}
+	return p.LogIndex < other.LogIndex
+}
+
+// replayChainState 一条链的回放进度
+type replayChainState struct {
+	report   *ReplayChainReport
+	position replayPosition // 已回放到的位置 (包含)
+	started  bool           // 是否已回放过任何日志
+	stopped  bool           // 遇到无法入账的日志后停止，之后的日志不再回放
+}
+
+// replayLedger 回放使用的内存账本
+//
+// 复用 balanceLedger 的记账逻辑，余额历史与同步时写入的完全一致；所有持仓都保存在内存中，
+// 余额历史按批写入 histories 指定的表。
+type replayLedger struct {
+	ledger    *balanceLedger
+	createdAt map[string]time.Time // 回放涉及的用户及其首次出现的时间
+	chains    map[int64]*replayChainState
+	histories string // 余额历史写入的表
+	pending   []models.UserBalanceHistory
+}
+
+// newReplayLedger 创建空的回放账本，余额历史写入 histories 表
+func newReplayLedger(histories string) *replayLedger {
+	return &replayLedger{
+		ledger: &balanceLedger{
+			holdings: make(map[balanceScope]*ledgerEntry),
+		},
+		createdAt: make(map[string]time.Time),
+		chains:    make(map[int64]*replayChainState),
+		histories: histories,
+	}
+}
+
+// applied 账本已处理的日志、余额修正和跳过的死信总数，用于判断追赶时是否有新的变化
+func (r *replayLedger) applied() int {
+	total := 0
+	for _, state := range r.chains {
+		total += state.report.Logs + state.report.Reconciliations + state.report.Skipped
+	}
+	return total
+}
+
+// ensure 为 transfer 涉及的地址准备零余额的用户和持仓
+func (r *replayLedger) ensure(chainID int64, token common.Address, at time.Time, addresses ...common.Address) {
+	for _, address := range addresses {
+		if address == (common.Address{}) {
+			continue
+		}
+		if _, ok := r.createdAt[address.Hex()]; !ok {
+			r.createdAt[address.Hex()] = at
+		}
+		scope := balanceScope{ChainID: chainID, TokenAddress: token.Hex(), UserAddress: address.Hex()}
+		if _, ok := r.ledger.holdings[scope]; !ok {
+			r.ledger.holdings[scope] = &ledgerEntry{Balance: new(big.Int)}
+		}
+	}
+}
+
+// replayChain 按 (区块, 日志索引) 顺序回放一条链在 (state.position, bound] 范围内的原始日志
+//
+// 已丢弃的死信日志跳过；管理员在 bound 之前修正余额写入的 reconciliation 历史插入到对应区块的末尾。
+// 日志会导致负余额时与同步一样停止这条链的回放。
+func (r *replayLedger) replayChain(tx *gorm.DB, state *replayChainState, bound replayPosition) error {
+	if state.stopped {
+		return nil
+	}
+	chainID := state.report.ChainID
+
+	discarded, err := discardedLogKeys(tx, chainID)
+	if err != nil {
+		return err
+	}
+	adjustments, err := r.loadAdjustments(tx, state, bound)
+	if err != nil {
+		return err
+	}
+
+	// 按 (区块, 日志索引) 分页读取，读取和写入可以在同一个事务连接上交替进行
+	for {
+		query := tx.Where("chain_id = ? AND event_name = ? AND removed = ? AND block_number <= ?", chainID, "Transfer", false, bound.Block)
+		if state.started {
+			query = query.Where("(block_number > ? OR (block_number = ? AND log_index > ?))",
+				state.position.Block, state.position.Block, state.position.LogIndex)
+		}
+		var page []models.RawLog
+		if err := query.Order("block_number, log_index").Limit(replayFlushSize).Find(&page).Error; err != nil {
+			return fmt.Errorf("读取链 %d 的原始日志失败: %v", chainID, err)
+		}
+
+		for i := range page {
+			raw := &page[i]
+			position := replayPosition{Block: raw.BlockNumber, LogIndex: raw.LogIndex}
+			if bound.before(position) {
+				page = nil
+				break
+			}
+
+			// 先应用排在这条日志之前的余额修正
+			for len(adjustments) > 0 && adjustments[0].BlockNumber < raw.BlockNumber {
+				if err := r.applyAdjustment(state, adjustments[0]); err != nil {
+					return err
+				}
+				adjustments = adjustments[1:]
+			}
+
+			if discarded[eventKey{ChainID: chainID, TxHash: raw.TxHash, LogIndex: raw.LogIndex}] {
+				state.report.Skipped++
+				r.advance(state, position)
+				continue
+			}
+
+			transfer, err := rawTransfer(raw)
+			if err != nil {
+				return err
+			}
+			r.ensure(chainID, transfer.Token, transfer.Timestamp, transfer.From, transfer.To)
+			histories, err := r.ledger.applyTransfer(transfer)
+			if errors.Is(err, errNegativeBalance) {
+				state.stopped = true
+				state.report.StoppedAt = fmt.Sprintf("%s:%d", raw.TxHash, raw.LogIndex)
+				state.report.Error = err.Error()
+				return r.flush(tx)
+			}
+			if err != nil {
+				return err
+			}
+			r.pending = append(r.pending, histories...)
+			state.report.Logs++
+			r.advance(state, position)
+		}
+
+		if err := r.flush(tx); err != nil {
+			return err
+		}
+		if len(page) < replayFlushSize {
+			break
+		}
+	}
+
+	for _, adjustment := range adjustments {
+		if err := r.applyAdjustment(state, adjustment); err != nil {
+			return err
+		}
+	}
+	return r.flush(tx)
+}
+
+// loadAdjustments 范围内的 reconciliation 余额历史，按区块排序
+func (r *replayLedger) loadAdjustments(tx *gorm.DB, state *replayChainState, bound replayPosition) ([]models.UserBalanceHistory, error) {
+	query := tx.Where("chain_id = ? AND change_type = ? AND block_number <= ?",
+		state.report.ChainID, reconciliationChangeType, bound.Block)
+	if state.started {
+		query = query.Where("block_number >= ?", state.position.Block)
+	}
+
+	var adjustments []models.UserBalanceHistory
+	if err := query.Order("block_number, log_index, id").Find(&adjustments).Error; err != nil {
+		return nil, fmt.Errorf("读取余额修正记录失败: %v", err)
+	}
+
+	kept := adjustments[:0]
+	for _, adjustment := range adjustments {
+		position := replayPosition{Block: adjustment.BlockNumber, LogIndex: adjustment.LogIndex}
+		if state.started && !state.position.before(position) || bound.before(position) {
+			continue
+		}
+		kept = append(kept, adjustment)
+	}
+	return kept, nil
+}
+
+// applyAdjustment 重新应用一条按链上余额修正的记录，变化量取原记录的 new_balance - old_balance
+func (r *replayLedger) applyAdjustment(state *replayChainState, adjustment models.UserBalanceHistory) error {
+	oldBalance, ok1 := new(big.Int).SetString(adjustment.OldBalance, 10)
+	newBalance, ok2 := new(big.Int).SetString(adjustment.NewBalance, 10)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("无效的余额修正记录: %d", adjustment.ID)
+	}
+
+	token := common.HexToAddress(adjustment.TokenAddress)
+	address := common.HexToAddress(adjustment.UserAddress)
+	event := &transferEvent{
+		ChainID:     adjustment.ChainID,
+		Token:       token,
+		TxHash:      adjustment.TxHash,
+		LogIndex:    adjustment.LogIndex,
+		BlockNumber: adjustment.BlockNumber,
+		Timestamp:   adjustment.Timestamp,
+	}
+	r.ensure(adjustment.ChainID, token, adjustment.Timestamp, address)
+	history := r.ledger.applyBalanceChange(event, address, new(big.Int).Sub(newBalance, oldBalance), reconciliationChangeType)
+	r.pending = append(r.pending, history)
+	state.report.Reconciliations++
+	r.advance(state, replayPosition{Block: adjustment.BlockNumber, LogIndex: adjustment.LogIndex})
+	return nil
+}
+
+// advance 记录已回放到的位置
+func (r *replayLedger) advance(state *replayChainState, position replayPosition) {
+	state.position = position
+	state.started = true
+}
+
+// flush 把累计的余额历史写入影子表
+func (r *replayLedger) flush(tx *gorm.DB) error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	if err := tx.Table(r.histories).CreateInBatches(r.pending, storeBatchSize).Error; err != nil {
+		return fmt.Errorf("写入回放余额历史失败: %v", err)
+	}
+	r.pending = r.pending[:0]
+	return nil
+}
+
+// rawTransfer 从归档的原始日志的解码列还原 Transfer 事件
+func rawTransfer(raw *models.RawLog) (*transferEvent, error) {
+	amount, ok := new(big.Int).SetString(raw.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("原始日志 %s:%d 的金额无效: %q", raw.TxHash, raw.LogIndex, raw.Amount)
+	}
+	var timestamp time.Time
+	if raw.BlockTime != nil {
+		timestamp = *raw.BlockTime
+	}
+	return &transferEvent{
+		ChainID:     raw.ChainID,
+		Token:       common.HexToAddress(raw.Address),
+		TxHash:      raw.TxHash,
+		LogIndex:    raw.LogIndex,
+		BlockNumber: raw.BlockNumber,
+		From:        common.HexToAddress(raw.FromAddress),
+		To:          common.HexToAddress(raw.ToAddress),
+		Amount:      amount,
+		Timestamp:   timestamp,
+	}, nil
+}
+
+// discardedLogKeys 某条链上被管理员丢弃的死信日志
+func discardedLogKeys(tx *gorm.DB, chainID int64) (map[eventKey]bool, error) {
+	var keys []eventKey
+	err := tx.Model(&models.DeadLetter{}).
+		Select("chain_id, tx_hash, log_index").
+		Where("chain_id = ? AND status = ?", chainID, deadLetterDiscarded).
+		Find(&keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询已丢弃的死信失败: %v", err)
+	}
+	discarded := make(map[eventKey]bool, len(keys))
+	for _, key := range keys {
+		discarded[key] = true
+	}
+	return discarded, nil
+}
+
+// replayDay 一个用户一天的余额汇总，余额为所有代币之和
+type replayDay struct {
+	start, end time.Time
+	opening    *big.Int
+	closing    *big.Int
+	minted     *big.Int
+	burned     *big.Int
+	in         *big.Int
+	out        *big.Int
+	weighted   *big.Int // 余额 × 毫秒，用于计算时间加权平均余额
+	heldMs     int64    // 余额大于0的毫秒数
+	last       time.Time
+}
+
+// accrue 把上一次变动到 at 之间的余额计入时间加权
+func (d *replayDay) accrue(at time.Time) {
+	if at.After(d.end) {
+		at = d.end
+	}
+	if !at.After(d.last) {
+		return
+	}
+	ms := at.Sub(d.last).Milliseconds()
+	d.weighted.Add(d.weighted, new(big.Int).Mul(d.closing, big.NewInt(ms)))
+	if d.closing.Sign() > 0 {
+		d.heldMs += ms
+	}
+	d.last = at
+}
+
+// summary 转换为每日汇总，points 为当天的积分
+func (d *replayDay) summary(address string, points float64) models.UserDailySummary {
+	average := new(big.Int)
+	if span := d.end.Sub(d.start).Milliseconds(); span > 0 {
+		average.Quo(d.weighted, big.NewInt(span))
+	}
+	return models.UserDailySummary{
+		UserAddress:    address,
+		SummaryDate:    d.start,
+		OpeningBalance: d.opening.String(),
+		ClosingBalance: d.closing.String(),
+		VolumeMinted:   d.minted.String(),
+		VolumeBurned:   d.burned.String(),
+		TransferIn:     d.in.String(),
+		TransferOut:    d.out.String(),
+		PointsEarned:   points,
+		AverageBalance: average.String(),
+		HoursHeld:      float64(d.heldMs) / float64(time.Hour.Milliseconds()),
+	}
+}
+
+// buildDailySummaries 按 histories 表中的余额历史重新生成每日汇总并写入 summaries 表
+//
+// 只为有余额变动的日期生成汇总。余额为用户所有代币之和，按时间顺序累计每条历史的 new_balance - old_balance；
+// 平均余额按当天的时间加权 (当天未结束时截至 now)，积分取 points_records 中当天的积分之和。
+func buildDailySummaries(tx *gorm.DB, histories, summaries string, now time.Time) (int, error) {
+	points, err := dailyPoints(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Table(histories).
+		Select("user_address, old_balance, new_balance, change_type, timestamp").
+		Order("user_address, timestamp, chain_id, block_number, log_index, id").
+		Rows()
+	if err != nil {
+		return 0, fmt.Errorf("读取余额历史失败: %v", err)
+	}
+	defer rows.Close()
+
+	// 结果集读完后再写入，同一个事务连接上不能在读取结果集的同时执行写入
+	var batch []models.UserDailySummary
+	var user string
+	var balance *big.Int
+	var day *replayDay
+	closeDay := func() {
+		if day == nil {
+			return
+		}
+		day.accrue(day.end)
+		batch = append(batch, day.summary(user, points[dailyPointsKey(user, day.start)]))
+		day = nil
+	}
+
+	for rows.Next() {
+		var address, oldValue, newValue, changeType string
+		var timestamp time.Time
+		if err := rows.Scan(&address, &oldValue, &newValue, &changeType, &timestamp); err != nil {
+			return 0, err
+		}
+		oldBalance, ok1 := new(big.Int).SetString(oldValue, 10)
+		newBalance, ok2 := new(big.Int).SetString(newValue, 10)
+		if !ok1 || !ok2 {
+			return 0, fmt.Errorf("无效的余额历史: %s %s -> %s", address, oldValue, newValue)
+		}
+
+		if address != user {
+			closeDay()
+			user = address
+			balance = new(big.Int)
+		}
+		dayStart := startOfDay(timestamp)
+		if day == nil || !day.start.Equal(dayStart) {
+			closeDay()
+			end := dayStart.AddDate(0, 0, 1)
+			if end.After(now) {
+				end = now
+			}
+			day = &replayDay{
+				start: dayStart, end: end, last: dayStart,
+				opening: new(big.Int).Set(balance), closing: new(big.Int).Set(balance),
+				minted: new(big.Int), burned: new(big.Int), in: new(big.Int), out: new(big.Int),
+				weighted: new(big.Int),
+			}
+		}
+		day.accrue(timestamp)
+
+		delta := new(big.Int).Sub(newBalance, oldBalance)
+		balance.Add(balance, delta)
+		day.closing.Set(balance)
+		amount := new(big.Int).Abs(delta)
+		switch changeType {
+		case "mint":
+			day.minted.Add(day.minted, amount)
+		case "burn":
+			day.burned.Add(day.burned, amount)
+		case "transfer_in":
+			day.in.Add(day.in, amount)
+		case "transfer_out":
+			day.out.Add(day.out, amount)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	closeDay()
+	rows.Close()
+
+	if len(batch) > 0 {
+		if err := tx.Table(summaries).CreateInBatches(batch, storeBatchSize).Error; err != nil {
+			return 0, fmt.Errorf("写入每日汇总失败: %v", err)
+		}
+	}
+	return len(batch), nil
+}
+
+// dailyPoints 每个用户每天的积分之和
+func dailyPoints(tx *gorm.DB) (map[string]float64, error) {
+	var records []models.PointsRecord
+	if err := tx.Select("user_address, points, calculate_date").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("读取积分记录失败: %v", err)
+	}
+	points := make(map[string]float64)
+	for _, record := range records {
+		points[dailyPointsKey(record.UserAddress, startOfDay(record.CalculateDate))] += record.Points
+	}
+	return points, nil
+}
+
+// dailyPointsKey 每日积分按用户和日期汇总的键
+func dailyPointsKey(address string, day time.Time) string {
+	return address + "|" + day.Format("2006-01-02")
+}
+
+// startOfDay 本地时区当天的零点
+func startOfDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,639 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// replayTable 回放重建的派生表及其影子表
+type replayTable struct {
+	Live   string
+	Shadow string
+	Model  interface{} // 线上表的模型，替换时按它列出列名
+}
+
+var (
+	replayUsers     = replayTable{Live: "users", Shadow: "users_replay", Model: &models.User{}}
+	replayHistories = replayTable{Live: "user_balance_history", Shadow: "user_balance_history_replay", Model: &models.UserBalanceHistory{}}
+	replayHoldings  = replayTable{Live: "holdings", Shadow: "holdings_replay", Model: &models.Holding{}}
+	replaySummaries = replayTable{Live: "user_daily_summary", Shadow: "user_daily_summary_replay", Model: &models.UserDailySummary{}}
+
+	// replayTables 按外键依赖排序：用户表在前
+	replayTables = []replayTable{replayUsers, replayHistories, replayHoldings, replaySummaries}
+)
+
+// replayDiffSamples 差异报告中最多列出的持仓差异数
+const replayDiffSamples = 100
+
+var (
+	// ErrReplayRunning 回放或交换正在进行
+	ErrReplayRunning = errors.New("回放正在进行中")
+	// ErrReplayNotFound 没有可以交换的回放结果
+	ErrReplayNotFound = errors.New("没有可以交换的回放结果，请先执行回放")
+	// ErrReplayStale 回放之后发生了链重组、余额修正或死信丢弃，需要重新回放
+	ErrReplayStale = errors.New("回放结果已过期")
+)
+
+// ReplayService 从原始日志重建派生数据
+//
+// 不访问 RPC：按 (区块, 日志索引) 顺序回放 raw_logs 中已归档的 Transfer 日志，
+// 把用户余额、余额历史、持仓和每日汇总重建到 *_replay 影子表中，与线上表对比后可以原子地替换线上数据。
+// 回放到每条链的同步游标为止，未处理的死信之后的日志不回放，已丢弃的死信跳过，
+// 按链上余额修正的 reconciliation 记录在原区块的末尾重新应用，用户总积分取 points_records 之和。
+type ReplayService struct {
+	db *gorm.DB
+
+	ctx    context.Context // 后台回放使用的上下文，Stop 时取消
+	cancel context.CancelFunc
+
+	running sync.Mutex // 同一时间只运行一次回放或交换
+
+	mu     sync.RWMutex
+	report *ReplayReport
+	ledger *replayLedger // 最近一次回放的内存账本，交换时从这里继续追赶新同步的日志
+}
+
+// ReplayOptions 回放参数
+type ReplayOptions struct {
+	Swap bool `json:"swap"` // 回放完成后立即替换线上数据
+}
+
+// ReplayChainReport 一条链的回放结果
+type ReplayChainReport struct {
+	ChainName       string `json:"chain_name"`
+	ChainID         int64  `json:"chain_id"`
+	LastBlock       uint64 `json:"last_block"`           // 回放到的同步游标
+	Logs            int    `json:"logs"`                 // 回放的 Transfer 日志数
+	Reconciliations int    `json:"reconciliations"`      // 重新应用的余额修正数
+	Skipped         int    `json:"skipped"`              // 跳过的已丢弃死信数
+	BlockedBy       uint   `json:"blocked_by,omitempty"` // 未处理的死信，回放停在它之前
+	StoppedAt       string `json:"stopped_at,omitempty"` // 回放时无法入账的日志 (tx_hash:log_index)
+	Error           string `json:"error,omitempty"`
+	MissingRawLogs  int64  `json:"missing_raw_logs"` // event_logs 中有但没有归档原始日志的事件数，不为0时回放结果不完整
+}
+
+// ReplayDiff 影子表与线上表的差异
+type ReplayDiff struct {
+	UsersChanged      int64               `json:"users_changed"`       // 只存在于影子表的用户
+	HoldingsChanged   int64               `json:"holdings_changed"`    // 余额不同或只存在于一边的持仓
+	HistoryLive       int64               `json:"history_live"`        // 线上余额历史条数
+	HistoryReplay     int64               `json:"history_replay"`      // 回放得到的余额历史条数
+	HistoryOnlyLive   int64               `json:"history_only_live"`   // 只存在于线上的余额历史
+	HistoryOnlyReplay int64               `json:"history_only_replay"` // 只存在于影子表的余额历史
+	HistoryChanged    int64               `json:"history_changed"`     // 同一变动前后余额不同的余额历史
+	SummariesLive     int64               `json:"summaries_live"`
+	SummariesReplay   int64               `json:"summaries_replay"`
+	Samples           []ReplayHoldingDiff `json:"samples"` // 部分持仓差异
+}
+
+// ReplayHoldingDiff 一个持仓在线上与回放结果中的余额
+type ReplayHoldingDiff struct {
+	ChainID       int64  `json:"chain_id"`
+	TokenAddress  string `json:"token_address"`
+	UserAddress   string `json:"user_address"`
+	LiveBalance   string `json:"live_balance"`   // 线上余额，没有持仓时为空
+	ReplayBalance string `json:"replay_balance"` // 回放余额，没有持仓时为空
+}
+
+// ReplayReport 一次回放的结果
+type ReplayReport struct {
+	Status         string              `json:"status"` // running, completed, failed
+	StartedAt      time.Time           `json:"started_at"`
+	FinishedAt     *time.Time          `json:"finished_at"`
+	Chains         []ReplayChainReport `json:"chains"`
+	Users          int                 `json:"users"`
+	Holdings       int                 `json:"holdings"`
+	DailySummaries int                 `json:"daily_summaries"`
+	Diff           *ReplayDiff         `json:"diff"`
+	Swapped        bool                `json:"swapped"`
+	SwappedAt      *time.Time          `json:"swapped_at,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// NewReplayService 创建回放服务
+func NewReplayService(db *gorm.DB) *ReplayService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ReplayService{db: db, ctx: ctx, cancel: cancel}
+}
+
+// Stop 取消正在后台进行的回放
+func (rs *ReplayService) Stop() {
+	rs.cancel()
+}
+
+// LastReport 最近一次回放的结果，没有回放过时为 nil
+func (rs *ReplayService) LastReport() *ReplayReport {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if rs.report == nil {
+		return nil
+	}
+	report := *rs.report
+	return &report
+}
+
+// StartReplay 在后台启动回放，立即返回进行中的结果，进度和结果通过 LastReport 查询
+//
+// 回放使用服务自己的上下文，不随发起请求的连接断开而取消。
+func (rs *ReplayService) StartReplay(opts ReplayOptions) (*ReplayReport, error) {
+	if !rs.running.TryLock() {
+		return nil, ErrReplayRunning
+	}
+	startedAt := rs.begin()
+
+	go func() {
+		defer rs.running.Unlock()
+		if _, err := rs.run(rs.ctx, opts, startedAt); err != nil {
+			middleware.Error("❌ 回放失败: %v", err)
+		}
+	}()
+	return rs.LastReport(), nil
+}
+
+// Replay 把派生数据重建到影子表并与线上表对比，opts.Swap 为 true 时随后替换线上数据 (命令行使用)
+func (rs *ReplayService) Replay(ctx context.Context, opts ReplayOptions) (*ReplayReport, error) {
+	if !rs.running.TryLock() {
+		return nil, ErrReplayRunning
+	}
+	defer rs.running.Unlock()
+
+	return rs.run(ctx, opts, rs.begin())
+}
+
+// begin 记录一次进行中的回放，之前的回放结果不能再交换
+func (rs *ReplayService) begin() time.Time {
+	startedAt := time.Now()
+	rs.store(&ReplayReport{Status: "running", StartedAt: startedAt}, nil)
+	return startedAt
+}
+
+// run 执行回放，调用方需持有 running 锁
+func (rs *ReplayService) run(ctx context.Context, opts ReplayOptions, startedAt time.Time) (*ReplayReport, error) {
+	report := &ReplayReport{Status: "running", StartedAt: startedAt}
+	middleware.Info("⏪ 开始从原始日志回放派生数据...")
+
+	ledger, err := rs.build(ctx, report)
+	now := time.Now()
+	report.FinishedAt = &now
+	if err != nil {
+		report.Status = "failed"
+		report.Error = err.Error()
+		rs.store(report, nil)
+		return report, err
+	}
+	report.Status = "completed"
+	rs.store(report, ledger)
+
+	diff := report.Diff
+	middleware.Info("✅ 回放完成: 用户 %d, 持仓 %d, 余额历史 %d (线上 %d), 差异: 用户 %d, 持仓 %d, 历史 %d/%d/%d",
+		report.Users, report.Holdings, diff.HistoryReplay, diff.HistoryLive, diff.UsersChanged, diff.HoldingsChanged,
+		diff.HistoryOnlyLive, diff.HistoryOnlyReplay, diff.HistoryChanged)
+
+	if opts.Swap {
+		if err := rs.swap(ctx); err != nil {
+			return rs.LastReport(), err
+		}
+	}
+	return rs.LastReport(), nil
+}
+
+// Swap 用最近一次回放的结果替换线上数据
+func (rs *ReplayService) Swap(ctx context.Context) (*ReplayReport, error) {
+	if !rs.running.TryLock() {
+		return nil, ErrReplayRunning
+	}
+	defer rs.running.Unlock()
+
+	if err := rs.swap(ctx); err != nil {
+		return nil, err
+	}
+	return rs.LastReport(), nil
+}
+
+// store 保存最近一次回放的结果
+func (rs *ReplayService) store(report *ReplayReport, ledger *replayLedger) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.report = report
+	rs.ledger = ledger
+}
+
+// build 准备影子表，回放每条链并写入用户、持仓和每日汇总，最后与线上表对比
+//
+// 影子表每次按线上表重新创建，线上表迁移之后两边的列保持一致。
+func (rs *ReplayService) build(ctx context.Context, report *ReplayReport) (*replayLedger, error) {
+	for _, table := range replayTables {
+		if err := rs.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table.Shadow)).Error; err != nil {
+			return nil, fmt.Errorf("删除影子表 %s 失败: %v", table.Shadow, err)
+		}
+		if err := rs.db.Exec(fmt.Sprintf("CREATE TABLE %s LIKE %s", table.Shadow, table.Live)).Error; err != nil {
+			return nil, fmt.Errorf("创建影子表 %s 失败: %v", table.Shadow, err)
+		}
+	}
+
+	ledger := newReplayLedger(replayHistories.Shadow)
+
+	// 线上已有的用户全部保留 (余额从0开始回放)，没有余额变动的用户也不会丢失
+	var users []models.User
+	if err := rs.db.Select("id, created_at").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("读取用户失败: %v", err)
+	}
+	for _, user := range users {
+		ledger.createdAt[user.ID] = user.CreatedAt
+	}
+
+	if err := rs.replayChains(ctx, rs.db, ledger); err != nil {
+		return nil, err
+	}
+	if err := rs.writeState(rs.db, ledger, report); err != nil {
+		return nil, err
+	}
+
+	diff, err := rs.diff()
+	if err != nil {
+		return nil, err
+	}
+	report.Diff = diff
+	return ledger, nil
+}
+
+// replayChains 把每条链从账本记录的位置回放到当前的同步游标
+//
+// tx 为交换时的事务，此时同步游标已被锁定；首次回放时为普通连接。
+func (rs *ReplayService) replayChains(ctx context.Context, tx *gorm.DB, ledger *replayLedger) error {
+	cursors, err := replayCursors(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, cursor := range cursors {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		state := ledger.chains[cursor.ChainID]
+		if state == nil {
+			state = &replayChainState{report: &ReplayChainReport{ChainName: cursor.ChainName, ChainID: cursor.ChainID}}
+			ledger.chains[cursor.ChainID] = state
+		}
+		state.report.LastBlock = cursor.LastBlock
+
+		bound, blockedBy, err := replayBound(tx, cursor.ChainID, cursor.LastBlock)
+		if err != nil {
+			return err
+		}
+		state.report.BlockedBy = blockedBy
+		if err := ledger.replayChain(tx, state, bound); err != nil {
+			return fmt.Errorf("回放 %s 失败: %v", cursor.ChainName, err)
+		}
+
+		missing, err := missingRawLogs(tx, cursor.ChainID)
+		if err != nil {
+			return err
+		}
+		state.report.MissingRawLogs = missing
+		if missing > 0 {
+			middleware.Warn("⚠️ %s 有 %d 个事件没有归档原始日志，回放结果不完整，需要重新回填这些区块", cursor.ChainName, missing)
+		}
+		if state.stopped {
+			middleware.Warn("⚠️ %s 回放在日志 %s 处停止: %s", cursor.ChainName, state.report.StoppedAt, state.report.Error)
+		}
+	}
+	return nil
+}
+
+// writeState 把账本中的用户和持仓写入影子表，并重新生成每日汇总
+func (rs *ReplayService) writeState(tx *gorm.DB, ledger *replayLedger, report *ReplayReport) error {
+	for _, table := range []replayTable{replayUsers, replayHoldings, replaySummaries} {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table.Shadow)).Error; err != nil {
+			return fmt.Errorf("清空影子表 %s 失败: %v", table.Shadow, err)
+		}
+	}
+
+	points, err := userTotalPoints(tx)
+	if err != nil {
+		return err
+	}
+	users := make([]models.User, 0, len(ledger.createdAt))
+	for address, createdAt := range ledger.createdAt {
+		users = append(users, models.User{
+			ID:          address,
+			TotalPoints: points[address],
+			CreatedAt:   createdAt,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > 0 {
+		if err := tx.Table(replayUsers.Shadow).CreateInBatches(users, storeBatchSize).Error; err != nil {
+			return fmt.Errorf("写入回放用户失败: %v", err)
+		}
+	}
+
+	holdings := make([]models.Holding, 0, len(ledger.ledger.holdings))
+	for scope, entry := range ledger.ledger.holdings {
+		holdings = append(holdings, models.Holding{
+			ChainID:      scope.ChainID,
+			TokenAddress: scope.TokenAddress,
+			UserAddress:  scope.UserAddress,
+			Balance:      entry.Balance.String(),
+			BlockNumber:  entry.BlockNumber,
+		})
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		a, b := holdings[i], holdings[j]
+		if a.ChainID != b.ChainID {
+			return a.ChainID < b.ChainID
+		}
+		if a.TokenAddress != b.TokenAddress {
+			return a.TokenAddress < b.TokenAddress
+		}
+		return a.UserAddress < b.UserAddress
+	})
+	if len(holdings) > 0 {
+		if err := tx.Table(replayHoldings.Shadow).CreateInBatches(holdings, storeBatchSize).Error; err != nil {
+			return fmt.Errorf("写入回放持仓失败: %v", err)
+		}
+	}
+
+	summaries, err := buildDailySummaries(tx, replayHistories.Shadow, replaySummaries.Shadow, time.Now())
+	if err != nil {
+		return err
+	}
+
+	report.Users = len(users)
+	report.Holdings = len(holdings)
+	report.DailySummaries = summaries
+	report.Chains = nil
+	for _, state := range ledger.chains {
+		report.Chains = append(report.Chains, *state.report)
+	}
+	sort.Slice(report.Chains, func(i, j int) bool { return report.Chains[i].ChainID < report.Chains[j].ChainID })
+	return nil
+}
+
+// swap 用影子表替换线上的用户余额、余额历史、持仓和每日汇总
+//
+// 先在不加锁的情况下把回放之后新同步的日志追赶到影子表，再在一个事务中锁定所有同步游标，
+// 只追赶这期间新增的少量日志并替换线上数据，同步器被阻塞的时间不包含大部分追赶工作。
+// 同步和回滚的事务同样先锁定游标再写入 (见 lockSyncCursor)，与交换的加锁顺序一致。
+// 回放之后发生过链重组、余额修正或死信丢弃时拒绝替换。
+// 替换失败后内存账本与影子表可能不一致，需要重新回放。
+func (rs *ReplayService) swap(ctx context.Context) error {
+	rs.mu.RLock()
+	report, ledger := rs.report, rs.ledger
+	rs.mu.RUnlock()
+	if report == nil || ledger == nil {
+		return ErrReplayNotFound
+	}
+	if report.Swapped {
+		return fmt.Errorf("%w: 该回放结果已经替换过线上数据", ErrReplayNotFound)
+	}
+
+	swapped := *report
+	err := rs.catchUp(ctx, ledger, &swapped)
+	if err == nil {
+		err = rs.db.Transaction(func(tx *gorm.DB) error {
+			var cursors []models.ChainSyncStatus
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id").Find(&cursors).Error; err != nil {
+				return fmt.Errorf("锁定同步游标失败: %v", err)
+			}
+			if err := replayStale(tx, report.StartedAt); err != nil {
+				return err
+			}
+
+			applied := ledger.applied()
+			if err := rs.replayChains(ctx, tx, ledger); err != nil {
+				return err
+			}
+			if ledger.applied() != applied {
+				if err := rs.writeState(tx, ledger, &swapped); err != nil {
+					return err
+				}
+			}
+			return replaceLiveTables(tx)
+		})
+	}
+	if err != nil {
+		failed := *report
+		failed.Error = err.Error()
+		rs.store(&failed, nil)
+		return fmt.Errorf("替换线上数据失败: %w", err)
+	}
+
+	now := time.Now()
+	swapped.Swapped = true
+	swapped.SwappedAt = &now
+	rs.store(&swapped, nil)
+	middleware.Info("🔄 已用回放结果替换线上数据: 用户 %d, 持仓 %d, 每日汇总 %d",
+		swapped.Users, swapped.Holdings, swapped.DailySummaries)
+	return nil
+}
+
+// catchUp 不锁定同步游标，把回放之后新同步的日志追赶到影子表
+func (rs *ReplayService) catchUp(ctx context.Context, ledger *replayLedger, report *ReplayReport) error {
+	if err := replayStale(rs.db, report.StartedAt); err != nil {
+		return err
+	}
+	applied := ledger.applied()
+	if err := rs.replayChains(ctx, rs.db, ledger); err != nil {
+		return err
+	}
+	if ledger.applied() == applied {
+		return nil
+	}
+	return rs.writeState(rs.db, ledger, report)
+}
+
+// replaceLiveTables 把影子表的数据复制到线上表
+//
+// 用户按主键更新总积分 (积分记录等其他表通过外键引用用户，不能删除用户行)；其余三张表整表替换。
+// 复制时按模型列出列名，不依赖线上表与影子表的列顺序。
+func replaceLiveTables(tx *gorm.DB) error {
+	statements := []string{
+		fmt.Sprintf(`INSERT INTO %s (id, total_points, created_at, updated_at)
+			SELECT s.id, s.total_points, s.created_at, NOW() FROM %s s
+			ON DUPLICATE KEY UPDATE total_points = s.total_points, updated_at = NOW()`,
+			replayUsers.Live, replayUsers.Shadow),
+	}
+	for _, table := range []replayTable{replayHistories, replayHoldings, replaySummaries} {
+		columns, err := replayColumns(tx, table.Model)
+		if err != nil {
+			return err
+		}
+		statements = append(statements,
+			fmt.Sprintf("DELETE FROM %s", table.Live),
+			fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", table.Live, columns, columns, table.Shadow))
+	}
+
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayColumns 模型对应的列名，以逗号分隔
+func replayColumns(tx *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return "", fmt.Errorf("解析 %T 失败: %v", model, err)
+	}
+	return strings.Join(stmt.Schema.DBNames, ", "), nil
+}
+
+// replayStale 回放开始之后是否发生了无法追赶的变化
+func replayStale(tx *gorm.DB, since time.Time) error {
+	checks := []struct {
+		model  interface{}
+		query  string
+		reason string
+	}{
+		{&models.ReorgReport{}, "created_at >= ?", "发生了链重组"},
+		{&models.UserBalanceHistory{}, "change_type = '" + reconciliationChangeType + "' AND created_at >= ?", "有新的链上余额修正"},
+		{&models.DeadLetter{}, "status = '" + deadLetterDiscarded + "' AND updated_at >= ?", "有死信被丢弃"},
+	}
+	for _, check := range checks {
+		var count int64
+		if err := tx.Model(check.model).Where(check.query, since).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: 回放之后%s，请重新回放", ErrReplayStale, check.reason)
+		}
+	}
+	return nil
+}
+
+// diff 对比影子表与线上表
+func (rs *ReplayService) diff() (*ReplayDiff, error) {
+	diff := &ReplayDiff{Samples: []ReplayHoldingDiff{}}
+	historyJoin := "l.chain_id = s.chain_id AND l.tx_hash = s.tx_hash AND l.log_index = s.log_index AND l.user_address = s.user_address AND l.change_type = s.change_type"
+	holdingJoin := "l.chain_id = s.chain_id AND l.token_address = s.token_address AND l.user_address = s.user_address"
+
+	counts := []struct {
+		target *int64
+		query  string
+	}{
+		{&diff.UsersChanged, fmt.Sprintf("SELECT COUNT(*) FROM %s s LEFT JOIN %s l ON l.id = s.id WHERE l.id IS NULL",
+			replayUsers.Shadow, replayUsers.Live)},
+		{&diff.HistoryLive, fmt.Sprintf("SELECT COUNT(*) FROM %s", replayHistories.Live)},
+		{&diff.HistoryReplay, fmt.Sprintf("SELECT COUNT(*) FROM %s", replayHistories.Shadow)},
+		{&diff.HistoryOnlyLive, fmt.Sprintf("SELECT COUNT(*) FROM %s l LEFT JOIN %s s ON %s WHERE s.id IS NULL",
+			replayHistories.Live, replayHistories.Shadow, historyJoin)},
+		{&diff.HistoryOnlyReplay, fmt.Sprintf("SELECT COUNT(*) FROM %s s LEFT JOIN %s l ON %s WHERE l.id IS NULL",
+			replayHistories.Shadow, replayHistories.Live, historyJoin)},
+		{&diff.HistoryChanged, fmt.Sprintf("SELECT COUNT(*) FROM %s l JOIN %s s ON %s WHERE l.old_balance <> s.old_balance OR l.new_balance <> s.new_balance",
+			replayHistories.Live, replayHistories.Shadow, historyJoin)},
+		{&diff.SummariesLive, fmt.Sprintf("SELECT COUNT(*) FROM %s", replaySummaries.Live)},
+		{&diff.SummariesReplay, fmt.Sprintf("SELECT COUNT(*) FROM %s", replaySummaries.Shadow)},
+	}
+	for _, count := range counts {
+		if err := rs.db.Raw(count.query).Scan(count.target).Error; err != nil {
+			return nil, fmt.Errorf("对比影子表失败: %v", err)
+		}
+	}
+
+	// 持仓两个方向都要比较：影子表中余额不同或新增的，以及线上有余额但回放中不存在的
+	holdingQueries := []string{
+		fmt.Sprintf(`SELECT s.chain_id, s.token_address, s.user_address, COALESCE(l.balance, '') AS live_balance, s.balance AS replay_balance
+			FROM %s s LEFT JOIN %s l ON %s WHERE l.id IS NULL OR l.balance <> s.balance ORDER BY s.chain_id, s.token_address, s.user_address`,
+			replayHoldings.Shadow, replayHoldings.Live, holdingJoin),
+		fmt.Sprintf(`SELECT l.chain_id, l.token_address, l.user_address, l.balance AS live_balance, '' AS replay_balance
+			FROM %s l LEFT JOIN %s s ON %s WHERE s.id IS NULL ORDER BY l.chain_id, l.token_address, l.user_address`,
+			replayHoldings.Live, replayHoldings.Shadow, holdingJoin),
+	}
+	for _, query := range holdingQueries {
+		var count int64
+		if err := rs.db.Raw("SELECT COUNT(*) FROM (" + query + ") d").Scan(&count).Error; err != nil {
+			return nil, fmt.Errorf("对比持仓失败: %v", err)
+		}
+		diff.HoldingsChanged += count
+
+		if remaining := replayDiffSamples - len(diff.Samples); remaining > 0 {
+			var samples []ReplayHoldingDiff
+			if err := rs.db.Raw(fmt.Sprintf("%s LIMIT %d", query, remaining)).Scan(&samples).Error; err != nil {
+				return nil, fmt.Errorf("对比持仓失败: %v", err)
+			}
+			diff.Samples = append(diff.Samples, samples...)
+		}
+	}
+	return diff, nil
+}
+
+// replayCursors 每条链的同步游标，同一链ID有多个游标时取处理得最远的
+func replayCursors(tx *gorm.DB) ([]models.ChainSyncStatus, error) {
+	var statuses []models.ChainSyncStatus
+	if err := tx.Order("chain_id, last_block desc").Find(&statuses).Error; err != nil {
+		return nil, fmt.Errorf("读取同步游标失败: %v", err)
+	}
+	cursors := make([]models.ChainSyncStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if len(cursors) > 0 && cursors[len(cursors)-1].ChainID == status.ChainID {
+			continue
+		}
+		cursors = append(cursors, status)
+	}
+	return cursors, nil
+}
+
+// replayBound 一条链可以回放到的位置 (包含)
+//
+// 与同步保持一致：游标之后有未处理的死信时，回放到它之前的一条日志 (同一区块中排在它前面的日志已经入账)，
+// 否则回放到游标所在区块的最后一条日志。返回阻塞的死信ID，没有时为0。
+func replayBound(tx *gorm.DB, chainID int64, lastBlock uint64) (replayPosition, uint, error) {
+	letter, err := pendingDeadLetter(tx, chainID, lastBlock)
+	if err != nil {
+		return replayPosition{}, 0, fmt.Errorf("读取死信失败: %v", err)
+	}
+	if letter == nil {
+		return replayPosition{Block: lastBlock, LogIndex: ^uint(0)}, 0, nil
+	}
+	if letter.LogIndex == 0 {
+		return replayPosition{Block: letter.BlockNumber - 1, LogIndex: ^uint(0)}, letter.ID, nil
+	}
+	return replayPosition{Block: letter.BlockNumber, LogIndex: letter.LogIndex - 1}, letter.ID, nil
+}
+
+// missingRawLogs 某条链上已入库但没有归档原始日志的事件数 (归档功能上线之前同步的区块)
+func missingRawLogs(tx *gorm.DB, chainID int64) (int64, error) {
+	var count int64
+	err := tx.Table("event_logs e").
+		Joins("LEFT JOIN raw_logs r ON r.chain_id = e.chain_id AND r.tx_hash = e.tx_hash AND r.log_index = e.log_index AND r.removed = ?", false).
+		Where("e.chain_id = ? AND r.id IS NULL", chainID).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("检查原始日志归档失败: %v", err)
+	}
+	return count, nil
+}
+
+// userTotalPoints 每个用户在 points_records 中的积分之和
+func userTotalPoints(tx *gorm.DB) (map[string]float64, error) {
+	var rows []struct {
+		UserAddress string
+		Total       float64
+	}
+	err := tx.Model(&models.PointsRecord{}).
+		Select("user_address, COALESCE(SUM(points), 0) AS total").
+		Group("user_address").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("汇总积分失败: %v", err)
+	}
+	points := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		points[row.UserAddress] = row.Total
+	}
+	return points, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestReplaySwap(t *testing.T) {
+	db := openTestDB(t)
+	token := common.HexToAddress("0x00000000000000000000000000000000000000aa").Hex()
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001").Hex()
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002").Hex()
+	carol := common.HexToAddress("0x0000000000000000000000000000000000000003").Hex()
+	zero := common.Address{}.Hex()
+	blockTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+
+	rawLog := func(block uint64, logIndex uint, from, to, amount string, removed bool) models.RawLog {
+		at := blockTime.Add(time.Duration(block) * time.Minute)
+		return models.RawLog{
+			ChainID:     1,
+			Address:     token,
+			BlockNumber: block,
+			TxHash:      common.BigToHash(common.Big1).Hex(),
+			BlockHash:   common.BigToHash(new(big.Int).SetUint64(block)).Hex(),
+			LogIndex:    logIndex,
+			Removed:     removed,
+			EventName:   "Transfer",
+			FromAddress: from,
+			ToAddress:   to,
+			Amount:      amount,
+			BlockTime:   &at,
+		}
+	}
+	logs := []models.RawLog{
+		rawLog(5, 0, zero, alice, "100", false),
+		rawLog(6, 1, alice, bob, "40", false),
+		rawLog(7, 2, alice, carol, "10", true), // 已被链重组回滚
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.ChainSyncStatus{ChainName: "test", ChainID: 1, LastBlock: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.User{ID: alice}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Holding{ChainID: 1, TokenAddress: token, UserAddress: alice, Balance: "999"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rs := NewReplayService(db)
+	report, err := rs.Replay(context.Background(), ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != "completed" || report.Holdings != 2 || report.Diff.HoldingsChanged != 2 {
+		t.Fatalf("report = %+v, diff = %+v", report, report.Diff)
+	}
+
+	// 回放之后新同步的日志在交换时追赶
+	late := rawLog(11, 0, bob, alice, "5", false)
+	if err := db.Create(&late).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.ChainSyncStatus{}).Where("chain_name = ?", "test").Update("last_block", 11).Error; err != nil {
+		t.Fatal(err)
+	}
+	swapped, err := rs.Swap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swapped.Swapped {
+		t.Fatalf("report = %+v", swapped)
+	}
+
+	var holdings []models.Holding
+	if err := db.Order("user_address").Find(&holdings).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{alice: "65", bob: "35"}
+	if len(holdings) != len(want) {
+		t.Fatalf("holdings = %+v", holdings)
+	}
+	for _, holding := range holdings {
+		if want[holding.UserAddress] != holding.Balance {
+			t.Fatalf("%s balance = %s, want %s", holding.UserAddress, holding.Balance, want[holding.UserAddress])
+		}
+	}
+
+	var histories int64
+	if err := db.Model(&models.UserBalanceHistory{}).Count(&histories).Error; err != nil {
+		t.Fatal(err)
+	}
+	if histories != 5 {
+		t.Fatalf("histories = %d, want 5", histories)
+	}
+
+	if _, err := rs.Swap(context.Background()); err == nil {
+		t.Fatal("swapping the same replay twice should fail")
+	}
+}
+
+func TestStartReplayRunsInBackground(t *testing.T) {
+	db := openTestDB(t)
+	rs := NewReplayService(db)
+	defer rs.Stop()
+
+	report, err := rs.StartReplay(ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != "running" || report.FinishedAt != nil {
+		t.Fatalf("initial report = %+v", report)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for report.Status == "running" {
+		if time.Now().After(deadline) {
+			t.Fatal("replay did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+		report = rs.LastReport()
+	}
+	if report.Status != "completed" || report.Diff == nil {
+		t.Fatalf("report = %+v", report)
+	}
+}
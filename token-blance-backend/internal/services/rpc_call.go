@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RPC 错误分类
+const (
+	rpcErrorTransient   = "transient"    // 超时、限流、连接错误等，可以重试
+	rpcErrorPermanent   = "permanent"    // 参数错误、方法不存在等，重试没有意义
+	rpcErrorRangeLimit  = "range_limit"  // 查询范围或结果数超限，由调用方缩小范围
+	rpcErrorNotFound    = "not_found"    // 区块或数据不存在，可能只是该端点落后，切换端点确认
+	rpcErrorCircuitOpen = "circuit_open" // 熔断器打开，调用被直接拒绝
+)
+
+const (
+	// rpcMaxRetries 所有端点都失败后的最大重试轮数
+	rpcMaxRetries = 3
+	// rpcBackoffBase/rpcBackoffMax 指数退避的初始和最大等待时间
+	rpcBackoffBase = 500 * time.Millisecond
+	rpcBackoffMax  = 8 * time.Second
+	// rpcBreakerThreshold 连续失败多少次后打开熔断器
+	rpcBreakerThreshold = 5
+	// rpcBreakerCooldown 熔断器打开后多久允许一次试探调用
+	rpcBreakerCooldown = 30 * time.Second
+)
+
+// 熔断器状态
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// errCircuitOpen 熔断器打开时直接拒绝调用
+var errCircuitOpen = errors.New("RPC 熔断器已打开，暂停调用")
+
+// RPCError 分类后的 RPC 调用错误
+type RPCError struct {
+	Method   string
+	Kind     string
+	Endpoint string // 隐藏凭据后的端点地址
+	Err      error
+
+	url string // 原始端点地址，只用于从错误信息中隐藏凭据
+}
+
+// Error 实现 error 接口，格式: [分类] 方法 @ 端点: 原始错误
+//
+// 错误信息会写入同步状态并对外展示，原始错误中出现的端点地址替换为隐藏凭据后的地址。
+func (e *RPCError) Error() string {
+	if e.Endpoint == "" {
+		return fmt.Sprintf("[%s] %s: %v", e.Kind, e.Method, e.Err)
+	}
+	message := e.Err.Error()
+	if e.url != "" {
+		message = strings.ReplaceAll(message, e.url, e.Endpoint)
+	}
+	return fmt.Sprintf("[%s] %s @ %s: %s", e.Kind, e.Method, e.Endpoint, message)
+}
+
+// Unwrap 返回原始错误
+func (e *RPCError) Unwrap() error {
+	return e.Err
+}
+
+// classifyRPCError 将 RPC 错误分为可重试和不可重试两类
+//
+// 超时、限流和服务端错误的 HTTP 状态码最先判断：限流响应的正文也可能带有 "limit exceeded"，
+// 不能当成查询范围超限，否则不会切换端点，也不计入熔断器。
+func classifyRPCError(err error) string {
+	var httpErr rpc.HTTPError
+	isHTTPErr := errors.As(err, &httpErr)
+	if isHTTPErr && (httpErr.StatusCode == 408 || httpErr.StatusCode == 429 || httpErr.StatusCode >= 500) {
+		return rpcErrorTransient
+	}
+	if isRangeLimitError(err) {
+		return rpcErrorRangeLimit
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		return rpcErrorNotFound
+	}
+	if isHTTPErr {
+		return rpcErrorPermanent
+	}
+
+	var jsonErr rpc.Error
+	if errors.As(err, &jsonErr) {
+		switch jsonErr.ErrorCode() {
+		case -32600, -32601, -32602, 3: // 无效请求、方法不存在、参数错误、执行回滚
+			return rpcErrorPermanent
+		}
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, pattern := range []string{"method not found", "invalid argument", "invalid params", "execution reverted"} {
+		if strings.Contains(message, pattern) {
+			return rpcErrorPermanent
+		}
+	}
+	return rpcErrorTransient
+}
+
+// backoffDelay 第 attempt 次重试前的等待时间：指数退避加全抖动
+func backoffDelay(attempt int) time.Duration {
+	delay := rpcBackoffBase << uint(attempt-1)
+	if delay > rpcBackoffMax || delay <= 0 {
+		delay = rpcBackoffMax
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// sleepContext 等待 delay，上下文结束时提前返回 false
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// circuitBreaker 单条链的 RPC 熔断器
+//
+// 连续 rpcBreakerThreshold 次调用（重试之后）失败时打开，期间所有调用直接失败；
+// rpcBreakerCooldown 之后进入半开状态，放行一次试探调用，成功则关闭，失败则重新打开。
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers 按链名称共享熔断器：同一条链的单链服务、多链服务和回填使用同一个
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*circuitBreaker)
+)
+
+// breakerFor 获取链的熔断器
+func breakerFor(chainName string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breaker, ok := breakers[chainName]
+	if !ok {
+		breaker = &circuitBreaker{state: circuitClosed}
+		breakers[chainName] = breaker
+	}
+	return breaker
+}
+
+// allow 判断是否允许本次调用
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < rpcBreakerCooldown {
+			return errCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return nil
+	case circuitHalfOpen:
+		if b.probing {
+			return errCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// success 记录一次成功调用，关闭熔断器
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = circuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// failure 记录一次失败调用，达到阈值或试探失败时打开熔断器
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == circuitHalfOpen || b.failures >= rpcBreakerThreshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release 调用被调用方取消，不计成功也不计失败，只释放半开状态的试探名额
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State 熔断器当前状态
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
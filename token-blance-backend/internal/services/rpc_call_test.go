@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// 冷却期已过的打开状态
+	cooledDown := func() *circuitBreaker {
+		return &circuitBreaker{state: circuitOpen, failures: rpcBreakerThreshold, openedAt: time.Now().Add(-rpcBreakerCooldown - time.Second)}
+	}
+
+	tests := []struct {
+		name      string
+		breaker   *circuitBreaker
+		run       func(b *circuitBreaker) error // 返回最后一次 allow 的结果
+		wantState string
+		wantErr   error
+	}{
+		{
+			name:    "opens after threshold failures",
+			breaker: &circuitBreaker{state: circuitClosed},
+			run: func(b *circuitBreaker) error {
+				for i := 0; i < rpcBreakerThreshold; i++ {
+					b.failure()
+				}
+				return b.allow()
+			},
+			wantState: circuitOpen,
+			wantErr:   errCircuitOpen,
+		},
+		{
+			name:    "success resets failures",
+			breaker: &circuitBreaker{state: circuitClosed},
+			run: func(b *circuitBreaker) error {
+				for i := 0; i < rpcBreakerThreshold-1; i++ {
+					b.failure()
+				}
+				b.success()
+				b.failure()
+				return b.allow()
+			},
+			wantState: circuitClosed,
+		},
+		{
+			name:      "stays open during cooldown",
+			breaker:   &circuitBreaker{state: circuitOpen, openedAt: time.Now()},
+			run:       func(b *circuitBreaker) error { return b.allow() },
+			wantState: circuitOpen,
+			wantErr:   errCircuitOpen,
+		},
+		{
+			name:    "half open allows a single probe",
+			breaker: cooledDown(),
+			run: func(b *circuitBreaker) error {
+				if err := b.allow(); err != nil {
+					return err
+				}
+				return b.allow()
+			},
+			wantState: circuitHalfOpen,
+			wantErr:   errCircuitOpen,
+		},
+		{
+			name:    "successful probe closes",
+			breaker: cooledDown(),
+			run: func(b *circuitBreaker) error {
+				if err := b.allow(); err != nil {
+					return err
+				}
+				b.success()
+				return b.allow()
+			},
+			wantState: circuitClosed,
+		},
+		{
+			name:    "failed probe reopens",
+			breaker: cooledDown(),
+			run: func(b *circuitBreaker) error {
+				if err := b.allow(); err != nil {
+					return err
+				}
+				b.failure()
+				return b.allow()
+			},
+			wantState: circuitOpen,
+			wantErr:   errCircuitOpen,
+		},
+		{
+			name:    "released probe can be retried",
+			breaker: cooledDown(),
+			run: func(b *circuitBreaker) error {
+				if err := b.allow(); err != nil {
+					return err
+				}
+				b.release()
+				return b.allow()
+			},
+			wantState: circuitHalfOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(tt.breaker)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("allow = %v, want %v", err, tt.wantErr)
+			}
+			if state := tt.breaker.State(); state != tt.wantState {
+				t.Fatalf("state = %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
+
+// jsonRPCError 节点返回的 JSON-RPC 错误
+type jsonRPCError struct {
+	code    int
+	message string
+}
+
+func (e jsonRPCError) Error() string  { return e.message }
+func (e jsonRPCError) ErrorCode() int { return e.code }
+
+func TestClassifyRPCError(t *testing.T) {
+	rateLimited := rpc.HTTPError{
+		StatusCode: 429,
+		Status:     "429 Too Many Requests",
+		Body:       []byte(`{"jsonrpc":"2.0","error":{"code":-32005,"message":"rate limit exceeded"}}`),
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "429 rate limit exceeded", err: rateLimited, want: rpcErrorTransient},
+		{name: "wrapped 429", err: fmt.Errorf("获取区块失败: %w", rateLimited), want: rpcErrorTransient},
+		{name: "json-rpc rate limit exceeded", err: jsonRPCError{-32005, "daily request count exceeded, request rate limited"}, want: rpcErrorTransient},
+		{name: "503", err: rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"}, want: rpcErrorTransient},
+		{name: "408", err: rpc.HTTPError{StatusCode: 408, Status: "408 Request Timeout"}, want: rpcErrorTransient},
+		{name: "401", err: rpc.HTTPError{StatusCode: 401, Status: "401 Unauthorized"}, want: rpcErrorPermanent},
+		{name: "413 range too large", err: rpc.HTTPError{StatusCode: 413, Status: "413", Body: []byte("range too large")}, want: rpcErrorRangeLimit},
+		{name: "too many results", err: jsonRPCError{-32005, "query returned more than 10000 results"}, want: rpcErrorRangeLimit},
+		{name: "block range limit", err: errors.New("block range limit exceeded"), want: rpcErrorRangeLimit},
+		{name: "not found", err: ethereum.NotFound, want: rpcErrorNotFound},
+		{name: "invalid params", err: jsonRPCError{-32602, "invalid argument 0"}, want: rpcErrorPermanent},
+		{name: "connection refused", err: errors.New("dial tcp: connection refused"), want: rpcErrorTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyRPCError(tt.err); got != tt.want {
+				t.Fatalf("classifyRPCError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"token-balance/internal/middleware"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// rpcProbeInterval 探测各端点最新区块（计算区块落后）的间隔
+	rpcProbeInterval = 30 * time.Second
+	// rpcStatsAlpha 延迟和错误率的指数移动平均系数
+	rpcStatsAlpha = 0.2
+	// rpcUnhealthyErrorRate 错误率超过该值的端点排到最后，仅在其他端点都失败时使用
+	rpcUnhealthyErrorRate = 0.5
+	// rpcMaxHeadLag 最新区块落后超过该值的端点视为不健康
+	rpcMaxHeadLag = 10
+)
+
+// RPCPool 单条链的 RPC 端点池
+//
+// 每个端点记录延迟、错误率和最新区块落后数，每次调用按健康度排序选择端点，
+// 调用失败时自动切换到下一个端点，并带有重试退避和熔断（见 rpc_call.go）。
+type RPCPool struct {
+	chainName string
+	endpoints []*rpcEndpoint
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// rpcEndpoint 单个 RPC 端点及其健康统计
+type rpcEndpoint struct {
+	url    string
+	client *ethclient.Client
+
+	mu            sync.Mutex
+	latency       float64 // 毫秒，指数移动平均
+	errorRate     float64 // 0-1，指数移动平均
+	requests      uint64
+	errors        uint64
+	headBlock     uint64
+	lastError     string
+	lastErrorTime *time.Time
+}
+
+// RPCEndpointStats 端点统计，在多链状态接口中展示
+type RPCEndpointStats struct {
+	URL           string     `json:"url"` // 隐藏凭据后的地址，见 redactRPCURL
+	Healthy       bool       `json:"healthy"`
+	LatencyMs     float64    `json:"latency_ms"`
+	ErrorRate     float64    `json:"error_rate"`
+	Requests      uint64     `json:"requests"`
+	Errors        uint64     `json:"errors"`
+	HeadBlock     uint64     `json:"head_block"`
+	HeadLag       uint64     `json:"head_lag"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// DialRPCPool 连接链的所有 RPC 端点
+//
+// 每个端点都会校验链ID：expectedChainID 为0时以第一个可用端点的链ID为准。
+// 无法连接或链ID不一致的端点会被跳过，没有可用端点时返回错误。
+func DialRPCPool(chainName string, urls []string, expectedChainID int64) (*RPCPool, error) {
+	pool := &RPCPool{
+		chainName: chainName,
+		stop:      make(chan struct{}),
+	}
+
+	for _, url := range urls {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			cancel()
+			middleware.Warn("⚠️ %s 连接 RPC 失败，跳过端点 %s: %v", chainName, url, err)
+			continue
+		}
+
+		chainID, err := client.ChainID(ctx)
+		cancel()
+		if err != nil {
+			client.Close()
+			middleware.Warn("⚠️ %s 获取链ID失败，跳过端点 %s: %v", chainName, url, err)
+			continue
+		}
+		if expectedChainID == 0 {
+			expectedChainID = chainID.Int64()
+		}
+		if chainID.Int64() != expectedChainID {
+			client.Close()
+			middleware.Warn("⚠️ %s 端点 %s 链ID不匹配: 期望 %d, 实际 %d，已跳过", chainName, url, expectedChainID, chainID.Int64())
+			continue
+		}
+
+		pool.endpoints = append(pool.endpoints, &rpcEndpoint{url: url, client: client})
+	}
+
+	if len(pool.endpoints) == 0 {
+		return nil, fmt.Errorf("%s 没有可用的 RPC 端点", chainName)
+	}
+
+	if len(pool.endpoints) > 1 {
+		go pool.probeLoop()
+	}
+	return pool, nil
+}
+
+// Close 关闭所有端点连接
+func (p *RPCPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		for _, endpoint := range p.endpoints {
+			endpoint.client.Close()
+		}
+	})
+}
+
+// ChainID 获取链ID
+func (p *RPCPool) ChainID(ctx context.Context) (*big.Int, error) {
+	var chainID *big.Int
+	err := p.call(ctx, "eth_chainId", func(endpoint *rpcEndpoint) (err error) {
+		chainID, err = endpoint.client.ChainID(ctx)
+		return err
+	})
+	return chainID, err
+}
+
+// HeaderByNumber 获取区块头，number 为 nil 时获取最新区块
+func (p *RPCPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := p.call(ctx, "eth_getBlockByNumber", func(endpoint *rpcEndpoint) (err error) {
+		header, err = endpoint.client.HeaderByNumber(ctx, number)
+		if err == nil && number == nil {
+			endpoint.observeHead(header.Number.Uint64())
+		}
+		return err
+	})
+	return header, err
+}
+
+// HeaderByHash 按区块哈希获取区块头
+func (p *RPCPool) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	var header *types.Header
+	err := p.call(ctx, "eth_getBlockByHash", func(endpoint *rpcEndpoint) (err error) {
+		header, err = endpoint.client.HeaderByHash(ctx, hash)
+		return err
+	})
+	return header, err
+}
+
+// FilterLogs 查询日志
+func (p *RPCPool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := p.call(ctx, "eth_getLogs", func(endpoint *rpcEndpoint) (err error) {
+		logs, err = endpoint.client.FilterLogs(ctx, query)
+		return err
+	})
+	return logs, err
+}
+
+// CallContract 执行 eth_call，blockNumber 为 nil 时使用最新区块
+func (p *RPCPool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := p.call(ctx, "eth_call", func(endpoint *rpcEndpoint) (err error) {
+		result, err = endpoint.client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+// Stats 获取各端点的健康统计
+func (p *RPCPool) Stats() []RPCEndpointStats {
+	maxHead := p.maxHead()
+	stats := make([]RPCEndpointStats, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		stats = append(stats, endpoint.stats(maxHead))
+	}
+	return stats
+}
+
+// call 通过熔断器调用 RPC：按健康度依次尝试各端点，全部失败时指数退避后重试
+//
+// 永久错误和查询范围超限直接返回给调用方，不切换端点也不重试；区块或数据不存在可能只是端点落后，
+// 切换到其他端点，所有端点都返回不存在时才返回给调用方。重试耗尽后计入链的熔断器，
+// 连续失败达到阈值后熔断器打开，后续调用直接失败。调用方取消或超时不计入熔断器。
+func (p *RPCPool) call(ctx context.Context, method string, fn func(endpoint *rpcEndpoint) error) error {
+	breaker := breakerFor(p.chainName)
+	if err := breaker.allow(); err != nil {
+		return &RPCError{Method: method, Kind: rpcErrorCircuitOpen, Err: err}
+	}
+
+	var lastErr *RPCError
+	notFound := make(map[*rpcEndpoint]bool)
+	for attempt := 0; attempt <= rpcMaxRetries; attempt++ {
+		if attempt > 0 && !sleepContext(ctx, backoffDelay(attempt)) {
+			break
+		}
+
+		for _, endpoint := range p.ranked() {
+			if notFound[endpoint] {
+				continue
+			}
+			start := time.Now()
+			err := fn(endpoint)
+			if err == nil {
+				endpoint.record(time.Since(start), nil)
+				breaker.success()
+				return nil
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			rpcErr := &RPCError{Method: method, Kind: classifyRPCError(err), Endpoint: redactRPCURL(endpoint.url), Err: err, url: endpoint.url}
+			if rpcErr.Kind == rpcErrorNotFound {
+				// 端点正常响应，但可能落后于其他端点
+				endpoint.record(time.Since(start), nil)
+				notFound[endpoint] = true
+				if len(notFound) == len(p.endpoints) {
+					breaker.success()
+					return rpcErr
+				}
+				continue
+			}
+			if rpcErr.Kind != rpcErrorTransient {
+				// 端点正常响应，问题在请求本身
+				endpoint.record(time.Since(start), nil)
+				breaker.success()
+				return rpcErr
+			}
+
+			endpoint.record(time.Since(start), err)
+			lastErr = rpcErr
+			middleware.Warn("⚠️ %s", rpcErr.Error())
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		// 调用方取消或超时，不代表链的 RPC 不可用
+		breaker.release()
+		return &RPCError{Method: method, Kind: rpcErrorTransient, Err: ctx.Err()}
+	}
+	breaker.failure()
+	return lastErr
+}
+
+// peek 按健康度依次尝试各端点一次，不重试，不计入熔断器和端点统计
+//
+// 用于状态查询等辅助调用：节点不支持的请求 (例如 safe/finalized 标签) 会被归类为
+// 临时错误，如果走 call 会累计到链的熔断器，多次查询状态就可能打开熔断器、停止同步。
+func (p *RPCPool) peek(ctx context.Context, method string, fn func(endpoint *rpcEndpoint) error) error {
+	var lastErr error
+	for _, endpoint := range p.ranked() {
+		err := fn(endpoint)
+		if err == nil {
+			return nil
+		}
+		lastErr = &RPCError{Method: method, Kind: classifyRPCError(err), Endpoint: redactRPCURL(endpoint.url), Err: err, url: endpoint.url}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+// peekHeaderByNumber 获取区块头，不计入熔断器 (见 peek)
+func (p *RPCPool) peekHeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := p.peek(ctx, "eth_getBlockByNumber", func(endpoint *rpcEndpoint) (err error) {
+		header, err = endpoint.client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+// ranked 按健康度排序端点：健康的端点优先，其次按错误率加权的延迟
+func (p *RPCPool) ranked() []*rpcEndpoint {
+	if len(p.endpoints) == 1 {
+		return p.endpoints
+	}
+
+	maxHead := p.maxHead()
+	type scored struct {
+		endpoint *rpcEndpoint
+		healthy  bool
+		score    float64
+	}
+	candidates := make([]scored, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		stats := endpoint.stats(maxHead)
+		candidates = append(candidates, scored{
+			endpoint: endpoint,
+			healthy:  stats.Healthy,
+			score:    stats.LatencyMs * (1 + 10*stats.ErrorRate),
+		})
+	}
+
+	// 稳定排序：没有统计数据时保持配置顺序
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].healthy != candidates[j].healthy {
+			return candidates[i].healthy
+		}
+		return candidates[i].score < candidates[j].score
+	})
+
+	ranked := make([]*rpcEndpoint, 0, len(candidates))
+	for _, candidate := range candidates {
+		ranked = append(ranked, candidate.endpoint)
+	}
+	return ranked
+}
+
+// maxHead 所有端点中最高的最新区块
+func (p *RPCPool) maxHead() uint64 {
+	var maxHead uint64
+	for _, endpoint := range p.endpoints {
+		endpoint.mu.Lock()
+		if endpoint.headBlock > maxHead {
+			maxHead = endpoint.headBlock
+		}
+		endpoint.mu.Unlock()
+	}
+	return maxHead
+}
+
+// probeLoop 定期获取每个端点的最新区块，用于计算区块落后数
+func (p *RPCPool) probeLoop() {
+	ticker := time.NewTicker(rpcProbeInterval)
+	defer ticker.Stop()
+
+	p.probe()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.probe()
+		}
+	}
+}
+
+// probe 探测所有端点
+func (p *RPCPool) probe() {
+	for _, endpoint := range p.endpoints {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		start := time.Now()
+		header, err := endpoint.client.HeaderByNumber(ctx, nil)
+		cancel()
+
+		endpoint.record(time.Since(start), err)
+		if err == nil {
+			endpoint.observeHead(header.Number.Uint64())
+		}
+	}
+}
+
+// record 记录一次调用的延迟和结果
+func (e *rpcEndpoint) record(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ms := float64(latency.Microseconds()) / 1000
+	if e.requests == 0 {
+		e.latency = ms
+	} else {
+		e.latency = e.latency*(1-rpcStatsAlpha) + ms*rpcStatsAlpha
+	}
+	e.requests++
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+		e.errors++
+		now := time.Now()
+		e.lastError = err.Error()
+		e.lastErrorTime = &now
+	}
+	e.errorRate = e.errorRate*(1-rpcStatsAlpha) + failed*rpcStatsAlpha
+}
+
+// observeHead 记录端点返回的最新区块
+func (e *rpcEndpoint) observeHead(block uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if block > e.headBlock {
+		e.headBlock = block
+	}
+}
+
+// stats 端点统计快照，maxHead 为所有端点中最高的最新区块
+func (e *rpcEndpoint) stats(maxHead uint64) RPCEndpointStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var headLag uint64
+	if e.headBlock > 0 && maxHead > e.headBlock {
+		headLag = maxHead - e.headBlock
+	}
+
+	redacted := redactRPCURL(e.url)
+	return RPCEndpointStats{
+		URL:           redacted,
+		Healthy:       e.errorRate <= rpcUnhealthyErrorRate && headLag <= rpcMaxHeadLag,
+		LatencyMs:     e.latency,
+		ErrorRate:     e.errorRate,
+		Requests:      e.requests,
+		Errors:        e.errors,
+		HeadBlock:     e.headBlock,
+		HeadLag:       headLag,
+		LastError:     strings.ReplaceAll(e.lastError, e.url, redacted),
+		LastErrorTime: e.lastErrorTime,
+	}
+}
+
+// redactRPCURL 隐藏 RPC 地址中的凭据，只保留协议和主机
+//
+// 服务商的 API key 通常在路径 (/v3/<key>)、查询参数或用户信息中，对外展示时一律隐藏。
+func redactRPCURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "***"
+	}
+	redacted := parsed.Scheme + "://" + parsed.Host
+	if strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.User != nil {
+		redacted += "/***"
+	}
+	return redacted
+}
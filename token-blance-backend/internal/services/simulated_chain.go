@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/pkg/contracts"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// simulatedGasLimit 模拟链的区块 gas 上限
+const simulatedGasLimit = uint64(30_000_000)
+
+// SimulatedChain 基于 go-ethereum 模拟后端的内存链
+//
+// 实现 ChainBackend，可以在不连接任何 RPC 的情况下部署 TokenBalance 合约、
+// 铸造/转账/销毁代币，再用与线上相同的同步流程入账。每笔交易单独出块，
+// 区块时间可以通过 AdvanceTime 推进，用于验证积分计算。
+// 模拟后端只保存最新状态，CallContract 只支持最新区块。
+type SimulatedChain struct {
+	backend  *backends.SimulatedBackend
+	chainID  *big.Int
+	owner    *bind.TransactOpts
+	keys     map[common.Address]*ecdsa.PrivateKey
+	accounts []common.Address
+
+	tokenABI  abi.ABI
+	token     *bind.BoundContract
+	tokenAddr common.Address
+}
+
+// NewSimulatedChain 创建模拟链，生成合约所有者和 accounts 个测试账户并预置 ETH
+//
+// start 不为零时，第一个区块的时间调整到 start，之后的区块按模拟后端的默认间隔递增。
+func NewSimulatedChain(accounts int, start time.Time) (*SimulatedChain, error) {
+	tokenABI, err := contracts.TokenBalanceABI()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &SimulatedChain{
+		keys:     make(map[common.Address]*ecdsa.PrivateKey),
+		tokenABI: tokenABI,
+	}
+
+	alloc := core.GenesisAlloc{}
+	funds := new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))
+	var ownerKey *ecdsa.PrivateKey
+	for i := 0; i <= accounts; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		alloc[addr] = core.GenesisAccount{Balance: funds}
+		sc.keys[addr] = key
+		if i == 0 {
+			ownerKey = key
+		} else {
+			sc.accounts = append(sc.accounts, addr)
+		}
+	}
+
+	sc.backend = backends.NewSimulatedBackend(alloc, simulatedGasLimit)
+	sc.chainID = sc.backend.Blockchain().Config().ChainID
+
+	sc.owner, err = bind.NewKeyedTransactorWithChainID(ownerKey, sc.chainID)
+	if err != nil {
+		sc.Close()
+		return nil, err
+	}
+
+	if !start.IsZero() {
+		genesis := sc.backend.Blockchain().CurrentBlock()
+		offset := start.Sub(time.Unix(int64(genesis.Time), 0))
+		if err := sc.AdvanceTime(offset); err != nil {
+			sc.Close()
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// Close 停止模拟链
+func (sc *SimulatedChain) Close() {
+	sc.backend.Close()
+}
+
+// Owner 合约所有者地址 (部署者，可以铸造代币)
+func (sc *SimulatedChain) Owner() common.Address {
+	return sc.owner.From
+}
+
+// Accounts 测试账户地址
+func (sc *SimulatedChain) Accounts() []common.Address {
+	return sc.accounts
+}
+
+// TokenAddress 已部署的 TokenBalance 合约地址
+func (sc *SimulatedChain) TokenAddress() common.Address {
+	return sc.tokenAddr
+}
+
+// ChainID 获取链ID (模拟后端固定为 1337)
+func (sc *SimulatedChain) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(sc.chainID), nil
+}
+
+// HeaderByNumber 获取区块头，number 为 nil 时获取最新区块
+func (sc *SimulatedChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return sc.backend.HeaderByNumber(ctx, number)
+}
+
+// HeaderByHash 按区块哈希获取区块头
+func (sc *SimulatedChain) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return sc.backend.HeaderByHash(ctx, hash)
+}
+
+// FilterLogs 查询日志
+func (sc *SimulatedChain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return sc.backend.FilterLogs(ctx, query)
+}
+
+// CallContract 执行 eth_call，只支持最新区块
+func (sc *SimulatedChain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return sc.backend.CallContract(ctx, msg, blockNumber)
+}
+
+// Mine 出 n 个空块，用于满足确认深度
+func (sc *SimulatedChain) Mine(n int) {
+	for i := 0; i < n; i++ {
+		sc.backend.Commit()
+	}
+}
+
+// AdvanceTime 出一个时间向后推进 d 的空块
+func (sc *SimulatedChain) AdvanceTime(d time.Duration) error {
+	if err := sc.backend.AdjustTime(d); err != nil {
+		return err
+	}
+	sc.backend.Commit()
+	return nil
+}
+
+// DeployTokenBalance 由合约所有者部署 TokenBalance 合约
+func (sc *SimulatedChain) DeployTokenBalance(name, symbol string) (common.Address, error) {
+	bytecode, err := contracts.TokenBalanceBytecode()
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	addr, tx, token, err := bind.DeployContract(sc.owner, sc.tokenABI, bytecode, sc.backend, name, symbol)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("部署 TokenBalance 失败: %v", err)
+	}
+	sc.backend.Commit()
+	if err := sc.checkReceipt(tx, "deploy"); err != nil {
+		return common.Address{}, err
+	}
+
+	sc.token = token
+	sc.tokenAddr = addr
+	return addr, nil
+}
+
+// Mint 合约所有者给 to 铸造代币
+func (sc *SimulatedChain) Mint(to common.Address, amount *big.Int) error {
+	return sc.transact(sc.owner, "mint", to, amount)
+}
+
+// Transfer 从 from 转账给 to，from 必须是模拟链生成的账户
+func (sc *SimulatedChain) Transfer(from, to common.Address, amount *big.Int) error {
+	opts, err := sc.transactor(from)
+	if err != nil {
+		return err
+	}
+	return sc.transact(opts, "transfer", to, amount)
+}
+
+// Burn 销毁 from 持有的代币，from 必须是模拟链生成的账户
+func (sc *SimulatedChain) Burn(from common.Address, amount *big.Int) error {
+	opts, err := sc.transactor(from)
+	if err != nil {
+		return err
+	}
+	return sc.transact(opts, "burn", amount)
+}
+
+// BalanceOf 调用合约 balanceOf 获取最新区块的链上余额
+func (sc *SimulatedChain) BalanceOf(ctx context.Context, owner common.Address) (*big.Int, error) {
+	if sc.token == nil {
+		return nil, fmt.Errorf("TokenBalance 合约尚未部署")
+	}
+	var out []interface{}
+	if err := sc.token.Call(&bind.CallOpts{Context: ctx}, &out, "balanceOf", owner); err != nil {
+		return nil, err
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// transactor 账户的交易签名参数
+func (sc *SimulatedChain) transactor(from common.Address) (*bind.TransactOpts, error) {
+	if from == sc.owner.From {
+		return sc.owner, nil
+	}
+	key, ok := sc.keys[from]
+	if !ok {
+		return nil, fmt.Errorf("模拟链没有账户 %s 的私钥", from.Hex())
+	}
+	return bind.NewKeyedTransactorWithChainID(key, sc.chainID)
+}
+
+// transact 调用合约方法，单独出块并检查执行结果
+func (sc *SimulatedChain) transact(opts *bind.TransactOpts, method string, args ...interface{}) error {
+	if sc.token == nil {
+		return fmt.Errorf("TokenBalance 合约尚未部署")
+	}
+	tx, err := sc.token.Transact(opts, method, args...)
+	if err != nil {
+		return fmt.Errorf("调用 %s 失败: %v", method, err)
+	}
+	sc.backend.Commit()
+	return sc.checkReceipt(tx, method)
+}
+
+// checkReceipt 检查交易是否执行成功
+func (sc *SimulatedChain) checkReceipt(tx *types.Transaction, method string) error {
+	receipt, err := sc.backend.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		return fmt.Errorf("获取 %s 交易回执失败: %v", method, err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("%s 交易执行失败: %s", method, tx.Hash().Hex())
+	}
+	return nil
+}
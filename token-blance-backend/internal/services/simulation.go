@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// simulatedChainName 模拟链在同步游标中使用的链名称
+const simulatedChainName = "simulated"
+
+// ErrSimulationDatabaseInUse 数据库中有其他链的数据，不能用于模拟
+var ErrSimulationDatabaseInUse = errors.New("数据库不是模拟专用的数据库")
+
+// SimulationReport 离线模拟的结果
+type SimulationReport struct {
+	ChainID     int64               `json:"chain_id"`
+	Contract    string              `json:"contract"`
+	LatestBlock uint64              `json:"latest_block"`
+	Events      int                 `json:"events"`
+	StartTime   time.Time           `json:"start_time"`
+	EndTime     time.Time           `json:"end_time"`
+	Accounts    []SimulationAccount `json:"accounts"`
+}
+
+// SimulationAccount 单个测试账户的链上余额、入账余额和积分
+type SimulationAccount struct {
+	Address        string  `json:"address"`
+	ChainBalance   string  `json:"chain_balance"`
+	IndexedBalance string  `json:"indexed_balance"`
+	Points         float64 `json:"points"`
+	Match          bool    `json:"match"`
+}
+
+// RunSimulation 在内存模拟链上跑通完整流程：部署合约 → 铸造/转账/销毁 → 同步入账 → 计算积分
+//
+// 不需要任何 RPC 端点，数据写入传入的数据库 (链名称 simulated，链ID 1337)，
+// 运行前会清除上一次模拟留下的该链数据。数据库中存在其他链的同步游标或代币时拒绝运行，
+// 避免误清除线上数据。
+// 模拟从48小时前开始，操作之间推进区块时间，最后比对链上 balanceOf 和入账余额。
+func RunSimulation(ctx context.Context, db *gorm.DB) (*SimulationReport, error) {
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	chain, err := NewSimulatedChain(3, start)
+	if err != nil {
+		return nil, fmt.Errorf("创建模拟链失败: %v", err)
+	}
+	defer chain.Close()
+
+	contract, err := chain.DeployTokenBalance("TokenBalance", "TB")
+	if err != nil {
+		return nil, err
+	}
+	deployHeader, err := chain.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	deployBlock := deployHeader.Number.Uint64()
+	middleware.Info("🧪 模拟链已部署 TokenBalance: %s (区块 %d)", contract.Hex(), deployBlock)
+
+	if err := runSimulationScript(chain, start); err != nil {
+		return nil, err
+	}
+	// 出足够的空块，让所有操作都进入确认深度之内
+	chain.Mine(int(defaultConfirmationBlocks))
+
+	eventService, err := NewEventServiceWithBackend(db, chain, simulatedChainName, deployBlock)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSimulationDatabase(db, eventService.chainID); err != nil {
+		return nil, err
+	}
+	if err := resetSimulatedChain(db, eventService.chainID, deployBlock); err != nil {
+		return nil, fmt.Errorf("清除上一次模拟数据失败: %v", err)
+	}
+	token := models.Token{
+		ChainID:    eventService.chainID,
+		ChainName:  simulatedChainName,
+		Address:    contract.Hex(),
+		Symbol:     "TB",
+		Decimals:   defaultTokenDecimals,
+		StartBlock: deployBlock,
+		Enabled:    true,
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return nil, fmt.Errorf("登记模拟代币失败: %v", err)
+	}
+
+	saved, err := eventService.SyncToHead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("同步模拟链事件失败: %v", err)
+	}
+
+	head, err := chain.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	end := time.Unix(int64(head.Time), 0)
+
+	report := &SimulationReport{
+		ChainID:     eventService.chainID,
+		Contract:    contract.Hex(),
+		LatestBlock: head.Number.Uint64(),
+		Events:      saved,
+		StartTime:   start,
+		EndTime:     end,
+	}
+
+	pointsService := NewPointsService(db)
+	for _, account := range chain.Accounts() {
+		chainBalance, err := chain.BalanceOf(ctx, account)
+		if err != nil {
+			return nil, fmt.Errorf("查询 %s 链上余额失败: %v", account.Hex(), err)
+		}
+
+		indexed, err := tokenBalance(db, report.ChainID, contract, account)
+		if err != nil {
+			return nil, fmt.Errorf("查询 %s 入账余额失败: %v", account.Hex(), err)
+		}
+
+		scope := balanceScope{ChainID: report.ChainID, TokenAddress: contract.Hex(), UserAddress: account.Hex()}
+		report.Accounts = append(report.Accounts, SimulationAccount{
+			Address:        account.Hex(),
+			ChainBalance:   chainBalance.String(),
+			IndexedBalance: indexed.String(),
+			Points:         pointsService.calculatePointsFromHistory(scope, start, end),
+			Match:          chainBalance.Cmp(indexed) == 0,
+		})
+	}
+
+	return report, nil
+}
+
+// runSimulationScript 在模拟链上执行一组铸造、转账和销毁，操作之间推进区块时间
+func runSimulationScript(chain *SimulatedChain, start time.Time) error {
+	accounts := chain.Accounts()
+	tokens := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"mint 1000 → A", func() error { return chain.Mint(accounts[0], tokens(1000)) }},
+		{"mint 500 → B", func() error { return chain.Mint(accounts[1], tokens(500)) }},
+		{"wait 12h", func() error { return chain.AdvanceTime(12 * time.Hour) }},
+		{"transfer 200 A → B", func() error { return chain.Transfer(accounts[0], accounts[1], tokens(200)) }},
+		{"wait 6h", func() error { return chain.AdvanceTime(6 * time.Hour) }},
+		{"burn 100 from B", func() error { return chain.Burn(accounts[1], tokens(100)) }},
+		{"mint 300 → C", func() error { return chain.Mint(accounts[2], tokens(300)) }},
+		{"wait 12h", func() error { return chain.AdvanceTime(12 * time.Hour) }},
+		{"transfer 50 C → A", func() error { return chain.Transfer(accounts[2], accounts[0], tokens(50)) }},
+		{"transfer 300 B → C", func() error { return chain.Transfer(accounts[1], accounts[2], tokens(300)) }},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return fmt.Errorf("模拟操作 %s 失败: %v", step.name, err)
+		}
+		middleware.Debug("🧪 模拟操作: %s", step.name)
+	}
+
+	// 推进到当前时间附近，积分按持有时长计算
+	elapsed := 30 * time.Hour
+	if remaining := time.Since(start) - elapsed; remaining > time.Hour {
+		return chain.AdvanceTime(remaining - time.Hour)
+	}
+	return nil
+}
+
+// checkSimulationDatabase 数据库中只能有模拟链的数据
+func checkSimulationDatabase(db *gorm.DB, chainID int64) error {
+	var cursors, tokens int64
+	if err := db.Model(&models.ChainSyncStatus{}).Where("chain_name <> ?", simulatedChainName).Count(&cursors).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.Token{}).Where("chain_id <> ?", chainID).Count(&tokens).Error; err != nil {
+		return err
+	}
+	if cursors > 0 || tokens > 0 {
+		return fmt.Errorf("%w: 存在 %d 条其他链的同步游标和 %d 个其他链的代币", ErrSimulationDatabaseInUse, cursors, tokens)
+	}
+	return nil
+}
+
+// resetSimulatedChain 清除上一次模拟写入的该链数据和代币登记，并把同步游标重置到部署区块
+func resetSimulatedChain(db *gorm.DB, chainID int64, startBlock uint64) error {
+	if _, err := loadSyncCursor(db, simulatedChainName, chainID); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := revertChainData(tx, chainID, 0); err != nil {
+			return err
+		}
+		if err := tx.Where("chain_id = ?", chainID).Delete(&models.Token{}).Error; err != nil {
+			return err
+		}
+		return resetSyncCursor(tx, simulatedChainName, startBlock)
+	})
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// tokenUnits n 个 18 位精度的代币
+func tokenUnits(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func TestSimulatedChainSyncToHead(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	chain, err := NewSimulatedChain(3, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+
+	contract, err := chain.DeployTokenBalance("TokenBalance", "TB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headTime := func() time.Time {
+		header, err := chain.HeaderByNumber(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Unix(int64(header.Time), 0)
+	}
+	deployHeader, err := chain.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := chain.Accounts()
+	a, b, c := accounts[0], accounts[1], accounts[2]
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(chain.Mint(a, tokenUnits(1000)))
+	mintA := headTime()
+	must(chain.Mint(b, tokenUnits(500)))
+	must(chain.AdvanceTime(10 * time.Hour))
+	must(chain.Transfer(a, b, tokenUnits(200)))
+	transfer := headTime()
+	must(chain.AdvanceTime(10 * time.Hour))
+	must(chain.Burn(b, tokenUnits(100)))
+	must(chain.AdvanceTime(10 * time.Hour))
+	chain.Mine(int(defaultConfirmationBlocks))
+	end := headTime()
+
+	eventService, err := NewEventServiceWithBackend(db, chain, simulatedChainName, deployHeader.Number.Uint64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(resetSimulatedChain(db, eventService.chainID, deployHeader.Number.Uint64()))
+	must(db.Create(&models.Token{
+		ChainID:    eventService.chainID,
+		ChainName:  simulatedChainName,
+		Address:    contract.Hex(),
+		Symbol:     "TB",
+		Decimals:   defaultTokenDecimals,
+		StartBlock: deployHeader.Number.Uint64(),
+		Enabled:    true,
+	}).Error)
+
+	if _, err := eventService.SyncToHead(ctx); err != nil {
+		t.Fatalf("SyncToHead: %v", err)
+	}
+
+	// 持仓与链上 balanceOf 一致
+	wantHoldings := map[common.Address]*big.Int{a: tokenUnits(800), b: tokenUnits(600), c: new(big.Int)}
+	for account, want := range wantHoldings {
+		indexed, err := tokenBalance(db, eventService.chainID, contract, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		onChain, err := chain.BalanceOf(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed.Cmp(want) != 0 || onChain.Cmp(want) != 0 {
+			t.Errorf("%s: 入账余额 %s, 链上余额 %s, 期望 %s", account.Hex(), indexed, onChain, want)
+		}
+	}
+
+	// 余额历史按 (区块, 日志索引) 记录每次变动
+	wantHistory := map[common.Address][]struct {
+		changeType string
+		newBalance *big.Int
+	}{
+		a: {{"mint", tokenUnits(1000)}, {"transfer_out", tokenUnits(800)}},
+		b: {{"mint", tokenUnits(500)}, {"transfer_in", tokenUnits(700)}, {"burn", tokenUnits(600)}},
+	}
+	for account, want := range wantHistory {
+		var history []models.UserBalanceHistory
+		err := db.Where("chain_id = ? AND token_address = ? AND user_address = ?", eventService.chainID, contract.Hex(), account.Hex()).
+			Order("block_number, log_index").Find(&history).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != len(want) {
+			t.Fatalf("%s: 余额历史 %d 条, 期望 %d 条", account.Hex(), len(history), len(want))
+		}
+		for i, row := range history {
+			if row.ChangeType != want[i].changeType || row.NewBalance != want[i].newBalance.String() {
+				t.Errorf("%s 第 %d 条: %s → %s, 期望 %s → %s", account.Hex(), i, row.ChangeType, row.NewBalance,
+					want[i].changeType, want[i].newBalance)
+			}
+		}
+	}
+
+	// 积分 = 余额 × 0.05 × 持有小时数
+	scope := balanceScope{ChainID: eventService.chainID, TokenAddress: contract.Hex(), UserAddress: a.Hex()}
+	points := NewPointsService(db).calculatePointsFromHistory(scope, start, end)
+	want := 1000*0.05*transfer.Sub(mintA).Hours() + 800*0.05*end.Sub(transfer).Hours()
+	if math.Abs(points-want) > 1e-6*want {
+		t.Errorf("积分 %.6f, 期望 %.6f", points, want)
+	}
+}
+
+func TestRunSimulation(t *testing.T) {
+	db := openTestDB(t)
+
+	report, err := RunSimulation(context.Background(), db)
+	if err != nil {
+		t.Fatalf("RunSimulation: %v", err)
+	}
+	for _, account := range report.Accounts {
+		if !account.Match {
+			t.Errorf("%s: 入账余额 %s, 链上余额 %s", account.Address, account.IndexedBalance, account.ChainBalance)
+		}
+		if account.ChainBalance != "0" && account.Points <= 0 {
+			t.Errorf("%s: 持有余额但没有积分", account.Address)
+		}
+	}
+
+	// 再次运行会清除上一次模拟的数据，结果不变
+	if _, err := RunSimulation(context.Background(), db); err != nil {
+		t.Fatalf("第二次 RunSimulation: %v", err)
+	}
+}
+
+func TestRunSimulationRefusesSharedDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.Create(&models.ChainSyncStatus{ChainName: "sepolia", ChainID: 11155111}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := RunSimulation(context.Background(), db)
+	if !errors.Is(err, ErrSimulationDatabaseInUse) {
+		t.Fatalf("期望 ErrSimulationDatabaseInUse, 得到 %v", err)
+	}
+}
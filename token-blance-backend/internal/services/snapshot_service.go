@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSnapshot 快照参数无效
+var ErrInvalidSnapshot = errors.New("无效的快照参数")
+
+// SnapshotService 历史余额快照服务
+type SnapshotService struct {
+	db *gorm.DB
+}
+
+// NewSnapshotService 创建历史余额快照服务
+func NewSnapshotService(db *gorm.DB) *SnapshotService {
+	return &SnapshotService{db: db}
+}
+
+// SnapshotOptions 快照参数，BlockNumber 和 Timestamp 二选一
+type SnapshotOptions struct {
+	Chain       string     `json:"chain"`        // 链名称，按区块号快照时必填
+	Token       string     `json:"token"`        // 代币合约地址，为空时包含所有代币
+	BlockNumber uint64     `json:"block_number"` // 该区块结束时的余额
+	Timestamp   *time.Time `json:"timestamp"`    // 该时间点的余额 (区块时间戳不晚于它)
+	MinBalance  string     `json:"min_balance"`  // 最低余额，按代币精度换算后的数量，例如 "100"；为空时只排除零余额
+}
+
+// SnapshotEntry 一个持有人在快照时的余额
+type SnapshotEntry struct {
+	ChainID          int64  `json:"chain_id"`
+	TokenAddress     string `json:"token_address"`
+	Symbol           string `json:"symbol"`
+	UserAddress      string `json:"user_address"`
+	Balance          string `json:"balance"`           // 最小单位
+	BalanceFormatted string `json:"balance_formatted"` // 按代币精度换算后的数量
+	BlockNumber      uint64 `json:"block_number"`      // 快照之前最后一次余额变动所在区块
+}
+
+// Snapshot 已校验参数的快照，调用 Each 逐条读取
+type Snapshot struct {
+	db      *gorm.DB
+	opts    SnapshotOptions
+	chainID int64
+	tokens  map[string]models.Token
+	minimum map[string]*big.Int // 每个代币按精度换算后的最低余额 (最小单位)
+	minText decimal.Decimal
+}
+
+// PrepareSnapshot 校验快照参数
+//
+// 区块号只在一条链内有意义，按区块号快照时必须指定链；区块或时间点不能晚于该链已同步的位置，
+// 否则之后的余额变动尚未入账，快照不完整。
+func (ss *SnapshotService) PrepareSnapshot(opts SnapshotOptions) (*Snapshot, error) {
+	if (opts.BlockNumber == 0) == (opts.Timestamp == nil) {
+		return nil, fmt.Errorf("%w: block 和 timestamp 必须且只能指定一个", ErrInvalidSnapshot)
+	}
+	if opts.BlockNumber > 0 && opts.Chain == "" {
+		return nil, fmt.Errorf("%w: 按区块号快照时必须指定 chain", ErrInvalidSnapshot)
+	}
+	if opts.Token != "" {
+		if !common.IsHexAddress(opts.Token) {
+			return nil, fmt.Errorf("%w: 无效的代币地址 %s", ErrInvalidSnapshot, opts.Token)
+		}
+		opts.Token = common.HexToAddress(opts.Token).Hex()
+	}
+
+	snapshot := &Snapshot{db: ss.db, opts: opts, tokens: make(map[string]models.Token), minimum: make(map[string]*big.Int)}
+	if opts.MinBalance != "" {
+		minimum, err := decimal.NewFromString(opts.MinBalance)
+		if err != nil || minimum.IsNegative() {
+			return nil, fmt.Errorf("%w: 无效的最低余额 %s", ErrInvalidSnapshot, opts.MinBalance)
+		}
+		snapshot.minText = minimum
+	}
+
+	var cursors []models.ChainSyncStatus
+	query := ss.db.Model(&models.ChainSyncStatus{})
+	if opts.Chain != "" {
+		query = query.Where("chain_name = ?", opts.Chain)
+	}
+	if err := query.Find(&cursors).Error; err != nil {
+		return nil, err
+	}
+	if opts.Chain != "" {
+		if len(cursors) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrChainNotFound, opts.Chain)
+		}
+		snapshot.chainID = cursors[0].ChainID
+	}
+	for _, cursor := range cursors {
+		if err := checkSnapshotSynced(ss.db, cursor, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var tokens []models.Token
+	if err := ss.db.Select("chain_id, address, symbol, decimals").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		snapshot.tokens[tokenKey(token.ChainID, token.Address)] = token
+	}
+	return snapshot, nil
+}
+
+// checkSnapshotSynced 快照的区块或时间点是否已经同步
+//
+// 按时间点快照时需要游标所在区块的时间戳，无法取得时拒绝生成快照，而不是假定已经同步。
+func checkSnapshotSynced(db *gorm.DB, cursor models.ChainSyncStatus, opts SnapshotOptions) error {
+	if opts.BlockNumber > 0 {
+		if opts.BlockNumber > cursor.LastBlock {
+			return fmt.Errorf("%w: %s 只同步到区块 %d，无法生成区块 %d 的快照",
+				ErrInvalidSnapshot, cursor.ChainName, cursor.LastBlock, opts.BlockNumber)
+		}
+		return nil
+	}
+
+	blockTime, err := cursorBlockTime(db, cursor)
+	if err != nil {
+		return fmt.Errorf("无法确认 %s 区块 %d 的时间，不能生成 %s 的快照: %v",
+			cursor.ChainName, cursor.LastBlock, opts.Timestamp.Format(time.RFC3339), err)
+	}
+	if opts.Timestamp.After(blockTime) {
+		return fmt.Errorf("%w: %s 只同步到 %s (区块 %d)，无法生成 %s 的快照", ErrInvalidSnapshot, cursor.ChainName,
+			blockTime.Format(time.RFC3339), cursor.LastBlock, opts.Timestamp.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// cursorBlockTime 同步游标所在区块的链上时间戳
+//
+// 优先使用 chain_blocks 中缓存的时间戳，未缓存时连接该链的 RPC 获取区块头。
+func cursorBlockTime(db *gorm.DB, cursor models.ChainSyncStatus) (time.Time, error) {
+	var block models.ChainBlock
+	err := db.Where("chain_id = ? AND block_number = ?", cursor.ChainID, cursor.LastBlock).First(&block).Error
+	if err == nil && block.BlockTime != nil {
+		return *block.BlockTime, nil
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return time.Time{}, err
+	}
+
+	definition, err := getChainDefinition(db, cursor.ChainName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	client, err := DialRPCPool(definition.Name, definition.RPCURLs, definition.ChainID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(cursor.LastBlock))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("获取区块 %d 失败: %v", cursor.LastBlock, err)
+	}
+	return headerTime(header), nil
+}
+
+// Each 按 (链, 代币, 地址) 顺序逐条返回快照中余额不低于最低余额的持有人
+//
+// 按顺序扫描余额历史，每个 (链, 代币, 地址) 取快照之前的最后一条记录，不会把整个结果读入内存。
+// emit 返回错误时停止读取。
+func (s *Snapshot) Each(emit func(SnapshotEntry) error) error {
+	query := s.db.Model(&models.UserBalanceHistory{}).
+		Select("chain_id, token_address, user_address, new_balance, block_number")
+	if s.chainID != 0 {
+		query = query.Where("chain_id = ?", s.chainID)
+	}
+	if s.opts.Token != "" {
+		query = query.Where("token_address = ?", s.opts.Token)
+	}
+	if s.opts.BlockNumber > 0 {
+		query = query.Where("block_number <= ?", s.opts.BlockNumber)
+	} else {
+		query = query.Where("timestamp <= ?", *s.opts.Timestamp)
+	}
+
+	rows, err := query.Order("chain_id, token_address, user_address, block_number, log_index, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current *SnapshotEntry
+	for rows.Next() {
+		var entry SnapshotEntry
+		if err := rows.Scan(&entry.ChainID, &entry.TokenAddress, &entry.UserAddress, &entry.Balance, &entry.BlockNumber); err != nil {
+			return err
+		}
+		if current != nil && (current.ChainID != entry.ChainID || current.TokenAddress != entry.TokenAddress || current.UserAddress != entry.UserAddress) {
+			if err := s.emit(*current, emit); err != nil {
+				return err
+			}
+		}
+		current = &entry
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		return s.emit(*current, emit)
+	}
+	return nil
+}
+
+// emit 过滤掉低于最低余额的持有人，填写代币符号和可读余额
+func (s *Snapshot) emit(entry SnapshotEntry, emit func(SnapshotEntry) error) error {
+	balance, ok := new(big.Int).SetString(entry.Balance, 10)
+	if !ok {
+		return fmt.Errorf("无效的历史余额: %s (%s)", entry.Balance, entry.UserAddress)
+	}
+	if balance.Sign() <= 0 || balance.Cmp(s.minimumOf(entry.ChainID, entry.TokenAddress)) < 0 {
+		return nil
+	}
+
+	token, ok := s.tokens[tokenKey(entry.ChainID, entry.TokenAddress)]
+	decimals := defaultTokenDecimals
+	if ok {
+		entry.Symbol = token.Symbol
+		decimals = token.Decimals
+	}
+	entry.BalanceFormatted = formatTokenAmount(entry.Balance, decimals)
+	return emit(entry)
+}
+
+// minimumOf 代币的最低余额 (最小单位)
+func (s *Snapshot) minimumOf(chainID int64, address string) *big.Int {
+	key := tokenKey(chainID, address)
+	if minimum, ok := s.minimum[key]; ok {
+		return minimum
+	}
+	decimals := defaultTokenDecimals
+	if token, ok := s.tokens[key]; ok {
+		decimals = token.Decimals
+	}
+	minimum := s.minText.Shift(int32(decimals)).Ceil().BigInt()
+	s.minimum[key] = minimum
+	return minimum
+}
+
+// ParseSnapshotTime 解析快照时间点：RFC3339 或 Unix 秒
+func ParseSnapshotTime(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(seconds, 0)
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 时间格式应为 RFC3339 或 Unix 秒: %s", ErrInvalidSnapshot, value)
+	}
+	return &t, nil
+}
+
+// SnapshotCSVHeader 快照 CSV 的表头
+var SnapshotCSVHeader = []string{"chain_id", "token_address", "symbol", "user_address", "balance", "balance_formatted", "block_number"}
+
+// CSVRecord 快照条目的 CSV 行，列顺序与 SnapshotCSVHeader 一致
+func (e SnapshotEntry) CSVRecord() []string {
+	return []string{
+		strconv.FormatInt(e.ChainID, 10),
+		e.TokenAddress,
+		e.Symbol,
+		e.UserAddress,
+		e.Balance,
+		e.BalanceFormatted,
+		strconv.FormatUint(e.BlockNumber, 10),
+	}
+}
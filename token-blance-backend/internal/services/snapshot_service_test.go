@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCheckSnapshotSynced(t *testing.T) {
+	db := openTestDB(t)
+	synced := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	if err := db.Create(&models.ChainBlock{ChainID: 1, BlockNumber: 100, BlockHash: "0x01", BlockTime: &synced}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.ChainBlock{ChainID: 2, BlockNumber: 200, BlockHash: "0x02"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	cached := models.ChainSyncStatus{ChainName: "cached", ChainID: 1, LastBlock: 100}
+	uncached := models.ChainSyncStatus{ChainName: "uncached", ChainID: 2, LastBlock: 200}
+	before, after := synced.Add(-time.Minute), synced.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		cursor  models.ChainSyncStatus
+		opts    SnapshotOptions
+		invalid bool // 返回 ErrInvalidSnapshot
+		fails   bool // 返回其他错误
+	}{
+		{name: "block synced", cursor: cached, opts: SnapshotOptions{BlockNumber: 100}},
+		{name: "block ahead of cursor", cursor: cached, opts: SnapshotOptions{BlockNumber: 101}, invalid: true},
+		{name: "time synced", cursor: cached, opts: SnapshotOptions{Timestamp: &before}},
+		{name: "time at cursor", cursor: cached, opts: SnapshotOptions{Timestamp: &synced}},
+		{name: "time ahead of cursor", cursor: cached, opts: SnapshotOptions{Timestamp: &after}, invalid: true},
+		// 游标区块没有缓存时间戳，也没有可以查询的链定义
+		{name: "time unknown", cursor: uncached, opts: SnapshotOptions{Timestamp: &before}, fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSnapshotSynced(db, tt.cursor, tt.opts)
+			switch {
+			case tt.invalid:
+				if !errors.Is(err, ErrInvalidSnapshot) {
+					t.Fatalf("err = %v, want ErrInvalidSnapshot", err)
+				}
+			case tt.fails:
+				if err == nil || errors.Is(err, ErrInvalidSnapshot) {
+					t.Fatalf("err = %v, want a lookup error", err)
+				}
+			case err != nil:
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestSnapshotEach(t *testing.T) {
+	db := openTestDB(t)
+	tokenA := common.HexToAddress("0x00000000000000000000000000000000000000aa").Hex()
+	tokenB := common.HexToAddress("0x00000000000000000000000000000000000000bb").Hex()
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001").Hex()
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002").Hex()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+
+	history := func(chainID int64, token, user string, block uint64, logIndex uint, balance string) models.UserBalanceHistory {
+		return models.UserBalanceHistory{
+			ChainID: chainID, TokenAddress: token, UserAddress: user, BlockNumber: block, LogIndex: logIndex,
+			Timestamp: start.Add(time.Duration(block) * time.Minute), TxHash: fmt.Sprintf("0x%x", block),
+			ChangeType: "transfer_in", OldBalance: "0", NewBalance: balance, ChangeAmount: "0",
+		}
+	}
+	rows := []interface{}{
+		&[]models.User{{ID: alice}, {ID: bob}},
+		&[]models.Token{
+			{ChainID: 1, ChainName: "one", Address: tokenA, Symbol: "AAA", Decimals: 2},
+			{ChainID: 1, ChainName: "one", Address: tokenB, Symbol: "BBB", Decimals: 0},
+		},
+		&[]models.ChainSyncStatus{{ChainName: "one", ChainID: 1, LastBlock: 100}, {ChainName: "two", ChainID: 2, LastBlock: 100}},
+		&[]models.ChainBlock{
+			{ChainID: 1, BlockNumber: 100, BlockHash: "0x01", BlockTime: timePtr(start.Add(100 * time.Minute))},
+			{ChainID: 2, BlockNumber: 100, BlockHash: "0x02", BlockTime: timePtr(start.Add(100 * time.Minute))},
+		},
+		&[]models.UserBalanceHistory{
+			history(1, tokenA, alice, 10, 0, "1000"),
+			history(1, tokenA, alice, 20, 1, "500"),
+			history(1, tokenA, alice, 20, 0, "700"), // 同一区块内按日志索引排序
+			history(1, tokenA, alice, 50, 0, "0"),
+			history(1, tokenA, bob, 30, 0, "250"),
+			history(1, tokenB, alice, 15, 0, "9"),
+			history(2, tokenA, alice, 25, 0, "42"),
+		},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := start.Add(40 * time.Minute)
+	tests := []struct {
+		name string
+		opts SnapshotOptions
+		want []string // chain/token/user=balance
+	}{
+		{
+			name: "block on one chain",
+			opts: SnapshotOptions{Chain: "one", BlockNumber: 40},
+			want: []string{"1/AAA/alice=500", "1/AAA/bob=250", "1/BBB/alice=9"},
+		},
+		{
+			name: "zero balance excluded",
+			opts: SnapshotOptions{Chain: "one", BlockNumber: 60},
+			want: []string{"1/AAA/bob=250", "1/BBB/alice=9"},
+		},
+		{
+			name: "timestamp across chains",
+			opts: SnapshotOptions{Timestamp: &at},
+			want: []string{"1/AAA/alice=500", "1/AAA/bob=250", "1/BBB/alice=9", "2/AAA/alice=42"},
+		},
+		{
+			name: "token and minimum balance",
+			opts: SnapshotOptions{Chain: "one", Token: tokenA, BlockNumber: 40, MinBalance: "3"},
+			want: []string{"1/AAA/alice=500"},
+		},
+	}
+
+	names := map[string]string{alice: "alice", bob: "bob", tokenA: "AAA", tokenB: "BBB"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := NewSnapshotService(db).PrepareSnapshot(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err = snapshot.Each(func(entry SnapshotEntry) error {
+				got = append(got, fmt.Sprintf("%d/%s/%s=%s", entry.ChainID, names[entry.TokenAddress], names[entry.UserAddress], entry.Balance))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"math"
 	"math/rand"
 	"time"
 	"token-balance/internal/models"
@@ -30,8 +31,13 @@ func (ss *StatsService) GetOverview() (*StatsOverview, error) {
 	ss.db.Model(&models.User{}).Count(&totalUsers)
 	overview.TotalUsers = uint(totalUsers)
 
-	// 获取总供应量（这里应该是合约的总供应量）
-	ss.db.Model(&models.User{}).Select("COALESCE(SUM(balance), 0)").Row().Scan(&overview.TotalSupply)
+	// 获取每个代币的供应量：余额是 varchar 保存的大整数，按代币精确累加持仓余额，不同代币不相加
+	// (链上 totalSupply 与余额之和的核对见 ReconciliationService.CheckSupply)
+	tokens, err := ss.tokenSupplies()
+	if err != nil {
+		return nil, err
+	}
+	overview.Tokens = tokens
 
 	// 获取总积分
 	ss.db.Model(&models.PointsRecord{}).Select("COALESCE(SUM(points), 0)").Row().Scan(&overview.TotalPoints)
@@ -55,6 +61,49 @@ func (ss *StatsService) GetOverview() (*StatsOverview, error) {
 	return &overview, nil
 }
 
+// tokenSupplies 每个 (链, 代币) 的持有人余额之和 (最小单位)
+func (ss *StatsService) tokenSupplies() ([]TokenSupply, error) {
+	var scopes []struct {
+		ChainID      int64
+		TokenAddress string
+	}
+	err := ss.db.Model(&models.Holding{}).
+		Distinct("chain_id", "token_address").
+		Order("chain_id asc, token_address asc").
+		Scan(&scopes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var registered []models.Token
+	if err := ss.db.Select("chain_id, address, symbol, decimals").Find(&registered).Error; err != nil {
+		return nil, err
+	}
+	symbols := make(map[string]string, len(registered))
+	decimals := make(tokenDecimals, len(registered))
+	for _, token := range registered {
+		symbols[tokenKey(token.ChainID, token.Address)] = token.Symbol
+		decimals[tokenKey(token.ChainID, token.Address)] = token.Decimals
+	}
+
+	supplies := make([]TokenSupply, 0, len(scopes))
+	for _, scope := range scopes {
+		holderSum, holders, err := holderSupplyAt(ss.db, scope.ChainID, scope.TokenAddress, math.MaxUint64)
+		if err != nil {
+			return nil, err
+		}
+		supplies = append(supplies, TokenSupply{
+			ChainID:            scope.ChainID,
+			Token:              scope.TokenAddress,
+			Symbol:             symbols[tokenKey(scope.ChainID, scope.TokenAddress)],
+			HolderSum:          holderSum.String(),
+			HolderSumFormatted: formatTokenAmount(holderSum.String(), decimals.of(scope.ChainID, scope.TokenAddress)),
+			Holders:            holders,
+		})
+	}
+	return supplies, nil
+}
+
 // GetDailyStats 获取每日统计
 func (ss *StatsService) GetDailyStats(daysStr string) ([]models.DailyStats, error) {
 	days := StringToInt(daysStr)
@@ -78,10 +127,20 @@ func (ss *StatsService) GetDailyStats(daysStr string) ([]models.DailyStats, erro
 
 // StatsOverview 系统统计概览
 type StatsOverview struct {
-	TotalUsers        uint    `json:"total_users"`
-	TotalSupply       string  `json:"total_supply"`
-	TotalPoints       float64 `json:"total_points"`
-	ActiveUsers24h    uint    `json:"active_users_24h"`
-	Transactions24h   uint    `json:"transactions_24h"`
-	TotalTransactions uint    `json:"total_transactions"`
+	TotalUsers        uint          `json:"total_users"`
+	Tokens            []TokenSupply `json:"tokens"` // 每个代币的持仓余额之和，不同代币的供应量不相加
+	TotalPoints       float64       `json:"total_points"`
+	ActiveUsers24h    uint          `json:"active_users_24h"`
+	Transactions24h   uint          `json:"transactions_24h"`
+	TotalTransactions uint          `json:"total_transactions"`
+}
+
+// TokenSupply 一个代币的持有人余额之和
+type TokenSupply struct {
+	ChainID            int64  `json:"chain_id"`
+	Token              string `json:"token"`
+	Symbol             string `json:"symbol"`
+	HolderSum          string `json:"holder_sum"`           // 最小单位
+	HolderSumFormatted string `json:"holder_sum_formatted"` // 按代币精度换算
+	Holders            int    `json:"holders"`              // 余额大于0的持有人数
 }
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+const (
+	// supplyMismatchIssue 链上 totalSupply 与持有人余额之和不一致
+	supplyMismatchIssue = "supply_mismatch"
+	// supplyExceedsMaxIssue 链上 totalSupply 超过合约的 MAX_SUPPLY
+	supplyExceedsMaxIssue = "supply_exceeds_max"
+)
+
+// SupplyCheck 一个代币在固定区块上的供应量核对结果
+//
+// 不变量：totalSupply() == 所有持有人余额之和，且 totalSupply() <= MAX_SUPPLY。
+type SupplyCheck struct {
+	ChainName   string    `json:"chain_name"`
+	ChainID     int64     `json:"chain_id"`
+	Token       string    `json:"token"`
+	Symbol      string    `json:"symbol"`
+	BlockNumber uint64    `json:"block_number"`         // 核对所在的区块 (同步游标)
+	TotalSupply string    `json:"total_supply"`         // 链上 totalSupply()
+	MaxSupply   string    `json:"max_supply,omitempty"` // 链上 MAX_SUPPLY()，合约没有该常量时为空
+	HolderSum   string    `json:"holder_sum"`           // 索引得到的持有人余额之和
+	Difference  string    `json:"difference"`           // total_supply - holder_sum
+	Holders     int       `json:"holders"`              // 余额大于0的持有人数
+	Consistent  bool      `json:"consistent"`
+	Error       string    `json:"error,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// CheckSupply 在每条链的同步游标所在区块核对代币的供应量不变量
+//
+// 不变量被破坏时记录 critical 级别的一致性问题并发送告警，同一问题未处理期间
+// 只在差额变化时再次告警；恢复一致后自动关闭问题。chain 为空时核对所有已启用的链。
+func (rs *ReconciliationService) CheckSupply(ctx context.Context, chain string) ([]SupplyCheck, error) {
+	if !rs.supplyRunning.TryLock() {
+		return nil, ErrReconciliationRunning
+	}
+	defer rs.supplyRunning.Unlock()
+
+	chains, names, err := rs.selectChains(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []SupplyCheck{}
+	for _, name := range names {
+		chainChecks := rs.checkChainSupply(ctx, name, chains[name])
+		checks = append(checks, chainChecks...)
+
+		rs.mu.Lock()
+		for _, check := range chainChecks {
+			if check.Token != "" {
+				rs.supplyChecks[tokenKey(check.ChainID, check.Token)] = check
+			}
+		}
+		rs.mu.Unlock()
+	}
+	return checks, nil
+}
+
+// LastSupplyChecks 每个代币最近一次的供应量核对结果
+func (rs *ReconciliationService) LastSupplyChecks() []SupplyCheck {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	checks := make([]SupplyCheck, 0, len(rs.supplyChecks))
+	for _, check := range rs.supplyChecks {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].ChainID != checks[j].ChainID {
+			return checks[i].ChainID < checks[j].ChainID
+		}
+		return checks[i].Token < checks[j].Token
+	})
+	return checks
+}
+
+// checkChainSupply 核对一条链上所有已启用代币的供应量
+func (rs *ReconciliationService) checkChainSupply(ctx context.Context, name string, chain config.ChainConfig) []SupplyCheck {
+	target, err := rs.openCheckTarget(ctx, name, chain)
+	if err != nil {
+		middleware.Error("%s 供应量核对失败: %v", name, err)
+		failed := SupplyCheck{ChainName: name, ChainID: chain.ChainID, Error: err.Error(), CheckedAt: time.Now()}
+		if target != nil {
+			failed.BlockNumber = target.BlockNumber
+		}
+		return []SupplyCheck{failed}
+	}
+	if target.Client == nil {
+		return nil
+	}
+	defer target.Client.Close()
+
+	checks := make([]SupplyCheck, 0, len(target.Tokens))
+	for _, token := range target.Tokens {
+		check := rs.checkTokenSupply(ctx, name, target, token)
+		if check.Error != "" {
+			middleware.Error("%s 代币 %s 供应量核对失败: %s", name, check.Token, check.Error)
+		} else if check.Consistent {
+			middleware.Info("✅ %s 代币 %s 供应量一致 (区块 %d): totalSupply=%s, 持有人 %d 个",
+				name, check.Token, check.BlockNumber, check.TotalSupply, check.Holders)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkTokenSupply 读取代币在核对区块的 totalSupply() 和 MAX_SUPPLY()，与持有人余额之和比较
+func (rs *ReconciliationService) checkTokenSupply(ctx context.Context, chainName string, target *checkTarget, token models.Token) SupplyCheck {
+	address := common.HexToAddress(token.Address)
+	check := SupplyCheck{
+		ChainName:   chainName,
+		ChainID:     token.ChainID,
+		Token:       address.Hex(),
+		Symbol:      token.Symbol,
+		BlockNumber: target.BlockNumber,
+		CheckedAt:   time.Now(),
+	}
+
+	totalSupply, err := callTokenUintAt(ctx, target.Client, target.TokenABI, address, target.BlockNumber, "totalSupply")
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.TotalSupply = totalSupply.String()
+
+	// MAX_SUPPLY 只有 TokenBalance 合约提供，其他 ERC20 代币只检查余额之和
+	maxSupply, err := callTokenUintAt(ctx, target.Client, target.TokenABI, address, target.BlockNumber, "MAX_SUPPLY")
+	if err != nil {
+		middleware.Debug("代币 %s 不支持 MAX_SUPPLY(): %v", check.Token, err)
+	} else {
+		check.MaxSupply = maxSupply.String()
+	}
+
+	holderSum, holders, err := holderSupplyAt(rs.db, token.ChainID, check.Token, target.BlockNumber)
+	if err != nil {
+		check.Error = fmt.Sprintf("汇总持有人余额失败: %v", err)
+		return check
+	}
+	check.HolderSum = holderSum.String()
+	check.Holders = holders
+
+	difference := new(big.Int).Sub(totalSupply, holderSum)
+	check.Difference = difference.String()
+	exceedsMax := maxSupply != nil && totalSupply.Cmp(maxSupply) > 0
+	check.Consistent = difference.Sign() == 0 && !exceedsMax
+
+	rs.recordSupplyIssue(ctx, supplyMismatchIssue, difference.Sign() != 0, check,
+		fmt.Sprintf("代币 %s (链 %s) 在区块 %d 的 totalSupply 与持有人余额之和不符: totalSupply=%s, 余额之和=%s, 差额=%s",
+			check.Token, chainName, check.BlockNumber, check.TotalSupply, check.HolderSum, check.Difference))
+	rs.recordSupplyIssue(ctx, supplyExceedsMaxIssue, exceedsMax, check,
+		fmt.Sprintf("代币 %s (链 %s) 在区块 %d 的 totalSupply 超过 MAX_SUPPLY: totalSupply=%s, MAX_SUPPLY=%s",
+			check.Token, chainName, check.BlockNumber, check.TotalSupply, check.MaxSupply))
+	return check
+}
+
+// recordSupplyIssue 记录或关闭代币级别的供应量问题
+//
+// broken 为 true 时新建或更新 critical 问题，新问题或差额变化时发送告警；
+// 为 false 时关闭之前未处理的同类问题。
+func (rs *ReconciliationService) recordSupplyIssue(ctx context.Context, issueType string, broken bool, check SupplyCheck, description string) {
+	existing, err := findOpenIssue(rs.db, issueType, "", check.ChainID, check.Token)
+	if err != nil {
+		middleware.Error("查询供应量问题失败: %v", err)
+		return
+	}
+
+	if !broken {
+		if existing != nil {
+			now := time.Now()
+			rs.db.Model(existing).Updates(map[string]interface{}{"status": "fixed", "resolved_at": now})
+			middleware.Info("✅ 问题 %d 已恢复: 代币 %s 在区块 %d 的供应量一致", existing.ID, check.Token, check.BlockNumber)
+		}
+		return
+	}
+
+	issue := existing
+	if issue == nil {
+		issue = &models.ConsistencyIssue{
+			Type:     issueType,
+			Severity: "critical",
+			Status:   "open",
+		}
+	}
+	changed := existing == nil || existing.Data["difference"] != check.Difference
+	issue.Description = description
+	issue.Data = map[string]interface{}{
+		"chain_id":     check.ChainID,
+		"chain_name":   check.ChainName,
+		"token":        check.Token,
+		"symbol":       check.Symbol,
+		"block_number": check.BlockNumber,
+		"total_supply": check.TotalSupply,
+		"max_supply":   check.MaxSupply,
+		"holder_sum":   check.HolderSum,
+		"difference":   check.Difference,
+	}
+	if err := rs.db.Save(issue).Error; err != nil {
+		middleware.Error("记录供应量问题失败: %v", err)
+	}
+
+	if changed {
+		sendAlert(ctx, rs.cfg.Alert.WebhookURL, Alert{
+			Severity: "critical",
+			Title:    "代币供应量不变量被破坏",
+			Message:  description,
+			Data:     issue.Data,
+		})
+	} else {
+		middleware.Warn("⚠️ 问题 %d 仍未处理: %s", issue.ID, description)
+	}
+}
+
+// holderSupplyAt 代币在区块 blockNumber 结束时所有持有人的余额之和 (精确的大整数运算)
+//
+// 持仓在该区块之后有变动时从余额历史取该区块的余额。返回余额之和及余额大于0的持有人数。
+func holderSupplyAt(db *gorm.DB, chainID int64, token string, blockNumber uint64) (*big.Int, int, error) {
+	rows, err := db.Model(&models.Holding{}).
+		Select("user_address, balance, block_number").
+		Where("chain_id = ? AND token_address = ?", chainID, token).
+		Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := new(big.Int)
+	holders := 0
+	var changedLater []string
+	for rows.Next() {
+		var address, value string
+		var holdingBlock uint64
+		if err := rows.Scan(&address, &value, &holdingBlock); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if holdingBlock > blockNumber {
+			changedLater = append(changedLater, address)
+			continue
+		}
+		balance, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			rows.Close()
+			return nil, 0, fmt.Errorf("无效的持仓余额: %s (%s)", value, address)
+		}
+		if balance.Sign() > 0 {
+			holders++
+		}
+		total.Add(total, balance)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, address := range changedLater {
+		balance, err := historyBalanceAt(db, chainID, token, address, blockNumber)
+		if err != nil {
+			return nil, 0, err
+		}
+		if balance.Sign() > 0 {
+			holders++
+		}
+		total.Add(total, balance)
+	}
+	return total, holders, nil
+}
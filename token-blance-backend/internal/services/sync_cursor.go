@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"token-balance/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errSyncCursorMoved 同步游标已被其他监听者推进（本次处理结果需要回滚）
+var errSyncCursorMoved = errors.New("同步游标已被其他监听者推进")
+
+// loadSyncCursor 读取链同步游标，不存在时创建
+//
+// 游标记录最后一个完整处理的区块，重启后从 LastBlock+1 继续同步，
+// 不会再跳过停机期间的区块。
+func loadSyncCursor(db *gorm.DB, chainName string, chainID int64) (*models.ChainSyncStatus, error) {
+	status := models.ChainSyncStatus{
+		ChainName: chainName,
+		ChainID:   chainID,
+		Status:    "syncing",
+	}
+	err := db.Where("chain_name = ?", chainName).
+		Attrs(status).
+		FirstOrCreate(&status).Error
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// lockSyncCursor 在事务开始时锁定链的同步游标，游标不存在时不加锁
+//
+// 写入余额历史和持仓的事务 (同步、链重组回滚、重置回填) 都先锁定游标，
+// 与回放交换 (先锁定所有游标再替换线上表) 的加锁顺序一致，避免互相死锁。
+func lockSyncCursor(tx *gorm.DB, chainName string) error {
+	var cursors []models.ChainSyncStatus
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("chain_name = ?", chainName).
+		Find(&cursors).Error
+}
+
+// advanceSyncCursor 在同一个数据库事务中推进同步游标
+//
+// 使用 last_block 作为乐观锁：如果游标已被其他监听者推进（例如单链服务与
+// 多链服务同时监听同一条链），返回 errSyncCursorMoved，调用方应回滚整个事务，
+// 避免同一区块范围的事件被重复入账。首次推进时同时记录起始区块。
+func advanceSyncCursor(tx *gorm.DB, cursor *models.ChainSyncStatus, fromBlock, toBlock, latestBlock uint64) error {
+	var blockDelay uint64
+	if latestBlock > toBlock {
+		blockDelay = latestBlock - toBlock
+	}
+
+	updates := map[string]interface{}{
+		"last_block":   toBlock,
+		"latest_block": latestBlock,
+		"block_delay":  blockDelay,
+		"status":       "syncing",
+	}
+	if cursor.StartBlock == 0 {
+		updates["start_block"] = fromBlock
+	}
+
+	result := tx.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ? AND last_block = ?", cursor.ChainName, cursor.LastBlock).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSyncCursorMoved
+	}
+	return nil
+}
+
+// updateLatestBlock 仅更新链上最新高度（没有新的安全区块需要处理时使用）
+func updateLatestBlock(db *gorm.DB, chainName string, lastBlock, latestBlock uint64) error {
+	var blockDelay uint64
+	if latestBlock > lastBlock {
+		blockDelay = latestBlock - lastBlock
+	}
+
+	return db.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ?", chainName).
+		Updates(map[string]interface{}{
+			"latest_block": latestBlock,
+			"block_delay":  blockDelay,
+		}).Error
+}
+
+// nextSyncRange 根据游标计算本次需要处理的区块范围 [from, to]
+//
+// 游标落后于起始区块（合约部署区块）时从起始区块开始；未配置起始区块且从未同步过时
+// 沿用原有行为，从安全高度往前 maxBlockRange 个区块开始。
+// 返回 ok=false 表示当前没有新的安全区块需要处理。
+func nextSyncRange(lastBlock, startBlock, safeLatestBlock, maxBlockRange uint64) (from, to uint64, ok bool) {
+	switch {
+	case lastBlock == 0 && startBlock == 0:
+		from = 1
+		if safeLatestBlock > maxBlockRange {
+			from = safeLatestBlock - maxBlockRange
+		}
+	case lastBlock < startBlock:
+		from = startBlock
+	default:
+		from = lastBlock + 1
+	}
+
+	if from > safeLatestBlock {
+		return 0, 0, false
+	}
+
+	to = safeLatestBlock
+	if to-from+1 > maxBlockRange {
+		to = from + maxBlockRange - 1
+	}
+	return from, to, true
+}
+
+// rewindSyncCursor 链重组回滚时回退同步游标
+func rewindSyncCursor(tx *gorm.DB, chainName string, lastBlock, toBlock uint64) error {
+	result := tx.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ? AND last_block = ?", chainName, lastBlock).
+		Update("last_block", toBlock)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSyncCursorMoved
+	}
+	return nil
+}
+
+// resetSyncCursor 将游标重置到 startBlock 之前，重新从 startBlock 开始同步
+func resetSyncCursor(tx *gorm.DB, chainName string, startBlock uint64) error {
+	lastBlock := uint64(0)
+	if startBlock > 0 {
+		lastBlock = startBlock - 1
+	}
+
+	return tx.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ?", chainName).
+		Updates(map[string]interface{}{
+			"start_block": startBlock,
+			"last_block":  lastBlock,
+			"status":      "syncing",
+		}).Error
+}
+
+// recordSyncError 记录同步失败：错误信息、时间和连续失败次数
+//
+// RPC 错误带有分类前缀（见 RPCError），熔断器打开时状态记为 circuit_open。
+func recordSyncError(db *gorm.DB, chainName string, syncErr error) error {
+	status := "error"
+	var rpcErr *RPCError
+	if errors.As(syncErr, &rpcErr) && rpcErr.Kind == rpcErrorCircuitOpen {
+		status = "circuit_open"
+	}
+
+	return db.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ?", chainName).
+		Updates(map[string]interface{}{
+			"last_error":         syncErr.Error(),
+			"last_error_time":    time.Now(),
+			"consecutive_errors": gorm.Expr("consecutive_errors + 1"),
+			"status":             status,
+		}).Error
+}
+
+// clearSyncError 同步成功后记录成功时间并清零连续失败次数（保留最后一次错误信息供排查）
+func clearSyncError(db *gorm.DB, chainName string) error {
+	return db.Model(&models.ChainSyncStatus{}).
+		Where("chain_name = ?", chainName).
+		Updates(map[string]interface{}{
+			"consecutive_errors": 0,
+			"status":             "syncing",
+			"last_success_time":  time.Now(),
+		}).Error
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestNextSyncRange(t *testing.T) {
+	tests := []struct {
+		name                             string
+		lastBlock, startBlock, safe, max uint64
+		wantFrom, wantTo                 uint64
+		wantOK                           bool
+	}{
+		{name: "first sync without start block", safe: 10000, max: 100, wantFrom: 9900, wantTo: 9999, wantOK: true},
+		{name: "first sync on a short chain", safe: 50, max: 100, wantFrom: 1, wantTo: 50, wantOK: true},
+		{name: "cursor behind start block", lastBlock: 10, startBlock: 500, safe: 1000, max: 100, wantFrom: 500, wantTo: 599, wantOK: true},
+		{name: "continue after cursor", lastBlock: 500, startBlock: 100, safe: 520, max: 100, wantFrom: 501, wantTo: 520, wantOK: true},
+		{name: "range capped", lastBlock: 500, safe: 10000, max: 100, wantFrom: 501, wantTo: 600, wantOK: true},
+		{name: "single block", lastBlock: 500, safe: 501, max: 100, wantFrom: 501, wantTo: 501, wantOK: true},
+		{name: "caught up", lastBlock: 500, safe: 500, max: 100},
+		{name: "safe head behind start block", startBlock: 500, safe: 400, max: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ok := nextSyncRange(tt.lastBlock, tt.startBlock, tt.safe, tt.max)
+			if from != tt.wantFrom || to != tt.wantTo || ok != tt.wantOK {
+				t.Fatalf("nextSyncRange = (%d, %d, %v), want (%d, %d, %v)", from, to, ok, tt.wantFrom, tt.wantTo, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecordSyncError(t *testing.T) {
+	db := openTestDB(t)
+	circuitOpen := &RPCError{Method: "eth_getBlockByNumber", Kind: rpcErrorCircuitOpen, Err: errCircuitOpen}
+	_, finalityErr := taggedBlockNumber(context.Background(), &stubChain{headerByNumber: func(*big.Int) (*types.Header, error) {
+		return nil, circuitOpen
+	}}, finalitySafe)
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			// 与 syncRange → fetchRange 的包装方式相同
+			name: "wrapped circuit open",
+			err:  fmt.Errorf("获取 test 最新区块失败: %w", fmt.Errorf("获取 test 区块 1 失败: %w", circuitOpen)),
+			want: "circuit_open",
+		},
+		{
+			name: "circuit open from the finality lookup",
+			err:  fmt.Errorf("获取 test 已确认高度失败 (策略 safe): %w", finalityErr),
+			want: "circuit_open",
+		},
+		{
+			name: "transient rpc error",
+			err:  fmt.Errorf("查询 test 事件日志失败: %w", &RPCError{Method: "eth_getLogs", Kind: rpcErrorTransient, Err: errors.New("timeout")}),
+			want: "error",
+		},
+		{name: "other error", err: errors.New("数据库不可用"), want: "error"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chainName := fmt.Sprintf("chain-%d", i)
+			if err := db.Create(&models.ChainSyncStatus{ChainName: chainName, ChainID: int64(i + 1)}).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := recordSyncError(db, chainName, tt.err); err != nil {
+				t.Fatal(err)
+			}
+
+			var cursor models.ChainSyncStatus
+			if err := db.Where("chain_name = ?", chainName).First(&cursor).Error; err != nil {
+				t.Fatal(err)
+			}
+			if cursor.Status != tt.want || cursor.ConsecutiveErrors != 1 || cursor.LastError != tt.err.Error() {
+				t.Fatalf("cursor = status %q, errors %d, last error %q; want status %q", cursor.Status, cursor.ConsecutiveErrors, cursor.LastError, tt.want)
+			}
+		})
+	}
+}
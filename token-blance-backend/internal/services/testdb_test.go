@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"token-balance/pkg/database"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 创建一个临时的 MySQL 数据库并迁移所有表，测试结束后删除
+//
+// 需要设置 TEST_MYSQL_DSN 为不带库名的连接串，例如 root:password@tcp(127.0.0.1:3306)/，未设置时跳过测试。
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_MYSQL_DSN，跳过需要数据库的测试")
+	}
+	base := strings.TrimSuffix(strings.SplitN(dsn, "?", 2)[0], "/") + "/"
+	params := "charset=utf8mb4&parseTime=True&loc=Local"
+
+	admin, err := gorm.Open(mysql.Open(base+"?"+params), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+	name := fmt.Sprintf("token_balance_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP DATABASE " + name)
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	db, err := gorm.Open(mysql.Open(base+name+"?"+params), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	database.AutoMigrate(db)
+	return db
+}
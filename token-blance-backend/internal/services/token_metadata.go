@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+	"token-balance/pkg/contracts"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+)
+
+// metadataCallTimeout 读取代币元数据时每次合约调用的超时时间
+const metadataCallTimeout = 10 * time.Second
+
+// tokenMetadata 从合约读取的代币元数据
+type tokenMetadata struct {
+	Name      string
+	Symbol    string
+	Decimals  uint8
+	MaxSupply string         // getContractInfo 的最大供应量，合约没有该方法时为空
+	Owner     common.Address // getContractInfo 的合约所有者
+}
+
+// fetchTokenMetadata 调用合约的 decimals()、symbol()、name() 和 getContractInfo()
+//
+// decimals() 是必需的，失败时返回错误；symbol()/name() 兼容返回 bytes32 的旧合约；
+// getContractInfo() 只有 TokenBalance 合约提供，其他 ERC20 代币调用失败时忽略。
+func fetchTokenMetadata(ctx context.Context, client ChainBackend, address common.Address) (*tokenMetadata, error) {
+	tokenABI, err := contracts.TokenBalanceABI()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &tokenMetadata{}
+	values, err := callToken(ctx, client, tokenABI, address, "decimals")
+	if err != nil {
+		return nil, err
+	}
+	decimals, ok := values[0].(uint8)
+	if !ok {
+		return nil, fmt.Errorf("decimals() 返回值无效: %v", values[0])
+	}
+	metadata.Decimals = decimals
+
+	metadata.Symbol, err = callTokenString(ctx, client, tokenABI, address, "symbol")
+	if err != nil {
+		return nil, err
+	}
+	metadata.Name, err = callTokenString(ctx, client, tokenABI, address, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	if values, err := callToken(ctx, client, tokenABI, address, "getContractInfo"); err == nil && len(values) == 5 {
+		if maxSupply, ok := values[3].(*big.Int); ok {
+			metadata.MaxSupply = maxSupply.String()
+		}
+		if owner, ok := values[4].(common.Address); ok {
+			metadata.Owner = owner
+		}
+	} else if err != nil {
+		middleware.Debug("代币 %s 不支持 getContractInfo(): %v", address.Hex(), err)
+	}
+
+	return metadata, nil
+}
+
+// callToken 调用代币合约的只读方法并解析返回值
+func callToken(ctx context.Context, client ChainBackend, tokenABI abi.ABI, address common.Address, method string) ([]interface{}, error) {
+	data, err := callTokenRaw(ctx, client, tokenABI, address, nil, method)
+	if err != nil {
+		return nil, err
+	}
+	values, err := tokenABI.Unpack(method, data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s() 返回值失败: %v", method, err)
+	}
+	return values, nil
+}
+
+// callTokenRaw 调用代币合约的只读方法，返回原始返回数据
+//
+// blockNumber 为 nil 时读取最新区块的状态。
+func callTokenRaw(ctx context.Context, client ChainBackend, tokenABI abi.ABI, address common.Address, blockNumber *big.Int, method string, args ...interface{}) ([]byte, error) {
+	input, err := tokenABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, metadataCallTimeout)
+	defer cancel()
+	data, err := client.CallContract(callCtx, ethereum.CallMsg{To: &address, Data: input}, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("调用 %s() 失败: %v", method, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("调用 %s() 没有返回数据 (地址不是合约或没有该方法)", method)
+	}
+	return data, nil
+}
+
+// callTokenString 读取字符串类型的元数据，兼容返回 bytes32 的旧合约 (例如 MKR)
+func callTokenString(ctx context.Context, client ChainBackend, tokenABI abi.ABI, address common.Address, method string) (string, error) {
+	data, err := callTokenRaw(ctx, client, tokenABI, address, nil, method)
+	if err != nil {
+		return "", err
+	}
+	if values, err := tokenABI.Unpack(method, data); err == nil {
+		if value, ok := values[0].(string); ok {
+			return value, nil
+		}
+	}
+	if len(data) == 32 {
+		return string(bytes.TrimRight(data, "\x00")), nil
+	}
+	return "", fmt.Errorf("解析 %s() 返回值失败", method)
+}
+
+// refreshTokenMetadata 从合约读取代币元数据并写入代币登记表
+//
+// 精度以合约为准，与登记时填写的精度不一致时覆盖并记录警告；
+// 登记时填写过的符号保留 (跨链资产汇总按符号分组)，为空时使用合约的 symbol()。
+func refreshTokenMetadata(ctx context.Context, db *gorm.DB, client ChainBackend, token *models.Token) error {
+	metadata, err := fetchTokenMetadata(ctx, client, common.HexToAddress(token.Address))
+	if err != nil {
+		return fmt.Errorf("读取代币 %s 的元数据失败: %v", token.Address, err)
+	}
+
+	if metadata.Decimals != token.Decimals {
+		middleware.Warn("⚠️ 代币 %s (链 %s) 的精度为 %d，与登记的 %d 不一致，已按合约更新",
+			token.Address, token.ChainName, metadata.Decimals, token.Decimals)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"name":                metadata.Name,
+		"decimals":            metadata.Decimals,
+		"max_supply":          metadata.MaxSupply,
+		"metadata_updated_at": now,
+	}
+	if metadata.Owner != (common.Address{}) {
+		updates["owner"] = metadata.Owner.Hex()
+	}
+	if token.Symbol == "" {
+		updates["symbol"] = metadata.Symbol
+	}
+	if err := db.Model(token).Updates(updates).Error; err != nil {
+		return fmt.Errorf("保存代币 %s 的元数据失败: %v", token.Address, err)
+	}
+
+	middleware.Info("🪙 已读取代币元数据: %s %s (%s, 精度 %d, 链 %s)",
+		metadata.Symbol, metadata.Name, token.Address, metadata.Decimals, token.ChainName)
+	return nil
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"token-balance/config"
+	"token-balance/internal/middleware"
+	"token-balance/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultTokenDecimals 未指定精度时使用的默认值
+const defaultTokenDecimals = uint8(18)
+
+// ErrTokenNotFound 代币未登记
+var ErrTokenNotFound = errors.New("代币不存在")
+
+// TokenService 代币登记服务
+//
+// 管理 tokens 表：索引器按链读取已启用的代币地址作为日志过滤条件，
+// 新登记的代币从链的同步游标之后开始入账。
+type TokenService struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+// TokenInput 登记或修改代币的参数，修改时只更新非空字段
+type TokenInput struct {
+	Chain      string  `json:"chain"`       // 链名称 (sepolia, base-sepolia)，与 chain_id 二选一
+	ChainID    int64   `json:"chain_id"`    // 链ID
+	Address    string  `json:"address"`     // 代币合约地址
+	Symbol     string  `json:"symbol"`      // 代币符号
+	Decimals   *uint8  `json:"decimals"`    // 精度，默认18，读取到合约的 decimals() 后以合约为准
+	StartBlock *uint64 `json:"start_block"` // 合约部署区块
+	Enabled    *bool   `json:"enabled"`     // 是否启用，默认启用
+}
+
+// NewTokenService 创建代币登记服务
+func NewTokenService(db *gorm.DB, cfg *config.Config) *TokenService {
+	return &TokenService{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// ListTokens 获取已登记的代币，chain 为空时返回所有链
+func (ts *TokenService) ListTokens(chain string, enabledOnly bool) ([]models.Token, error) {
+	query := ts.db.Model(&models.Token{})
+	if chain != "" {
+		query = query.Where("chain_name = ?", chain)
+	}
+	if enabledOnly {
+		query = query.Where("enabled = ?", true)
+	}
+
+	var tokens []models.Token
+	if err := query.Order("chain_id asc, id asc").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		formatToken(&tokens[i])
+	}
+	return tokens, nil
+}
+
+// GetToken 获取单个代币
+func (ts *TokenService) GetToken(id uint) (*models.Token, error) {
+	var token models.Token
+	err := ts.db.First(&token, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	formatToken(&token)
+	return &token, nil
+}
+
+// CreateToken 登记代币
+func (ts *TokenService) CreateToken(input TokenInput) (*models.Token, error) {
+	chainName, chainID, err := ts.resolveChain(input.Chain, input.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if !common.IsHexAddress(input.Address) {
+		return nil, fmt.Errorf("无效的代币地址: %s", input.Address)
+	}
+	address := common.HexToAddress(input.Address)
+	if isZeroAddress(address) {
+		return nil, fmt.Errorf("代币地址不能为零地址")
+	}
+
+	token := models.Token{
+		ChainID:   chainID,
+		ChainName: chainName,
+		Address:   address.Hex(),
+		Symbol:    strings.TrimSpace(input.Symbol),
+		Decimals:  defaultTokenDecimals,
+		Enabled:   true,
+	}
+	if input.Decimals != nil {
+		token.Decimals = *input.Decimals
+	}
+	if input.StartBlock != nil {
+		token.StartBlock = *input.StartBlock
+	}
+	if input.Enabled != nil {
+		token.Enabled = *input.Enabled
+	}
+
+	result := ts.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("代币 %s 已在链 %s 上登记", token.Address, chainName)
+	}
+
+	middleware.Info("🪙 登记代币: %s %s (链 %s, 起始区块 %d)", token.Symbol, token.Address, chainName, token.StartBlock)
+	return &token, nil
+}
+
+// RefreshMetadata 重新从合约读取代币的精度、符号、名称和最大供应量
+//
+// 同步器会自动读取尚未读取过元数据的代币，合约升级或读取失败后可以通过这里手动刷新。
+func (ts *TokenService) RefreshMetadata(ctx context.Context, id uint) (*models.Token, error) {
+	token, err := ts.GetToken(id)
+	if err != nil {
+		return nil, err
+	}
+
+	chains, err := loadChainConfigs(ts.db, ts.cfg)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, ok := chains[token.ChainName]
+	if !ok {
+		return nil, fmt.Errorf("未配置的链: %s", token.ChainName)
+	}
+
+	client, err := DialRPCPool(token.ChainName, chainConfig.RPCURLs, chainConfig.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if err := refreshTokenMetadata(ctx, ts.db, client, token); err != nil {
+		return nil, err
+	}
+	return ts.GetToken(id)
+}
+
+// UpdateToken 修改代币的符号、精度、起始区块或启用状态
+func (ts *TokenService) UpdateToken(id uint, input TokenInput) (*models.Token, error) {
+	token, err := ts.GetToken(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if symbol := strings.TrimSpace(input.Symbol); symbol != "" {
+		updates["symbol"] = symbol
+	}
+	if input.Decimals != nil {
+		updates["decimals"] = *input.Decimals
+	}
+	if input.StartBlock != nil {
+		updates["start_block"] = *input.StartBlock
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+	if len(updates) == 0 {
+		return token, nil
+	}
+
+	if err := ts.db.Model(token).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	middleware.Info("🪙 修改代币 %s (链 %s): %v", token.Address, token.ChainName, updates)
+	return ts.GetToken(id)
+}
+
+// DeleteToken 删除代币登记，已入账的事件和余额历史保留
+func (ts *TokenService) DeleteToken(id uint) error {
+	token, err := ts.GetToken(id)
+	if err != nil {
+		return err
+	}
+	if err := ts.db.Delete(token).Error; err != nil {
+		return err
+	}
+	middleware.Info("🪙 删除代币登记: %s (链 %s)", token.Address, token.ChainName)
+	return nil
+}
+
+// PendingHistory 代币的起始区块是否早于链的同步游标
+//
+// 游标之前的区块不会再被同步，这部分历史需要从起始区块重新回填 (reset) 才能补齐。
+// 返回链当前已处理到的区块。
+func (ts *TokenService) PendingHistory(token *models.Token) (bool, uint64, error) {
+	var cursor models.ChainSyncStatus
+	err := ts.db.Where("chain_name = ?", token.ChainName).First(&cursor).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return cursor.LastBlock > 0 && token.StartBlock <= cursor.LastBlock, cursor.LastBlock, nil
+}
+
+// resolveChain 根据链名称或链ID查找已定义的链
+func (ts *TokenService) resolveChain(chain string, chainID int64) (string, int64, error) {
+	chains, err := loadChainConfigs(ts.db, ts.cfg)
+	if err != nil {
+		return "", 0, err
+	}
+	if chain != "" {
+		chainConfig, ok := chains[chain]
+		if !ok {
+			return "", 0, fmt.Errorf("未配置的链: %s", chain)
+		}
+		if chainID != 0 && chainID != chainConfig.ChainID {
+			return "", 0, fmt.Errorf("链 %s 的链ID为 %d，与参数 %d 不一致", chain, chainConfig.ChainID, chainID)
+		}
+		return chain, chainConfig.ChainID, nil
+	}
+	if chainID == 0 {
+		return "", 0, fmt.Errorf("必须指定链名称或链ID")
+	}
+	return chainNameByID(chains, chainID), chainID, nil
+}
+
+// formatToken 填写代币的可读最大供应量
+func formatToken(token *models.Token) {
+	if token.MaxSupply != "" {
+		token.MaxSupplyFormatted = formatTokenAmount(token.MaxSupply, token.Decimals)
+	}
+}
+
+// enabledTokens 链上已启用的代币
+func enabledTokens(db *gorm.DB, chainID int64) ([]models.Token, error) {
+	var tokens []models.Token
+	err := db.Where("chain_id = ? AND enabled = ?", chainID, true).
+		Order("id asc").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// registerConfiguredToken 登记配置文件中的代币合约 (TOKEN_CONTRACT_ADDRESS)
+//
+// 已登记时不做任何修改，合约地址为空时忽略。
+func registerConfiguredToken(db *gorm.DB, chainName string, chainID int64, contract common.Address, startBlock uint64) error {
+	if isZeroAddress(contract) {
+		return nil
+	}
+
+	token := models.Token{
+		ChainID:    chainID,
+		ChainName:  chainName,
+		Address:    contract.Hex(),
+		Decimals:   defaultTokenDecimals,
+		StartBlock: startBlock,
+		Enabled:    true,
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&token)
+	if result.Error != nil {
+		return fmt.Errorf("登记 %s 代币 %s 失败: %v", chainName, contract.Hex(), result.Error)
+	}
+	if result.RowsAffected > 0 {
+		middleware.Info("🪙 已登记配置的代币合约: %s (链 %s, 起始区块 %d)", contract.Hex(), chainName, startBlock)
+	}
+	return nil
+}
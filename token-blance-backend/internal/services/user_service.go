@@ -1,8 +1,12 @@
 package services
 
 import (
+	"math/big"
+	"sort"
+	"strconv"
 	"token-balance/internal/models"
 
+	"github.com/ethereum/go-ethereum/common"
 	"gorm.io/gorm"
 )
 
@@ -11,6 +15,43 @@ type UserService struct {
 	db *gorm.DB
 }
 
+// BalanceFilter 余额查询的过滤条件，字段为空时不过滤
+type BalanceFilter struct {
+	Chain string // 链名称 (sepolia) 或链ID (11155111)
+	Token string // 代币合约地址或代币符号
+}
+
+// UserBalance 用户在各 (链, 代币) 上的持仓
+type UserBalance struct {
+	Address          string           `json:"address"`
+	Balance          string           `json:"balance,omitempty"`           // 按链和代币过滤到单个持仓时为该持仓的余额 (最小单位)，不同代币的余额不相加
+	BalanceFormatted string           `json:"balance_formatted,omitempty"` // 按代币精度换算后的余额
+	TotalPoints      float64          `json:"total_points"`
+	Holdings         []models.Holding `json:"holdings"`
+}
+
+// AssetBalance 同一资产在各链上的持仓汇总
+//
+// 资产按代币登记中的符号识别，未登记符号的代币按合约地址单独成为一个资产。
+// 各链精度不同时，余额统一换算到最大精度后再相加。
+type AssetBalance struct {
+	Symbol           string              `json:"symbol"`
+	Decimals         uint8               `json:"decimals"`
+	Balance          string              `json:"balance"` // 按 Decimals 换算后的跨链余额之和
+	BalanceFormatted string              `json:"balance_formatted"`
+	Chains           []AssetChainBalance `json:"chains"`
+}
+
+// AssetChainBalance 资产在单条链上的持仓
+type AssetChainBalance struct {
+	ChainID          int64  `json:"chain_id"`
+	ChainName        string `json:"chain_name"`
+	TokenAddress     string `json:"token_address"`
+	Decimals         uint8  `json:"decimals"`
+	Balance          string `json:"balance"`
+	BalanceFormatted string `json:"balance_formatted"`
+}
+
 // NewUserService 创建用户服务
 func NewUserService(db *gorm.DB) *UserService {
 	return &UserService{
@@ -27,7 +68,6 @@ func (us *UserService) GetUserByAddress(address string) (*models.User, error) {
 			// 如果用户不存在，创建新用户
 			user = models.User{
 				ID:          address,
-				Balance:     "0",
 				TotalPoints: 0,
 			}
 			err = us.db.Create(&user).Error
@@ -41,8 +81,141 @@ func (us *UserService) GetUserByAddress(address string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserBalance 获取用户在各 (链, 代币) 上的持仓
+func (us *UserService) GetUserBalance(address string, filter BalanceFilter) (*UserBalance, error) {
+	user, err := us.GetUserByAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var holdings []models.Holding
+	err = us.applyBalanceFilter(us.db.Where("user_address = ?", address), filter).
+		Order("chain_id asc, token_address asc").
+		Find(&holdings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := loadTokenDecimals(us.db)
+	if err != nil {
+		return nil, err
+	}
+	formatHoldings(holdings, decimals)
+
+	balance := &UserBalance{
+		Address:     user.ID,
+		TotalPoints: user.TotalPoints,
+		Holdings:    holdings,
+	}
+	switch {
+	case len(holdings) == 1:
+		balance.Balance = holdings[0].Balance
+		balance.BalanceFormatted = holdings[0].BalanceFormatted
+	case len(holdings) == 0 && filter.Chain != "" && filter.Token != "":
+		balance.Balance = "0"
+		balance.BalanceFormatted = "0"
+	}
+	return balance, nil
+}
+
+// GetUserAssets 获取用户按资产汇总的跨链持仓，token 为代币地址或符号，为空时返回所有资产
+func (us *UserService) GetUserAssets(address, token string) ([]AssetBalance, error) {
+	var holdings []models.Holding
+	err := us.applyBalanceFilter(us.db.Where("user_address = ?", address), BalanceFilter{Token: token}).
+		Order("chain_id asc, token_address asc").
+		Find(&holdings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []models.Token
+	if err := us.db.Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	registry := make(map[string]models.Token, len(tokens))
+	for _, t := range tokens {
+		registry[tokenKey(t.ChainID, t.Address)] = t
+	}
+
+	assets := make(map[string]*AssetBalance)
+	for _, holding := range holdings {
+		balance, ok := new(big.Int).SetString(holding.Balance, 10)
+		if !ok || balance.Sign() == 0 {
+			continue
+		}
+
+		part := AssetChainBalance{
+			ChainID:      holding.ChainID,
+			ChainName:    strconv.FormatInt(holding.ChainID, 10),
+			TokenAddress: holding.TokenAddress,
+			Decimals:     defaultTokenDecimals,
+			Balance:      holding.Balance,
+		}
+		symbol := holding.TokenAddress
+		if t, ok := registry[tokenKey(holding.ChainID, holding.TokenAddress)]; ok {
+			part.ChainName = t.ChainName
+			part.Decimals = t.Decimals
+			if t.Symbol != "" {
+				symbol = t.Symbol
+			}
+		}
+
+		asset, exists := assets[symbol]
+		if !exists {
+			asset = &AssetBalance{Symbol: symbol}
+			assets[symbol] = asset
+		}
+		part.BalanceFormatted = formatTokenAmount(part.Balance, part.Decimals)
+		asset.Chains = append(asset.Chains, part)
+	}
+
+	result := make([]AssetBalance, 0, len(assets))
+	for _, asset := range assets {
+		for _, part := range asset.Chains {
+			if part.Decimals > asset.Decimals {
+				asset.Decimals = part.Decimals
+			}
+		}
+		total := new(big.Int)
+		for _, part := range asset.Chains {
+			balance, _ := new(big.Int).SetString(part.Balance, 10)
+			scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(asset.Decimals-part.Decimals)), nil)
+			total.Add(total, balance.Mul(balance, scale))
+		}
+		asset.Balance = total.String()
+		asset.BalanceFormatted = formatTokenAmount(asset.Balance, asset.Decimals)
+		result = append(result, *asset)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+
+	return result, nil
+}
+
+// applyBalanceFilter 按链和代币过滤持仓或余额历史
+//
+// 链可以是链ID或代币登记中的链名称；代币可以是合约地址或代币符号。
+func (us *UserService) applyBalanceFilter(query *gorm.DB, filter BalanceFilter) *gorm.DB {
+	if filter.Chain != "" {
+		if chainID, err := strconv.ParseInt(filter.Chain, 10, 64); err == nil {
+			query = query.Where("chain_id = ?", chainID)
+		} else {
+			query = query.Where("chain_id IN (?)",
+				us.db.Model(&models.Token{}).Select("chain_id").Where("chain_name = ?", filter.Chain))
+		}
+	}
+	if filter.Token != "" {
+		if common.IsHexAddress(filter.Token) {
+			query = query.Where("token_address = ?", common.HexToAddress(filter.Token).Hex())
+		} else {
+			query = query.Where("token_address IN (?)",
+				us.db.Model(&models.Token{}).Select("address").Where("symbol = ?", filter.Token))
+		}
+	}
+	return query
+}
+
 // GetUserBalanceHistory 获取用户余额历史
-func (us *UserService) GetUserBalanceHistory(address, page, pageSize string) (*models.PaginatedData, error) {
+func (us *UserService) GetUserBalanceHistory(address, page, pageSize string, filter BalanceFilter) (*models.PaginatedData, error) {
 	var histories []models.UserBalanceHistory
 	var total int64
 
@@ -53,20 +226,26 @@ func (us *UserService) GetUserBalanceHistory(address, page, pageSize string) (*m
 	}
 
 	// 查询总数
-	err := us.db.Model(&models.UserBalanceHistory{}).Where("user_address = ?", address).Count(&total).Error
+	err := us.applyBalanceFilter(us.db.Model(&models.UserBalanceHistory{}).Where("user_address = ?", address), filter).
+		Count(&total).Error
 	if err != nil {
 		return nil, err
 	}
 
 	// 查询数据
-	err = us.db.Where("user_address = ?", address).
-		Order("timestamp desc").
+	err = us.applyBalanceFilter(us.db.Where("user_address = ?", address), filter).
+		Order("block_number desc, log_index desc, id desc").
 		Offset(offset).
 		Limit(StringToInt(pageSize)).
 		Find(&histories).Error
 	if err != nil {
 		return nil, err
 	}
+	decimals, err := loadTokenDecimals(us.db)
+	if err != nil {
+		return nil, err
+	}
+	formatBalanceHistory(histories, decimals)
 
 	totalPages := (total + int64(StringToInt(pageSize)) - 1) / int64(StringToInt(pageSize))
 
@@ -86,12 +265,15 @@ func (us *UserService) GetUserPoints(address string) ([]models.PointsRecord, err
 		Order("calculate_date desc").
 		Limit(100). // 限制返回最新100条记录
 		Find(&points).Error
-	return points, err
-}
-
-// UpdateUserBalance 更新用户余额
-func (us *UserService) UpdateUserBalance(address, balance string) error {
-	return us.db.Model(&models.User{}).Where("id = ?", address).Update("balance", balance).Error
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := loadTokenDecimals(us.db)
+	if err != nil {
+		return nil, err
+	}
+	formatPointsRecords(points, decimals)
+	return points, nil
 }
 
 // UpdateUserPoints 更新用户积分
@@ -0,0 +1,61 @@
+// Package contracts TokenBalance 合约的 ABI 和字节码
+//
+// TokenBalance.json 是 token-blance-contract 使用 Hardhat 编译生成的构件，
+// 合约修改并重新编译后需要复制到这里。
+package contracts
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//go:embed TokenBalance.json
+var tokenBalanceArtifact []byte
+
+// artifact Hardhat 编译构件中用到的字段
+type artifact struct {
+	ABI      json.RawMessage `json:"abi"`
+	Bytecode string          `json:"bytecode"`
+}
+
+var (
+	loadOnce sync.Once
+	tokenABI abi.ABI
+	bytecode []byte
+	loadErr  error
+)
+
+// load 解析编译构件，只解析一次
+func load() {
+	loadOnce.Do(func() {
+		var a artifact
+		if err := json.Unmarshal(tokenBalanceArtifact, &a); err != nil {
+			loadErr = fmt.Errorf("解析 TokenBalance 编译构件失败: %v", err)
+			return
+		}
+		tokenABI, loadErr = abi.JSON(strings.NewReader(string(a.ABI)))
+		if loadErr != nil {
+			loadErr = fmt.Errorf("解析 TokenBalance ABI 失败: %v", loadErr)
+			return
+		}
+		bytecode = common.FromHex(a.Bytecode)
+	})
+}
+
+// TokenBalanceABI TokenBalance 合约 ABI
+func TokenBalanceABI() (abi.ABI, error) {
+	load()
+	return tokenABI, loadErr
+}
+
+// TokenBalanceBytecode TokenBalance 合约部署字节码
+func TokenBalanceBytecode() ([]byte, error) {
+	load()
+	return bytecode, loadErr
+}
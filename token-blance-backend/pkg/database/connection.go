@@ -1,6 +1,7 @@
 package database
 
 import (
+	"strings"
 	"token-balance/config"
 	"token-balance/internal/middleware"
 	"token-balance/internal/models"
@@ -39,10 +40,17 @@ func InitDB() *gorm.DB {
 	return db
 }
 
+// OpenDatabase 按配置打开一个新的数据库连接，不影响 InitDB 的全局连接
+func OpenDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	return gorm.Open(mysql.Open(cfg.GetDSN()), &gorm.Config{})
+}
+
 // AutoMigrate 自动迁移数据库表
 func AutoMigrate(db *gorm.DB) {
 	middleware.Info("开始执行数据库迁移...")
 
+	dropLegacyIndexes(db)
+
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.UserBalanceHistory{},
@@ -50,6 +58,17 @@ func AutoMigrate(db *gorm.DB) {
 		&models.EventLog{},
 		&models.UserDailySummary{},
 		&models.SystemStats{},
+		&models.ChainSyncStatus{},
+		&models.ChainBlock{},
+		&models.ReorgReport{},
+		&models.ConsistencyIssue{},
+		&models.Token{},
+		&models.Holding{},
+		&models.ChainDefinition{},
+		&models.DeadLetter{},
+		&models.RawLog{},
+		&models.Distribution{},
+		&models.DistributionLeaf{},
 	)
 
 	if err != nil {
@@ -57,9 +76,68 @@ func AutoMigrate(db *gorm.DB) {
 		panic(err)
 	}
 
+	if err := widenChangeTypes(db); err != nil {
+		middleware.Error("数据库迁移失败: %v", err)
+		panic(err)
+	}
+
 	middleware.Info("数据库迁移完成")
 }
 
+// dropLegacyIndexes 删除旧版本遗留的唯一索引
+//
+// event_logs 和 user_balance_history 早期在 tx_hash 上建了唯一索引，导致同一笔交易
+// 的多条日志（batchMint）或转账双方的记录无法写入。AutoMigrate 不会删除索引，
+// 这里在迁移前手动删除，事件标识改为 (chain_id, tx_hash, log_index)。
+// raw_logs 的唯一索引改为 (chain_id, block_hash, log_index)，重组前后同一日志可以各保存一行。
+func dropLegacyIndexes(db *gorm.DB) {
+	legacyIndexes := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.EventLog{}, "idx_event_logs_tx_hash"},
+		{&models.UserBalanceHistory{}, "idx_user_balance_history_tx_hash"},
+		{&models.RawLog{}, "idx_raw_log_identity"},
+	}
+
+	for _, legacy := range legacyIndexes {
+		if db.Migrator().HasIndex(legacy.model, legacy.name) {
+			if err := db.Migrator().DropIndex(legacy.model, legacy.name); err != nil {
+				middleware.Error("删除旧索引 %s 失败: %v", legacy.name, err)
+			} else {
+				middleware.Info("已删除旧索引 %s", legacy.name)
+			}
+		}
+	}
+}
+
+// widenChangeTypes 为余额历史的 change_type 枚举补充新增的类型
+//
+// AutoMigrate 只比较列类型名称 (enum)，不会修改已有表的枚举值，
+// 列的定义缺少模型中的某个类型时按模型重新定义该列。
+func widenChangeTypes(db *gorm.DB) error {
+	if db.Dialector.Name() != "mysql" {
+		return nil
+	}
+
+	columnTypes, err := db.Migrator().ColumnTypes(&models.UserBalanceHistory{})
+	if err != nil {
+		return err
+	}
+	for _, column := range columnTypes {
+		if column.Name() != "change_type" {
+			continue
+		}
+		definition, _ := column.ColumnType()
+		if strings.Contains(definition, "'reconciliation'") {
+			return nil
+		}
+		middleware.Info("扩展 user_balance_history.change_type 枚举: %s", definition)
+		return db.Migrator().AlterColumn(&models.UserBalanceHistory{}, "ChangeType")
+	}
+	return nil
+}
+
 // GetDB 获取数据库实例
 func GetDB() *gorm.DB {
 	return db
@@ -64,8 +64,21 @@ func AutoMigrateWithConfig(db *gorm.DB) error {
 		&models.UserDailySummary{},
 		&models.EventLog{},
 		&models.SystemStats{},
+		&models.ChainSyncStatus{},
+		&models.ChainBlock{},
+		&models.ReorgReport{},
+		&models.ConsistencyIssue{},
+		&models.Token{},
+		&models.Holding{},
+		&models.ChainDefinition{},
+		&models.DeadLetter{},
+		&models.RawLog{},
+		&models.Distribution{},
+		&models.DistributionLeaf{},
 	}
 
+	dropLegacyIndexes(db)
+
 	// 执行迁移
 	for _, model := range modelList {
 		if err := db.AutoMigrate(model); err != nil {
@@ -74,6 +87,10 @@ func AutoMigrateWithConfig(db *gorm.DB) error {
 		log.Printf("表 %T 迁移成功", model)
 	}
 
+	if err := widenChangeTypes(db); err != nil {
+		return fmt.Errorf("扩展余额变动类型失败: %w", err)
+	}
+
 	// 创建索引
 	if err := createIndexes(db); err != nil {
 		return fmt.Errorf("创建索引失败: %w", err)